@@ -0,0 +1,284 @@
+package bean
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type Operation int
+
+const ( // iota is reset to 0
+	PlaceLimitOrder     Operation = 0
+	CancelOpenOrder     Operation = 1
+	Wait                Operation = 2
+	CancelAllOpenOrders Operation = 3
+	AmendOpenOrder      Operation = 4
+)
+
+var operationNames = map[Operation]string{
+	PlaceLimitOrder:     "LIMIT",
+	CancelOpenOrder:     "CANCEL",
+	Wait:                "WAIT",
+	CancelAllOpenOrders: "CANCEL_ALL",
+	AmendOpenOrder:      "AMEND",
+}
+
+func (op Operation) String() string {
+	if s, ok := operationNames[op]; ok {
+		return s
+	}
+	return fmt.Sprint("Operation(", int(op), ")")
+}
+
+func (op Operation) MarshalText() ([]byte, error) {
+	if _, ok := operationNames[op]; !ok {
+		return nil, errors.New("unknown operation " + op.String())
+	}
+	return []byte(op.String()), nil
+}
+
+func (op *Operation) UnmarshalText(text []byte) error {
+	for o, s := range operationNames {
+		if s == string(text) {
+			*op = o
+			return nil
+		}
+	}
+	return errors.New("unknown operation " + string(text))
+}
+
+// ActionParams are the typed parameters of a TradeAction, one of LimitParams, CancelParams, CancelAllParams,
+// AmendParams and WaitParams
+type ActionParams interface {
+	Operation() Operation
+}
+
+// LimitParams places a limit order, a positive amount buys and a negative amount sells
+type LimitParams struct {
+	Price      float64   `json:"price"`
+	Amount     float64   `json:"amount"`
+	Life       OrderLife `json:"life"`       // GoodTillCancelled if not set
+	PostOnly   bool      `json:"postOnly"`   // only placed if it does not take liquidity
+	ReduceOnly bool      `json:"reduceOnly"` // only placed as far as it reduces the position
+}
+
+// CancelParams cancels an open order
+type CancelParams struct {
+	OrderID string `json:"orderID"`
+}
+
+// CancelAllParams cancels all open orders of the pair
+type CancelAllParams struct{}
+
+// AmendParams changes the price and amount of an open order
+type AmendParams struct {
+	OrderID string  `json:"orderID"`
+	Price   float64 `json:"price"`
+	Amount  float64 `json:"amount"`
+}
+
+// WaitParams pauses before the next action
+type WaitParams struct {
+	Duration time.Duration `json:"duration"`
+}
+
+func (LimitParams) Operation() Operation     { return PlaceLimitOrder }
+func (CancelParams) Operation() Operation    { return CancelOpenOrder }
+func (CancelAllParams) Operation() Operation { return CancelAllOpenOrders }
+func (AmendParams) Operation() Operation     { return AmendOpenOrder }
+func (WaitParams) Operation() Operation      { return Wait }
+
+// OrderLife returns the life of the order, GoodTillCancelled if not set
+func (p LimitParams) OrderLife() OrderLife {
+	if p.Life == 0 {
+		return GoodTillCancelled
+	}
+	return p.Life
+}
+
+// errors of orders whose flags prevent them from being placed
+var (
+	ErrPostOnlyWouldTake = errors.New("post only order would take liquidity")
+	ErrFillOrKill        = errors.New("fill or kill order cannot be filled")
+	ErrNotReducing       = errors.New("reduce only order would not reduce the position")
+)
+
+// Check returns the amount to place given the orderbook and the position the order would reduce, e.g. the coin
+// balance on spot exchanges. Reduce-only orders are cut to the position, post-only orders crossing the book and
+// fill-or-kill orders the book cannot fill are rejected
+func (p LimitParams) Check(ob OrderBook, position float64) (float64, error) {
+	amount := p.Amount
+	if p.ReduceOnly {
+		if position*amount >= 0 {
+			return 0.0, ErrNotReducing
+		}
+		amount = math.Copysign(math.Min(math.Abs(amount), math.Abs(position)), amount)
+	}
+	if p.PostOnly || p.OrderLife() == FillOrKill {
+		matched := ob.Match(Order{Price: p.Price, Amount: amount})
+		if p.PostOnly && matched.Amount != 0 {
+			return 0.0, ErrPostOnlyWouldTake
+		}
+		if p.OrderLife() == FillOrKill && math.Abs(matched.Amount) < math.Abs(amount)*(1-1e-9) {
+			return 0.0, ErrFillOrKill
+		}
+	}
+	return amount, nil
+}
+
+type TradeAction struct {
+	ExName string
+	Op     Operation
+	Pair   Pair
+	Params ActionParams
+}
+
+// NewTradeAction returns the action of the params on pair of exName
+func NewTradeAction(exName string, pair Pair, params ActionParams) TradeAction {
+	return TradeAction{
+		ExName: exName,
+		Op:     params.Operation(),
+		Pair:   pair,
+		Params: params,
+	}
+}
+
+// Validate checks that the params are those of the operation
+func (t TradeAction) Validate() error {
+	if t.Params == nil {
+		return errors.New("no params for " + t.Op.String())
+	}
+	if t.Params.Operation() != t.Op {
+		return fmt.Errorf("%T params for %s", t.Params, t.Op)
+	}
+	return nil
+}
+
+func (t TradeAction) Show() string {
+	switch p := t.Params.(type) {
+	case LimitParams:
+		side := "`b["
+		if p.Amount < 0 {
+			side = "`s["
+		}
+		flags := ""
+		if p.OrderLife() != GoodTillCancelled {
+			flags += " " + p.OrderLife().String()
+		}
+		if p.PostOnly {
+			flags += " POST"
+		}
+		if p.ReduceOnly {
+			flags += " REDUCE"
+		}
+		return side + t.Pair.String() + "]:" + t.ExName[0:3] + " " + t.Pair.FormatPrice(p.Price) + " " + fmt.Sprint(math.Round(p.Amount*100)/100) + flags + "`\n"
+	case CancelParams:
+		return fmt.Sprint(t.ExName[0:2], " Cancel order ", t.Pair, p.OrderID)
+	case CancelAllParams:
+		return fmt.Sprint(t.ExName[0:2], " Cancel all orders ", t.Pair)
+	case AmendParams:
+		return fmt.Sprint(t.ExName[0:2], " Amend order ", t.Pair, p.OrderID, " to ", t.Pair.FormatPrice(p.Price), " ", p.Amount)
+	case WaitParams:
+		return fmt.Sprint("Wait for ", p.Duration.Seconds(), " seconds")
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// tradeActionJSON is how a TradeAction is serialised, the params being decoded by the operation
+type tradeActionJSON struct {
+	ExName string          `json:"exName,omitempty"`
+	Op     Operation       `json:"op"`
+	Pair   Pair            `json:"pair"`
+	Params json.RawMessage `json:"params"`
+}
+
+func (t TradeAction) MarshalJSON() ([]byte, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	params, err := json.Marshal(t.Params)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tradeActionJSON{ExName: t.ExName, Op: t.Op, Pair: t.Pair, Params: params})
+}
+
+func (t *TradeAction) UnmarshalJSON(data []byte) error {
+	var tj tradeActionJSON
+	if err := json.Unmarshal(data, &tj); err != nil {
+		return err
+	}
+	var params ActionParams
+	var err error
+	switch tj.Op {
+	case PlaceLimitOrder:
+		var p LimitParams
+		err = json.Unmarshal(tj.Params, &p)
+		params = p
+	case CancelOpenOrder:
+		var p CancelParams
+		err = json.Unmarshal(tj.Params, &p)
+		params = p
+	case CancelAllOpenOrders:
+		params = CancelAllParams{}
+	case AmendOpenOrder:
+		var p AmendParams
+		err = json.Unmarshal(tj.Params, &p)
+		params = p
+	case Wait:
+		var p WaitParams
+		err = json.Unmarshal(tj.Params, &p)
+		params = p
+	}
+	if err != nil {
+		return err
+	}
+	*t = TradeAction{ExName: tj.ExName, Op: tj.Op, Pair: tj.Pair, Params: params}
+	return nil
+}
+
+type TradeActionT struct {
+	Time   time.Time
+	Action TradeAction
+}
+
+func CancelOrderAction(exName string, pair Pair, oid string) TradeAction {
+	return NewTradeAction(exName, pair, CancelParams{OrderID: oid})
+}
+
+func PlaceLimitOrderAction(exName string, pair Pair, price, amount float64) TradeAction {
+	return NewTradeAction(exName, pair, LimitParams{Price: price, Amount: amount, Life: GoodTillCancelled})
+}
+
+// LimitOrderAction places an order with a life and flags, e.g. LimitParams{Price: p, Amount: a, Life: FillOrKill}
+func LimitOrderAction(exName string, pair Pair, params LimitParams) TradeAction {
+	return NewTradeAction(exName, pair, params)
+}
+
+func CancelAllOrdersAction(exName string, pair Pair) TradeAction {
+	return NewTradeAction(exName, pair, CancelAllParams{})
+}
+
+func AmendOrderAction(exName string, pair Pair, oid string, price, amount float64) TradeAction {
+	return NewTradeAction(exName, pair, AmendParams{OrderID: oid, Price: price, Amount: amount})
+}
+
+func WaitAction(nSec int) TradeAction {
+	return NewTradeAction("", Pair{}, WaitParams{Duration: time.Duration(nSec) * time.Second})
+}
+
+// OrderPlacer is implemented by exchanges placing orders with a life and flags natively,
+// PerformActions emulates them on other exchanges
+type OrderPlacer interface {
+	PlaceOrder(pair Pair, params LimitParams) (string, error)
+}
+
+// OrderAmender is implemented by exchanges amending orders natively, returning the id of the amended order.
+// PerformActions cancels and replaces the order on other exchanges
+type OrderAmender interface {
+	AmendOrder(pair Pair, orderID string, price, amount float64) (string, error)
+}
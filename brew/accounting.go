@@ -0,0 +1,309 @@
+package brew
+
+import (
+	. "bean"
+	"bean/db/mds"
+	"bean/exchange"
+	util "bean/utils"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// portfolio accounting of a backtest across exchanges and pairs, marked to a chosen base coin
+
+// PairPnL is the trading PnL attributed to one pair on one exchange, marked to MtMBase
+type PairPnL struct {
+	ExName    string
+	Pair      Pair
+	MtMBase   Coin
+	NumTrades int
+	Volume    float64 // traded amount in pair.Coin
+	Position  float64 // net position in pair.Coin at the end
+	Fee       float64 // commission paid, in MtMBase at the end like the position
+	PnL       float64 // net of commission
+}
+
+// MtMBase returns the coin the result is marked to, the base of the first pair unless set by WithMtMBase
+func (res BackTestResult) MtMBase() Coin {
+	if res.mtmBase != "" {
+		return res.mtmBase
+	}
+	if len(res.pairs) > 0 {
+		return res.pairs[0].Base
+	}
+	return USDT
+}
+
+// WithMtMBase returns the result marked to another coin
+func (res BackTestResult) WithMtMBase(mtmBase Coin) BackTestResult {
+	res.mtmBase = mtmBase
+	return res
+}
+
+// Coins returns all the coins involved in the backtest
+func (res BackTestResult) Coins() Coins {
+	var coins Coins
+	add := func(c Coin) {
+		if c != "" && !util.Contains(coins, c) {
+			coins = append(coins, c)
+		}
+	}
+	for _, p := range res.pairs {
+		add(p.Coin)
+		add(p.Base)
+	}
+	if res.initPort != nil {
+		for _, c := range res.initPort.Coins() {
+			add(c)
+		}
+	}
+	for _, txn := range res.Txn {
+		add(txn.CommissionAsset)
+	}
+	sort.Sort(coins)
+	return coins
+}
+
+// RatesBook builds a reference rate book for every coin involved against mtmBase, from the market
+// transactions of the backtest, crossed through another coin if needed, or from our own trades as a last resort
+func (res BackTestResult) RatesBook(mtmBase Coin) ReferenceRateBook {
+	rates := make(map[Pair]ReferenceRateTS)
+	for p, txn := range res.market {
+		rates[p] = RefRatesFromTxn(txn).Sort()
+	}
+	// fall back to our own trades where there is no market data
+	own := make(map[Pair]bool)
+	for _, txn := range res.Txn {
+		if _, exist := res.market[txn.Pair]; !exist {
+			rates[txn.Pair] = append(rates[txn.Pair], ReferenceRate{Time: txn.TimeStamp, Price: txn.Price})
+			own[txn.Pair] = true
+		}
+	}
+	// trades of several exchanges are not in time order
+	for p := range own {
+		rates[p] = rates[p].Sort()
+	}
+
+	ratesbook := make(ReferenceRateBook)
+	for _, c := range res.Coins() {
+		if c == mtmBase {
+			continue
+		}
+		pair := Pair{Coin: c, Base: mtmBase}
+		if ts, ok := rateTS(c, mtmBase, rates); ok {
+			ratesbook[pair] = ts
+			continue
+		}
+		if ts, ok := crossRateTS(c, mtmBase, rates); ok {
+			ratesbook[pair] = ts
+			continue
+		}
+		fmt.Println("no reference rate for", pair)
+	}
+	return ratesbook
+}
+
+// rateTS returns the rates of c in m, directly or inverted
+func rateTS(c, m Coin, rates map[Pair]ReferenceRateTS) (ReferenceRateTS, bool) {
+	if ts, ok := rates[Pair{Coin: c, Base: m}]; ok && len(ts) > 0 {
+		return ts, true
+	}
+	if ts, ok := rates[Pair{Coin: m, Base: c}]; ok && len(ts) > 0 {
+		inv := make(ReferenceRateTS, 0, len(ts))
+		for _, r := range ts {
+			if r.Price != 0 {
+				inv = append(inv, ReferenceRate{Time: r.Time, Price: 1.0 / r.Price})
+			}
+		}
+		return inv, len(inv) > 0
+	}
+	return nil, false
+}
+
+// crossRateTS returns the rates of c in m through an intermediate coin, the first one by pair name that works
+// so that the rates do not depend on the map order
+func crossRateTS(c, m Coin, rates map[Pair]ReferenceRateTS) (ReferenceRateTS, bool) {
+	pairs := make([]Pair, 0, len(rates))
+	for p := range rates {
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].String() < pairs[j].String() })
+	for _, p := range pairs {
+		var x Coin
+		if p.Coin == c {
+			x = p.Base
+		} else if p.Base == c {
+			x = p.Coin
+		} else {
+			continue
+		}
+		cx, ok1 := rateTS(c, x, rates)
+		xm, ok2 := rateTS(x, m, rates)
+		if ok1 && ok2 {
+			book := ReferenceRateBook{Pair{Coin: x, Base: m}: xm}
+			cross := make(ReferenceRateTS, len(cx))
+			for i, r := range cx {
+				cross[i] = ReferenceRate{Time: r.Time, Price: r.Price * LookupRate(Pair{Coin: x, Base: m}, r.Time, book)}
+			}
+			return cross, true
+		}
+	}
+	return nil, false
+}
+
+// loadRates returns the market transactions of the coins that the pairs traded on exSims do not price, e.g. of the
+// initial portfolio, against the bases of the pairs, from the source of the backtest. Commission is paid in the
+// coins of the pairs, so the rates can be loaded once before simulating and shared by the results of all the runs,
+// which then do not query market data when evaluated
+func (bt BackTest) loadRates(exSims []exchange.Simulator, pairs []Pair, start, end time.Time, initPort Portfolio) map[Pair]Transactions {
+	rates := make(map[Pair]Transactions)
+	priced := make(map[Coin]bool)
+	var coins Coins
+	add := func(c Coin) {
+		if c != "" && !util.Contains(coins, c) {
+			coins = append(coins, c)
+		}
+	}
+	var bases Coins
+	for _, p := range pairs {
+		for i := range exSims {
+			if len(exSims[i].Transactions(p)) > 0 {
+				priced[p.Coin] = true
+				priced[p.Base] = true
+			}
+		}
+		add(p.Coin)
+		add(p.Base)
+		if !util.Contains(bases, p.Base) {
+			bases = append(bases, p.Base)
+		}
+	}
+	if initPort != nil {
+		for _, c := range initPort.Coins() {
+			add(c)
+		}
+	}
+	var missing Coins
+	for _, c := range coins {
+		if !priced[c] {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) == 0 {
+		return rates
+	}
+	src := bt.source
+	if src == nil {
+		cache := mds.NewCache(mds.CacheDir(), nil)
+		defer cache.Close()
+		src = cache
+	}
+	exNames := make([]string, 0, len(exSims))
+	for i := range exSims {
+		exNames = append(exNames, exSims[i].Name())
+	}
+	sort.Strings(exNames)
+	for _, c := range missing {
+		for _, base := range bases {
+			pair := Pair{Coin: c, Base: base}
+			for _, exName := range exNames {
+				txn, err := src.GetTransactions2(exName, pair, start, end)
+				if err == nil && len(txn) > 0 {
+					rates[pair] = txn
+					break
+				}
+			}
+		}
+	}
+	return rates
+}
+
+// ExchangeSnapshots returns the portfolio of each exchange over time, starting from the initial portfolio
+func (res BackTestResult) ExchangeSnapshots() map[string]SnapshotTS {
+	snaps := make(map[string]SnapshotTS)
+	for exName, txn := range res.ExTxn {
+		snaps[exName] = GenerateSnapshotTS(txn, res.initPortfolio())
+	}
+	return snaps
+}
+
+// ExchangePerformance returns the value of the portfolio of each exchange over time, marked to mtmBase
+func (res BackTestResult) ExchangePerformance(mtmBase Coin) map[string]PerformanceTS {
+	ratesbook := res.RatesBook(mtmBase)
+	perfs := make(map[string]PerformanceTS)
+	for exName, snapts := range res.ExchangeSnapshots() {
+		perfs[exName] = EvaluateSnapshotTS(snapts, mtmBase, ratesbook)
+	}
+	return perfs
+}
+
+// Performance returns the value of the aggregate portfolio across all exchanges over time, marked to mtmBase
+func (res BackTestResult) Performance(mtmBase Coin) PerformanceTS {
+	init := NewPortfolio()
+	for range res.ExTxn {
+		init = init.Add(res.initPortfolio())
+	}
+	snapts := GenerateSnapshotTS(append(Transactions{}, res.Txn...), init)
+	return EvaluateSnapshotTS(snapts, mtmBase, res.RatesBook(mtmBase))
+}
+
+// PairPnL attributes the trading PnL to each pair on each exchange, marked to mtmBase at the end of the backtest.
+// Commissions are marked at the end too, as the coins they are paid in, so that the PnLs add up to the portfolio's
+func (res BackTestResult) PairPnL(mtmBase Coin) []PairPnL {
+	ratesbook := res.RatesBook(mtmBase)
+	rate := func(c Coin, t time.Time) float64 {
+		if c == mtmBase {
+			return 1.0
+		}
+		return LookupRate(Pair{Coin: c, Base: mtmBase}, t, ratesbook)
+	}
+	var pnls []PairPnL
+	exNames := make([]string, 0, len(res.ExTxn))
+	for exName := range res.ExTxn {
+		exNames = append(exNames, exName)
+	}
+	sort.Strings(exNames)
+	for _, exName := range exNames {
+		for _, p := range res.pairs {
+			pnl := PairPnL{ExName: exName, Pair: p, MtMBase: mtmBase}
+			base := 0.0
+			for _, txn := range res.ExTxn[exName] {
+				if txn.Pair != p {
+					continue
+				}
+				pnl.NumTrades++
+				pnl.Volume += math.Abs(txn.Amount)
+				pnl.Position += txn.Amount
+				base -= txn.Amount * txn.Price
+				if txn.Commission != 0 {
+					pnl.Fee += txn.Commission * rate(txn.CommissionAsset, res.end)
+				}
+			}
+			if pnl.NumTrades > 0 {
+				pnl.PnL = pnl.Position*rate(p.Coin, res.end) + base*rate(p.Base, res.end) - pnl.Fee
+			}
+			pnls = append(pnls, pnl)
+		}
+	}
+	return pnls
+}
+
+func (res BackTestResult) initPortfolio() Portfolio {
+	if res.initPort == nil {
+		return NewPortfolio()
+	}
+	return res.initPort.Clone()
+}
+
+// PrintPairPnL prints the PnL attribution by exchange and pair
+func PrintPairPnL(pnls []PairPnL) {
+	total := 0.0
+	for _, p := range pnls {
+		fmt.Printf("%-10s %-10s trades %6d volume %12.4f position %12.4f fee %12.6f PnL %12.6f %s\n",
+			p.ExName, p.Pair.String(), p.NumTrades, p.Volume, p.Position, p.Fee, p.PnL, p.MtMBase)
+		total += p.PnL
+	}
+	fmt.Println("total PnL:", total)
+}
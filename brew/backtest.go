@@ -2,6 +2,7 @@ package brew
 
 import (
 	. "bean"
+	"bean/db/mds"
 	"bean/exchange"
 	"bean/rpc"
 	util "bean/utils"
@@ -15,16 +16,25 @@ import (
 
 // BackTest data type
 type BackTest struct {
-	dbhost string
-	dbport string
+	dbhost    string
+	dbport    string
+	fillModel exchange.FillModel
+	latency   map[string]exchange.Latency // one way latencies by exchange name
+	source    mds.Source                  // market data, MDS through the local cache if nil
+	funding   FundingRates                // accrued by the simulators in place of those of the source, if set
 }
 
 type BackTestResult struct {
 	Txn            []Transaction
-	Orders         []OrderBookTS // my order book at any point in time
+	ExTxn          map[string]Transactions // my transactions by exchange name
+	Orders         []OrderBookTS           // my order book at any point in time
+	FillModel      string                  // name of the fill model used in the simulation
 	start, end     time.Time
 	pairs          []Pair
 	dbhost, dbport string
+	initPort       Portfolio             // initial portfolio of each exchange
+	market         map[Pair]Transactions // market transactions, used as reference rates
+	mtmBase        Coin
 }
 
 func NewBackTest(dbhost, dbport string) BackTest {
@@ -34,6 +44,85 @@ func NewBackTest(dbhost, dbport string) BackTest {
 	}
 }
 
+// NewBackTestFrom creates a backtest reading its market data from src, e.g. a mds.FileSource
+func NewBackTestFrom(src mds.Source) BackTest {
+	return BackTest{source: src}
+}
+
+// SetFillModel sets the fill model of the simulators, so that the same strategy can be run under
+// optimistic and pessimistic fill assumptions. The simulator default is used if not set
+func (bt *BackTest) SetFillModel(fm exchange.FillModel) {
+	bt.fillModel = fm
+}
+
+// SetLatency sets the order entry, ack and cancel latencies of the simulator for exchange exName
+func (bt *BackTest) SetLatency(exName string, l exchange.Latency) {
+	if bt.latency == nil {
+		bt.latency = make(map[string]exchange.Latency)
+	}
+	bt.latency[exName] = l
+}
+
+// SetFundingRates sets the funding rates accrued by the perpetual positions of the simulators, in place of those
+// of the source, e.g. for a mds.FileSource which has none
+func (bt *BackTest) SetFundingRates(rates FundingRates) {
+	bt.funding = rates
+}
+
+// newSimulator loads the market data of exName and sets up the simulator with the fill model and latency of the backtest
+func (bt BackTest) newSimulator(exName string, pairs []Pair, start, end time.Time, initPort Portfolio) exchange.Simulator {
+	// each exchange holds its own copy of the initial portfolio
+	var sim exchange.Simulator
+	if bt.source != nil {
+		sim = exchange.NewSimulatorFrom(bt.source, exName, pairs, start, end, initPort.Clone())
+	} else {
+		sim = exchange.NewSimulator(exName, pairs, bt.dbhost, bt.dbport, start, end, initPort.Clone())
+	}
+	if bt.fillModel != nil {
+		sim.SetFillModel(bt.fillModel)
+	}
+	sim.SetLatency(bt.latency[exName])
+	if bt.funding != nil {
+		sim.SetFundingRates(bt.funding)
+	}
+	return sim
+}
+
+// newResult collects my transactions from the simulators, along with the market transactions for mark to market
+// and the rates loaded by loadRates for the coins they do not price
+func (bt BackTest) newResult(exSims []exchange.Simulator, pairs []Pair, start, end time.Time, initPort Portfolio, rates map[Pair]Transactions) BackTestResult {
+	res := BackTestResult{
+		start:    start,
+		end:      end,
+		pairs:    pairs,
+		dbhost:   bt.dbhost,
+		dbport:   bt.dbport,
+		initPort: initPort.Clone(),
+		ExTxn:    make(map[string]Transactions),
+		market:   make(map[Pair]Transactions),
+	}
+	if len(exSims) > 0 {
+		res.FillModel = exSims[0].FillModel().Name()
+	}
+	for i := range exSims {
+		txn := exSims[i].GetTrades()
+		res.ExTxn[exSims[i].Name()] = append(Transactions{}, txn...)
+		res.Txn = append(res.Txn, txn...)
+		for _, p := range pairs {
+			res.market[p] = append(res.market[p], exSims[i].Transactions(p)...)
+		}
+	}
+	for p := range res.market {
+		res.market[p].Sort()
+	}
+	for p, txn := range rates {
+		if _, exist := res.market[p]; !exist {
+			res.market[p] = txn
+		}
+	}
+	return res
+}
+
 func (bt BackTest) Simulate(strat Strat, start, end time.Time, initPort Portfolio) BackTestResult {
 	// fetch historical data ///////////////////////////////////////////
 	exNames := strat.GetExchangeNames()
@@ -41,29 +130,28 @@ func (bt BackTest) Simulate(strat Strat, start, end time.Time, initPort Portfoli
 	exSims := make([]exchange.Simulator, len(exNames))
 	exs := make(map[string]Exchange)
 	for i, exName := range exNames {
-		exSims[i] = exchange.NewSimulator(exName, pairs, bt.dbhost, bt.dbport, start, end, initPort)
+		exSims[i] = bt.newSimulator(exName, pairs, start, end, initPort)
 		exs[exName] = &exSims[i]
 	}
 	fmt.Println("ex constructed")
 
-	// from start to end, call strat's Work
+	runTicks(strat, exSims, exs, start, end)
+
+	fmt.Println("done simulation")
+	return bt.newResult(exSims, pairs, start, end, initPort, bt.loadRates(exSims, pairs, start, end, initPort))
+}
+
+// runTicks calls strat's Grind at each tick from start to end and performs its actions on the simulators
+func runTicks(strat Strat, exSims []exchange.Simulator, exs map[string]Exchange, start, end time.Time) {
 	for t := start; t.Before(end); t = t.Add(strat.GetTick()) {
 		// update now in exSIm
-		for i, _ := range exNames {
+		for i := range exSims {
 			exSims[i].SetTime(t)
 		}
 		actions := strat.Grind(exs)
 		// Perform actions
 		PerformActions(&exs, actions)
 	}
-
-	fmt.Println("done simulation")
-	result := BackTestResult{start: start, end: end, pairs: pairs, dbhost: bt.dbhost, dbport: bt.dbport}
-	for i, _ := range exNames {
-		txn := exSims[i].GetTrades()
-		result.Txn = append(result.Txn, txn...)
-	}
-	return result
 }
 
 func (bt BackTest) SimulateN(strats []Strat, start, end time.Time, initPort Portfolio) []BackTestResult {
@@ -89,10 +177,19 @@ func (bt BackTest) SimulateN(strats []Strat, start, end time.Time, initPort Port
 	exSims := make([]exchange.Simulator, len(exNames))
 	exs := make(map[string]Exchange)
 	for i, exName := range exNames {
-		exSims[i] = exchange.NewSimulator(exName, pairs[exName], bt.dbhost, bt.dbport, start, end, initPort)
+		exSims[i] = bt.newSimulator(exName, pairs[exName], start, end, initPort)
 		exs[exName] = &exSims[i]
 	}
 	fmt.Println("ex constructed")
+	var allPairs []Pair
+	for _, exName := range exNames {
+		for _, p := range pairs[exName] {
+			if !util.Contains(allPairs, p) {
+				allPairs = append(allPairs, p)
+			}
+		}
+	}
+	rates := bt.loadRates(exSims, allPairs, start, end, initPort)
 	// now we can simulate each strategy
 	result := make([]BackTestResult, len(strats))
 	for k, strat := range strats {
@@ -107,14 +204,10 @@ func (bt BackTest) SimulateN(strats []Strat, start, end time.Time, initPort Port
 			PerformActions(&exs, actions)
 		}
 
-		result[k] = BackTestResult{start: start, end: end, pairs: strat.GetPairs(), dbhost: bt.dbhost, dbport: bt.dbport}
-		for nm, _ := range exNames {
-			txn := exSims[nm].GetTrades()
-			result[k].Txn = append(result[k].Txn, txn...)
-		}
+		result[k] = bt.newResult(exSims, strat.GetPairs(), start, end, initPort, rates)
 
 		for i, _ := range exs {
-			exs[i].(*exchange.Simulator).Reset(start, initPort)
+			exs[i].(*exchange.Simulator).Reset(start, initPort.Clone())
 		}
 
 		fmt.Println("done simulation for ", strat.Name(), strat.FormatParams(), len(result[k].Txn))
@@ -122,40 +215,32 @@ func (bt BackTest) SimulateN(strats []Strat, start, end time.Time, initPort Port
 	return result
 }
 
-// TODO: too ad-hoc, make it generic
+// Show prints the performance of the backtest marked to MtMBase(), by exchange and pair and in aggregate
 func (res BackTestResult) Show() TradestatPort {
-	//	p := NewPortfolio()
-	// mds := bean.NewRPCMDSConnC("tcp", res.dbhost+":"+res.dbport)
-	ratesbook := make(ReferenceRateBook)
-
-	// FIXME: think about how to show multi pair result
 	var stat TradestatPort
 	if len(res.pairs) > 0 {
-		p := res.pairs[0]
-		//		txn, _ := mds.GetTransactions2(NameFcoin, p, res.start, res.end)
-		ratesbook[p] = RefRatesFromTxn(res.Txn)
-		//		snapts.Print()
-		//		perfts.Print()
-
-		stat = *Tradestat(p.Base, res.Txn, NewPortfolio(), ratesbook)
-		ssTS := GenerateSnapshotTS(res.Txn, NewPortfolio())
-		maxPos := 0.0
-		maxNeg := 0.0
-		for _, ss := range ssTS {
-			maxPos = math.Max(maxPos, ss.Port.Balance(p.Coin))
-			maxNeg = math.Min(maxNeg, ss.Port.Balance(p.Coin))
+		mtmBase := res.MtMBase()
+		stat = *Tradestat(mtmBase, res.Txn, NewPortfolio(), res.RatesBook(mtmBase))
+		for exName, ssTS := range res.ExchangeSnapshots() {
+			for _, p := range res.pairs {
+				maxPos := 0.0
+				maxNeg := 0.0
+				init := res.initPortfolio().Balance(p.Coin)
+				for _, ss := range ssTS {
+					maxPos = math.Max(maxPos, ss.Port.Balance(p.Coin)-init)
+					maxNeg = math.Min(maxNeg, ss.Port.Balance(p.Coin)-init)
+				}
+				fmt.Println(exName, p, "max position", maxPos, maxNeg)
+			}
 		}
-		fmt.Println("max position", maxPos, maxNeg)
+		PrintPairPnL(res.PairPnL(mtmBase))
 		stat.Print()
 	}
 	return stat
 }
 
 func (res BackTestResult) Graph() {
-	p := NewPortfolio()
-	snapts := GenerateSnapshotTS(res.Txn, p)
-	ratesbook := make(ReferenceRateBook)
-	perfts := EvaluateSnapshotTS(snapts, res.pairs[0].Base, ratesbook)
+	perfts := res.Performance(res.MtMBase())
 
 	xs := make([]time.Time, len(perfts))
 	ys := make([]float64, len(perfts))
@@ -217,15 +302,8 @@ func (res BackTestResult) Evaluate(mtmBase Coin) {
 	}
 }
 
-// quick evaluation for single pair transactions
+// quick evaluation of the trading stats of all pairs, marked to MtMBase()
 func (res BackTestResult) QuickEval() TradestatPort {
-	if len(res.pairs) == 1 {
-		ratesbook := make(ReferenceRateBook)
-		ratesbook[res.pairs[0]] = RefRatesFromTxn(res.Txn)
-		stats := *Tradestat(res.pairs[0].Base, res.Txn, NewPortfolio(), ratesbook)
-		return stats
-	} else {
-		panic("QuickEval supports single pair only")
-	}
-
+	mtmBase := res.MtMBase()
+	return *Tradestat(mtmBase, res.Txn, NewPortfolio(), res.RatesBook(mtmBase))
 }
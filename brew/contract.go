@@ -0,0 +1,29 @@
+package brew
+
+import (
+	. "bean"
+	"bean/exchange"
+	"time"
+)
+
+// SimulateContracts runs strat every tick from start to end on a contract simulator, which it trades through an
+// exchange.ContractExchange with the instruments keyed by the pair they are traded as. The fill model and the
+// latency of the backtest apply, and its funding rates if set. It returns the simulated trades
+func (bt BackTest) SimulateContracts(strat Strat, sim *exchange.ContractSimulator, instruments map[Pair]string, start, end time.Time) ContractTXNs {
+	if bt.fillModel != nil {
+		sim.SetFillModel(bt.fillModel)
+	}
+	if l, ok := bt.latency[sim.Name()]; ok {
+		sim.SetLatency(l)
+	}
+	if bt.funding != nil {
+		sim.SetFundingRates(bt.funding)
+	}
+	exs := map[string]Exchange{sim.Name(): exchange.NewContractExchange(sim, instruments)}
+	for t := start; t.Before(end); t = t.Add(strat.GetTick()) {
+		sim.SetTime(t)
+		actions := strat.Grind(exs)
+		PerformActions(&exs, actions)
+	}
+	return sim.GetTrades()
+}
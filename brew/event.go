@@ -0,0 +1,152 @@
+package brew
+
+import (
+	. "bean"
+	"bean/exchange"
+	"container/heap"
+	"fmt"
+	"time"
+)
+
+// event driven backtest: instead of stepping a fixed tick, the orderbook and transaction histories of
+// all exchanges and pairs are merged into one time ordered event queue, and the strategy is called on
+// every event, or on the timers it registers
+
+type EventType int
+
+const (
+	BookEvent  EventType = 0 // a new orderbook snapshot
+	TradeEvent EventType = 1 // a market transaction
+	TimerEvent EventType = 2 // a timer registered by the strategy
+)
+
+// Event is a market data update or a timer
+type Event struct {
+	Time   time.Time
+	Type   EventType
+	ExName string
+	Pair   Pair
+	Book   *OrderBookT // set for BookEvent
+	Txn    Transaction // set for TradeEvent
+	Timer  string      // name of the timer for TimerEvent
+	seq    int         // keeps events at the same time in the order they were queued
+}
+
+// Scheduler allows a strategy to register timers in the event driven backtest
+type Scheduler interface {
+	Now() time.Time
+	After(d time.Duration, name string) // fire a TimerEvent named name after d
+}
+
+// EventStrat is a strategy reacting to individual market events, OnEvent is called for every event
+type EventStrat interface {
+	Strat
+	OnEvent(ev Event, exs map[string]Exchange, sched Scheduler) []TradeAction
+}
+
+// the name of the timer driving strategies which only implement Grind
+const tickTimer = "TICK"
+
+type eventQueue struct {
+	events []*Event
+	now    time.Time
+	end    time.Time
+	seq    int
+}
+
+func (q eventQueue) Len() int { return len(q.events) }
+func (q eventQueue) Less(i, j int) bool {
+	if q.events[i].Time.Equal(q.events[j].Time) {
+		return q.events[i].seq < q.events[j].seq
+	}
+	return q.events[i].Time.Before(q.events[j].Time)
+}
+func (q eventQueue) Swap(i, j int) { q.events[i], q.events[j] = q.events[j], q.events[i] }
+func (q *eventQueue) Push(x interface{}) {
+	q.events = append(q.events, x.(*Event))
+}
+func (q *eventQueue) Pop() interface{} {
+	n := len(q.events)
+	ev := q.events[n-1]
+	q.events = q.events[:n-1]
+	return ev
+}
+
+func (q *eventQueue) push(ev Event) {
+	ev.seq = q.seq
+	q.seq++
+	heap.Push(q, &ev)
+}
+
+func (q *eventQueue) Now() time.Time {
+	return q.now
+}
+
+func (q *eventQueue) After(d time.Duration, name string) {
+	t := q.now.Add(d)
+	if t.Before(q.end) {
+		q.push(Event{Time: t, Type: TimerEvent, Timer: name})
+	}
+}
+
+// SimulateEvents runs strat over the merged orderbook and transaction events of all its exchanges and pairs.
+// An EventStrat is called on every event, any other Strat has Grind called on a timer every GetTick()
+func (bt BackTest) SimulateEvents(strat Strat, start, end time.Time, initPort Portfolio) BackTestResult {
+	exNames := strat.GetExchangeNames()
+	pairs := strat.GetPairs()
+	exSims := make([]exchange.Simulator, len(exNames))
+	exs := make(map[string]Exchange)
+	for i, exName := range exNames {
+		exSims[i] = bt.newSimulator(exName, pairs, start, end, initPort)
+		exs[exName] = &exSims[i]
+	}
+	fmt.Println("ex constructed")
+
+	// merge the market data into one queue
+	q := &eventQueue{now: start, end: end}
+	for i, exName := range exNames {
+		for _, p := range pairs {
+			obts := exSims[i].OrderBookTS(p)
+			for k := range obts {
+				q.push(Event{Time: obts[k].Time, Type: BookEvent, ExName: exName, Pair: p, Book: &obts[k]})
+			}
+			for _, txn := range exSims[i].Transactions(p) {
+				q.push(Event{Time: txn.TimeStamp, Type: TradeEvent, ExName: exName, Pair: p, Txn: txn})
+			}
+		}
+	}
+	estrat, isEventStrat := strat.(EventStrat)
+	if !isEventStrat {
+		q.push(Event{Time: start, Type: TimerEvent, Timer: tickTimer})
+	}
+
+	stepped := false
+	for q.Len() > 0 {
+		ev := heap.Pop(q).(*Event)
+		if ev.Time.Before(start) {
+			continue
+		}
+		if !ev.Time.Before(end) {
+			break
+		}
+		// the simulators only move on once per timestamp, events at the same time share it
+		if ev.Time.After(q.now) || !stepped {
+			for i := range exSims {
+				exSims[i].SetTime(ev.Time)
+			}
+			stepped = true
+		}
+		q.now = ev.Time
+		var actions []TradeAction
+		if isEventStrat {
+			actions = estrat.OnEvent(*ev, exs, q)
+		} else if ev.Type == TimerEvent && ev.Timer == tickTimer {
+			actions = strat.Grind(exs)
+			q.After(strat.GetTick(), tickTimer)
+		}
+		PerformActions(&exs, actions)
+	}
+
+	fmt.Println("done simulation")
+	return bt.newResult(exSims, pairs, start, end, initPort, bt.loadRates(exSims, pairs, start, end, initPort))
+}
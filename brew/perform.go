@@ -18,29 +18,73 @@ func PerformActions(exs *(map[string]Exchange), actions []TradeAction, sep ...ti
 		if len(sep) > 0 {
 			time.Sleep(sep[0])
 		}
-		switch act.Op {
-		case PlaceLimitOrder:
+		ex := (*exs)[act.ExName]
+		switch p := act.Params.(type) {
+		case LimitParams:
 			// place order,
-			oid, _ := (*exs)[act.ExName].PlaceLimitOrder(
-				act.Pair,
-				act.Params["price"].(float64),
-				act.Params["amount"].(float64),
-			)
-			(*exs)[act.ExName].TrackOrderID(act.Pair, oid)
+			oid, err := placeOrder(ex, act.Pair, p)
+			if err != nil || oid == "" {
+				break
+			}
+			ex.TrackOrderID(act.Pair, oid)
 			placed = append(placed, ExNameWithOID{act.ExName, act.Pair, oid, time.Now()})
-			break
-		case CancelOpenOrder:
-			oid := act.Params["orderid"].(string)
-			(*exs)[act.ExName].CancelOrder(
-				act.Pair,
-				oid,
-			)
-			cancelled = append(cancelled, ExNameWithOID{act.ExName, act.Pair, oid, time.Now()})
-			break
-		case Wait:
-			time.Sleep(time.Duration(act.Params["time"].(int)) * time.Second)
-			break
+			if p.OrderLife() != GoodTillCancelled {
+				if _, native := ex.(OrderPlacer); !native {
+					// emulated, whatever was not filled on arrival is cancelled
+					ex.CancelOrder(act.Pair, oid)
+					cancelled = append(cancelled, ExNameWithOID{act.ExName, act.Pair, oid, time.Now()})
+				}
+			}
+		case CancelParams:
+			ex.CancelOrder(act.Pair, p.OrderID)
+			cancelled = append(cancelled, ExNameWithOID{act.ExName, act.Pair, p.OrderID, time.Now()})
+		case CancelAllParams:
+			for _, o := range ex.GetMyOrders(act.Pair) {
+				cancelled = append(cancelled, ExNameWithOID{act.ExName, act.Pair, o.OrderID, time.Now()})
+			}
+			ex.CancelAllOrders(act.Pair)
+		case AmendParams:
+			if am, ok := ex.(OrderAmender); ok {
+				oid, err := am.AmendOrder(act.Pair, p.OrderID, p.Price, p.Amount)
+				if err == nil && oid != p.OrderID {
+					ex.TrackOrderID(act.Pair, oid)
+					cancelled = append(cancelled, ExNameWithOID{act.ExName, act.Pair, p.OrderID, time.Now()})
+					placed = append(placed, ExNameWithOID{act.ExName, act.Pair, oid, time.Now()})
+				}
+				break
+			}
+			// cancel and replace
+			ex.CancelOrder(act.Pair, p.OrderID)
+			cancelled = append(cancelled, ExNameWithOID{act.ExName, act.Pair, p.OrderID, time.Now()})
+			oid, err := ex.PlaceLimitOrder(act.Pair, p.Price, p.Amount)
+			if err == nil {
+				ex.TrackOrderID(act.Pair, oid)
+				placed = append(placed, ExNameWithOID{act.ExName, act.Pair, oid, time.Now()})
+			}
+		case WaitParams:
+			time.Sleep(p.Duration)
 		}
 	}
 	return
 }
+
+// placeOrder places a limit order, natively on an OrderPlacer, otherwise its flags are checked with
+// LimitParams.Check against the orderbook and the coin balance
+func placeOrder(ex Exchange, pair Pair, p LimitParams) (string, error) {
+	if op, ok := ex.(OrderPlacer); ok {
+		return op.PlaceOrder(pair, p)
+	}
+	position := 0.0
+	if p.ReduceOnly {
+		position = ex.GetPortfolio().Balance(pair.Coin)
+	}
+	var ob OrderBook
+	if p.PostOnly || p.OrderLife() == FillOrKill {
+		ob = ex.GetOrderBook(pair)
+	}
+	amount, err := p.Check(ob, position)
+	if err != nil {
+		return "", err
+	}
+	return ex.PlaceLimitOrder(pair, p.Price, amount)
+}
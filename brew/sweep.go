@@ -0,0 +1,259 @@
+package brew
+
+import (
+	. "bean"
+	"bean/exchange"
+	util "bean/utils"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Params is one set of strategy parameters, by name
+type Params map[string]float64
+
+// String formats the params sorted by name, e.g. for reporting
+func (p Params) String() string {
+	names := make([]string, 0, len(p))
+	for k := range p {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	strs := make([]string, len(names))
+	for i, k := range names {
+		strs[i] = fmt.Sprintf("%s=%v", k, p[k])
+	}
+	return strings.Join(strs, " ")
+}
+
+// StratFactory builds a fresh strategy for a set of params.
+// Each simulation gets its own strategy, so strategies with state can be swept concurrently
+type StratFactory func(params Params) Strat
+
+// ParamGrid lists the values to try for each param, the sweep runs over all the combinations
+type ParamGrid map[string][]float64
+
+// Params returns the cartesian product of the grid, in a deterministic order
+func (g ParamGrid) Params() []Params {
+	names := make([]string, 0, len(g))
+	for k := range g {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	res := []Params{Params{}}
+	for _, k := range names {
+		var next []Params
+		for _, p := range res {
+			for _, v := range g[k] {
+				q := Params{k: v}
+				for n, x := range p {
+					q[n] = x
+				}
+				next = append(next, q)
+			}
+		}
+		res = next
+	}
+	return res
+}
+
+// ParamRange is the [Min, Max] range of a param in a random search
+type ParamRange struct {
+	Min, Max float64
+}
+
+// ParamSpace gives the range of each param for a random search
+type ParamSpace map[string]ParamRange
+
+// Sample draws n sets of params uniformly from the space. The same seed gives the same samples
+func (s ParamSpace) Sample(n int, seed int64) []Params {
+	names := make([]string, 0, len(s))
+	for k := range s {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	rng := rand.New(rand.NewSource(seed))
+	res := make([]Params, n)
+	for i := range res {
+		res[i] = make(Params)
+		for _, k := range names {
+			r := s[k]
+			res[i][k] = r.Min + rng.Float64()*(r.Max-r.Min)
+		}
+	}
+	return res
+}
+
+// SweepMetric is the TradestatPort measure used to rank the results of a sweep
+type SweepMetric string
+
+const (
+	BySharpe      SweepMetric = "Sharpe"
+	ByMaxDrawdown SweepMetric = "MaxDrawdown"
+	ByNetPnL      SweepMetric = "NetPnL"
+)
+
+// better returns true if a is better than b by the metric, NaNs rank last
+func (m SweepMetric) better(a, b PortPerformanceStat) bool {
+	var x, y float64
+	switch m {
+	case ByMaxDrawdown:
+		// smaller drawdown is better
+		x, y = -a.MaxDrawdown, -b.MaxDrawdown
+	case ByNetPnL:
+		x, y = a.NetPnL, b.NetPnL
+	default:
+		x, y = a.Sharpe, b.Sharpe
+	}
+	if math.IsNaN(y) {
+		return !math.IsNaN(x)
+	}
+	return x > y
+}
+
+// SweepResult is the backtest result and performance of one set of params
+type SweepResult struct {
+	Params Params
+	Result BackTestResult
+	Stat   PortPerformanceStat
+}
+
+// RankResults sorts the results best first by the metric
+func RankResults(results []SweepResult, metric SweepMetric) []SweepResult {
+	sort.SliceStable(results, func(i, j int) bool { return metric.better(results[i].Stat, results[j].Stat) })
+	return results
+}
+
+// portStat evaluates the result, a backtest without any trade has no stat
+func portStat(res BackTestResult) PortPerformanceStat {
+	if len(res.Txn) == 0 {
+		nan := math.NaN()
+		return PortPerformanceStat{NetPnL: 0, AvgPnL: nan, AnnReturn: nan, MaxDrawdown: nan, Sharpe: nan}
+	}
+	return res.QuickEval().PortStat()
+}
+
+// loadSims fetches the historical data once for all strategies built from params, along with the rates of the coins
+// it does not price
+func (bt BackTest) loadSims(factory StratFactory, params []Params, start, end time.Time, initPort Portfolio) ([]exchange.Simulator, map[Pair]Transactions) {
+	var exNames []string
+	pairs := make(map[string]([]Pair))
+	for _, p := range params {
+		s := factory(p)
+		for _, n := range s.GetExchangeNames() {
+			if !util.Contains(exNames, n) {
+				exNames = append(exNames, n)
+			}
+			for _, pair := range s.GetPairs() {
+				if !util.Contains(pairs[n], pair) {
+					pairs[n] = append(pairs[n], pair)
+				}
+			}
+		}
+	}
+	exSims := make([]exchange.Simulator, len(exNames))
+	var allPairs []Pair
+	for i, exName := range exNames {
+		exSims[i] = bt.newSimulator(exName, pairs[exName], start, end, initPort)
+		for _, p := range pairs[exName] {
+			if !util.Contains(allPairs, p) {
+				allPairs = append(allPairs, p)
+			}
+		}
+	}
+	return exSims, bt.loadRates(exSims, allPairs, start, end, initPort)
+}
+
+// sweep runs a simulation for each set of params from start to end, using up to workers goroutines.
+// Each simulation runs on its own clones of the loaded simulators and shares the loaded rates
+func (bt BackTest) sweep(sims []exchange.Simulator, rates map[Pair]Transactions, factory StratFactory, params []Params, start, end time.Time, initPort Portfolio, workers int) []SweepResult {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	results := make([]SweepResult, len(params))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				strat := factory(params[k])
+				exNames := strat.GetExchangeNames()
+				exSims := make([]exchange.Simulator, 0, len(exNames))
+				for _, sim := range sims {
+					if util.Contains(exNames, sim.Name()) {
+						exSims = append(exSims, sim.Clone(start, initPort.Clone()))
+					}
+				}
+				exs := make(map[string]Exchange)
+				for i := range exSims {
+					exs[exSims[i].Name()] = &exSims[i]
+				}
+				runTicks(strat, exSims, exs, start, end)
+				res := bt.newResult(exSims, strat.GetPairs(), start, end, initPort, rates)
+				results[k] = SweepResult{Params: params[k], Result: res, Stat: portStat(res)}
+			}
+		}()
+	}
+	for k := range params {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// Sweep loads the historical data once, then backtests a strategy for every set of params concurrently
+// on up to workers goroutines (all CPUs if workers <= 0). The results are ranked best first by metric
+func (bt BackTest) Sweep(factory StratFactory, params []Params, start, end time.Time, initPort Portfolio, workers int, metric SweepMetric) []SweepResult {
+	sims, rates := bt.loadSims(factory, params, start, end, initPort)
+	fmt.Println("ex constructed")
+	results := bt.sweep(sims, rates, factory, params, start, end, initPort, workers)
+	fmt.Println("done sweep of", len(params), "params")
+	return RankResults(results, metric)
+}
+
+// WalkForwardWindow holds the params chosen in sample and how they performed out of sample
+type WalkForwardWindow struct {
+	InStart   time.Time
+	InEnd     time.Time // also the start of the out of sample period
+	OutEnd    time.Time
+	InSample  []SweepResult // ranked in sample results, InSample[0] has the chosen params
+	OutSample SweepResult   // the chosen params run out of sample
+}
+
+// Best returns the params chosen in sample
+func (w WalkForwardWindow) Best() Params {
+	if len(w.InSample) == 0 {
+		return nil
+	}
+	return w.InSample[0].Params
+}
+
+// WalkForward rolls an inSample window followed by an outSample window from start to end, stepping by outSample.
+// In each window, the params are optimised by metric in sample, and the best ones are then run out of sample.
+// The historical data is loaded once for the whole period
+func (bt BackTest) WalkForward(factory StratFactory, params []Params, start, end time.Time, inSample, outSample time.Duration, initPort Portfolio, workers int, metric SweepMetric) []WalkForwardWindow {
+	if inSample <= 0 || outSample <= 0 {
+		panic("walk forward windows must have positive length")
+	}
+	sims, rates := bt.loadSims(factory, params, start, end, initPort)
+	fmt.Println("ex constructed")
+	var windows []WalkForwardWindow
+	for t := start; !t.Add(inSample + outSample).After(end); t = t.Add(outSample) {
+		w := WalkForwardWindow{InStart: t, InEnd: t.Add(inSample), OutEnd: t.Add(inSample + outSample)}
+		w.InSample = RankResults(bt.sweep(sims, rates, factory, params, w.InStart, w.InEnd, initPort, workers), metric)
+		if len(w.InSample) > 0 {
+			w.OutSample = bt.sweep(sims, rates, factory, []Params{w.Best()}, w.InEnd, w.OutEnd, initPort, 1)[0]
+		}
+		fmt.Println("done walk forward window", w.InStart, w.InEnd, w.OutEnd, w.Best())
+		windows = append(windows, w)
+	}
+	return windows
+}
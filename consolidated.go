@@ -0,0 +1,176 @@
+package bean
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// VenueOrder is a level of a consolidated orderbook, tagged with the exchange it rests on
+type VenueOrder struct {
+	Venue    string
+	Price    float64 // after the taker fee, lower than quoted for bids and higher for asks
+	RawPrice float64 // as quoted on the venue
+	Amount   float64
+}
+
+// ConsolidatedBook merges the orderbooks of a pair on several exchanges. Levels are ranked by their taker fee
+// adjusted price, i.e. what a taker actually receives selling into the bids or pays buying from the asks
+type ConsolidatedBook struct {
+	Pair Pair
+	Bids []VenueOrder // best, i.e. highest, first
+	Asks []VenueOrder // best, i.e. lowest, first
+}
+
+// NewConsolidatedBook merges orderbooks keyed by exchange name, with their taker fees
+func NewConsolidatedBook(pair Pair, books map[string]OrderBook, takerFees map[string]float64) ConsolidatedBook {
+	cb := ConsolidatedBook{Pair: pair}
+	for venue, ob := range books {
+		if ob.OrderBookCore == nil {
+			continue
+		}
+		fee := takerFees[venue]
+		for _, o := range ob.Bids() {
+			cb.Bids = append(cb.Bids, VenueOrder{Venue: venue, Price: o.Price * (1 - fee), RawPrice: o.Price, Amount: o.Amount})
+		}
+		for _, o := range ob.Asks() {
+			cb.Asks = append(cb.Asks, VenueOrder{Venue: venue, Price: o.Price * (1 + fee), RawPrice: o.Price, Amount: o.Amount})
+		}
+	}
+	// ties go to the venue first by name, so that the book does not depend on the map order
+	sort.Slice(cb.Bids, func(i, j int) bool {
+		if cb.Bids[i].Price != cb.Bids[j].Price {
+			return cb.Bids[i].Price > cb.Bids[j].Price
+		}
+		return cb.Bids[i].Venue < cb.Bids[j].Venue
+	})
+	sort.Slice(cb.Asks, func(i, j int) bool {
+		if cb.Asks[i].Price != cb.Asks[j].Price {
+			return cb.Asks[i].Price < cb.Asks[j].Price
+		}
+		return cb.Asks[i].Venue < cb.Asks[j].Venue
+	})
+	return cb
+}
+
+// ConsolidateOrderBooks gets the orderbooks of pair from the exchanges concurrently and merges them, adjusting
+// their prices with GetTakerFee
+func ConsolidateOrderBooks(exs map[string]Exchange, pair Pair) ConsolidatedBook {
+	books := make(map[string]OrderBook, len(exs))
+	fees := make(map[string]float64, len(exs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, ex := range exs {
+		wg.Add(1)
+		go func(name string, ex Exchange) {
+			defer wg.Done()
+			ob := ex.GetOrderBook(pair)
+			fee := ex.GetTakerFee(pair)
+			mu.Lock()
+			books[name] = ob
+			fees[name] = fee
+			mu.Unlock()
+		}(name, ex)
+	}
+	wg.Wait()
+	return NewConsolidatedBook(pair, books, fees)
+}
+
+// BestBid returns the best bid after fees, with a NaN price if there is none
+func (cb ConsolidatedBook) BestBid() VenueOrder {
+	if len(cb.Bids) == 0 {
+		return VenueOrder{Price: math.NaN(), RawPrice: math.NaN()}
+	}
+	return cb.Bids[0]
+}
+
+// BestAsk returns the best ask after fees, with a NaN price if there is none
+func (cb ConsolidatedBook) BestAsk() VenueOrder {
+	if len(cb.Asks) == 0 {
+		return VenueOrder{Price: math.NaN(), RawPrice: math.NaN()}
+	}
+	return cb.Asks[0]
+}
+
+// PriceIn returns the worst fee adjusted bid and ask that need to be hit across the venues in order to execute
+// a requested size, and the total size available at that price, as OrderBook.PriceIn does for a single venue
+func (cb ConsolidatedBook) PriceIn(size float64) (bid, ask, bidSize, askSize float64) {
+	bid, bidSize = cb.BidIn(size)
+	ask, askSize = cb.AskIn(size)
+	return
+}
+
+// BidIn returns the worst fee adjusted bid that needs to be hit in order to fill a target size. If there is
+// insufficient liquidity across the venues then available is the total of the bids
+func (cb ConsolidatedBook) BidIn(size float64) (price, available float64) {
+	return priceInAmount(size, venueLevels(cb.Bids))
+}
+
+// AskIn returns the worst fee adjusted ask that needs to be hit in order to fill a target size. If there is
+// insufficient liquidity across the venues then available is the total of the asks
+func (cb ConsolidatedBook) AskIn(size float64) (price, available float64) {
+	return priceInAmount(size, venueLevels(cb.Asks))
+}
+
+func venueLevels(levels []VenueOrder) []Order {
+	orders := make([]Order, len(levels))
+	for i, o := range levels {
+		orders[i] = Order{Price: o.Price, Amount: o.Amount}
+	}
+	return orders
+}
+
+// SellIn returns the bids to hit, best first, to sell size across the venues, the last one cut to the size left
+func (cb ConsolidatedBook) SellIn(size float64) []VenueOrder {
+	return sweep(cb.Bids, size)
+}
+
+// BuyIn returns the asks to lift, best first, to buy size across the venues, the last one cut to the size left
+func (cb ConsolidatedBook) BuyIn(size float64) []VenueOrder {
+	return sweep(cb.Asks, size)
+}
+
+func sweep(levels []VenueOrder, size float64) []VenueOrder {
+	var taken []VenueOrder
+	for _, o := range levels {
+		if size <= 0 {
+			break
+		}
+		o.Amount = math.Min(o.Amount, size)
+		size -= o.Amount
+		taken = append(taken, o)
+	}
+	return taken
+}
+
+// AveragePrice returns the amount weighted fee adjusted price of levels, e.g. from SellIn or BuyIn, and their total
+func AveragePrice(levels []VenueOrder) (price, amount float64) {
+	value := 0.0
+	for _, o := range levels {
+		value += o.Price * o.Amount
+		amount += o.Amount
+	}
+	if amount == 0 {
+		return math.NaN(), 0.0
+	}
+	return value / amount, amount
+}
+
+// ByVenue sums the amounts of levels by venue, e.g. to split an order from SellIn or BuyIn across exchanges
+func ByVenue(levels []VenueOrder) map[string]float64 {
+	amounts := make(map[string]float64)
+	for _, o := range levels {
+		amounts[o.Venue] += o.Amount
+	}
+	return amounts
+}
+
+// ShowBrief describes the best fee adjusted levels and their venues
+func (cb ConsolidatedBook) ShowBrief() string {
+	if len(cb.Bids) == 0 || len(cb.Asks) == 0 {
+		return "empty consolidated orderbook"
+	}
+	bid, ask := cb.BestBid(), cb.BestAsk()
+	return fmt.Sprint("levels:", len(cb.Bids)+len(cb.Asks), " bestBid:", bid.Price, "@", bid.Venue, " bestAsk:", ask.Price, "@", ask.Venue)
+}
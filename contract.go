@@ -32,6 +32,7 @@ type Contract struct {
 	callPut    CallOrPut
 	perp       bool
 	index      bool
+	spec       *ContractSpec // exchange spec, Deribit if nil
 }
 
 func (c *Contract) Hash() (hash int) {
@@ -52,99 +53,54 @@ func (c *Contract) Hash() (hash int) {
 var conCacheLock sync.Mutex
 var contractCache = make(map[string]*Contract)
 
+// ContractFromName parses a contract name in the naming of any exchange in the contract spec registry,
+// e.g. BTC-27DEC19-10000-C on Deribit, XBTZ19 on BitMEX or BTCUSDT on Binance. Names valid on more than one
+// exchange are ambiguous and return an error, use ContractFromExchangeName for them
 func ContractFromName(name string) (*Contract, error) {
-	var expiry time.Time
-	var callPut CallOrPut
-	var underlying Pair
-	var strike float64
-	var err error
+	return contractFromName("", name)
+}
+
+// ContractFromExchangeName parses a contract name in the naming of exchange exName
+func ContractFromExchangeName(exName, name string) (*Contract, error) {
+	return contractFromName(strings.ToUpper(exName), name)
+}
 
+func contractFromName(exName, name string) (*Contract, error) {
 	conCacheLock.Lock()
 	defer conCacheLock.Unlock()
 	// Faster without cache ?
-	con, exists := contractCache[name]
+	key := exName + ":" + name
+	con, exists := contractCache[key]
 	if exists {
 		return con, nil
 	}
 
-	st := strings.Split(name, "-")
-	if len(st) < 2 {
-		return nil, errors.New("Bad contract formation")
-	}
-
-	switch st[0] {
-	case "BTC":
-		underlying = Pair{BTC, USD}
-	case "ETH":
-		underlying = Pair{ETH, USD}
-	case "BCH":
-		underlying = Pair{BCH, USD}
-	default:
-		err = errors.New("do not recognise coin")
-		return nil, err
-	}
-
-	switch len(st) {
-	case 2:
-		if st[1] == "PERPETUAL" {
-			con = PerpContract(underlying)
-		} else {
-			//			dt, err := time.Parse(ContractDateFormat, strings.ToTitle(st[1]))
-			expiry, err = strToExpiry(st[1])
-			if err != nil {
-				return nil, err
-			}
-			//			expiry = time.Date(dt.Year(), dt.Month(), dt.Day(), 8, 0, 0, 0, time.UTC) // 8am london expiry
-			con = &Contract{
-				underlying: underlying,
-				expiry:     expiry,
-				delivery:   expiry,
-				callPut:    NA}
-		}
-	case 3:
-		if st[1] == "DERIBIT" && st[2] == "INDEX" {
-			con = IndexContract(underlying)
-		} else {
-			return nil, errors.New("Don't recognise contract")
+	var firstErr error
+	var matches []*Contract
+	for _, spec := range ContractSpecs(exName) {
+		c, err := spec.parse(name)
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
-
-	case 4:
-		//		dt, err := time.Parse(ContractDateFormat, strings.ToTitle(st[1]))
-		expiry, err = strToExpiry(st[1])
-		if err != nil {
-			return nil, err
-		}
-		//		expiry = time.Date(dt.Year(), dt.Month(), dt.Day(), 8, 0, 0, 0, time.UTC) // 8am london expiry
-
-		strikei, err := strconv.Atoi(st[2])
-		if err != nil {
-			return nil, err
+		if c != nil {
+			matches = append(matches, c)
 		}
-		strike = float64(strikei)
-
-		switch st[3] {
-		case "C":
-			callPut = Call
-		case "P":
-			callPut = Put
-		default:
-			return nil, errors.New("Need C OR P")
-
+	}
+	switch {
+	case len(matches) == 1:
+		contractCache[key] = matches[0]
+		return matches[0], nil
+	case len(matches) > 1:
+		exNames := make([]string, len(matches))
+		for i, c := range matches {
+			exNames[i] = c.Exchange()
 		}
-		con = &Contract{
-			isOption:   true,
-			underlying: underlying,
-			expiry:     expiry,
-			delivery:   expiry,
-			callPut:    callPut,
-			strike:     strike}
-
-	default:
-		return nil, errors.New("not a good contract formation")
+		return nil, errors.New("ambiguous contract " + name + " on " + strings.Join(exNames, ", ") + ", give its exchange")
 	}
-
-	contractCache[name] = con
-	return con, nil
+	if firstErr == nil {
+		firstErr = errors.New("do not recognise contract " + name)
+	}
+	return nil, firstErr
 }
 
 // strToTime converts dates in the strict format DMMMYY or DDMMMYY
@@ -212,34 +168,42 @@ func strToExpiry(s string) (t time.Time, err error) {
 
 // ContractFromPartialName accepts contracts in the form
 // dec mar-10000 btc-jun-10000-c fri 2fr perp
+// Expiries are the next ones from now, the next quarterly one by default
 func ContractFromPartialName(partialName string) (*Contract, error) {
+	return ContractFromPartialNameAt(partialName, time.Now())
+}
+
+// ContractFromPartialNameAt is ContractFromPartialName with the expiries the next ones after asof
+func ContractFromPartialNameAt(partialName string, asof time.Time) (*Contract, error) {
 	const example = "\nDon't understand contract\nExample JUN or 3500 or MAR-4000-C or BTC-3000-P"
 	sts := strings.Split(partialName, "-")
-	defaultExpiry, _ := time.Parse("02Jan06", "28Jun19")
+	// default to the next quarterly expiry
+	tod := asof
+	defaultExpiry := lastFriday(tod.Year(), (tod.Month()-1)/3*3+3, 8)
+	if !defaultExpiry.After(tod) {
+		defaultExpiry = lastFriday(tod.Year(), (tod.Month()-1)/3*3+6, 8)
+	}
 	c := Contract{
 		isOption:   false,
 		underlying: Pair{BTC, USD},
 		expiry:     defaultExpiry,
 		delivery:   defaultExpiry,
 		callPut:    Call,
-		strike:     5000}
+		spec:       deribitSpec(Pair{BTC, USD})}
 
 	for _, s := range sts {
 		switch strings.ToUpper(s) {
 		case "PERP":
 			c.perp = true
-			n := time.Now()
-			c.expiry = n.Add(24 * time.Hour)
+			c.expiry = asof.Add(24 * time.Hour)
 			continue
 		case "INDEX":
 			c.index = true
-			n := time.Now()
-			c.expiry = n
+			c.expiry = asof
 			continue
 
 		case "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC":
 			// Find the last friday of the relevant month
-			tod := time.Now()
 			mth, _ := time.Parse("Jan", strings.ToUpper(s))
 			followingMonth := mth.Month()%12 + 1 // January is 1
 			year := tod.Year()
@@ -252,34 +216,17 @@ func ContractFromPartialName(partialName string) (*Contract, error) {
 			c.delivery = c.expiry
 			continue
 		case "FRI": // The next friday date. Today if a friday
-			n := time.Now()
-			tod := time.Date(n.Year(), n.Month(), n.Day(), 8, 0, 0, 0, time.UTC)
+			tod := time.Date(asof.Year(), asof.Month(), asof.Day(), 8, 0, 0, 0, time.UTC)
 			daysToAdd := (5 - int64(tod.Weekday())) % 7
 			c.expiry = tod.Add(time.Duration(daysToAdd) * time.Hour * 24)
 			c.delivery = c.expiry
 			continue
 		case "2FR": // The following friday
-			n := time.Now()
-			tod := time.Date(n.Year(), n.Month(), n.Day(), 8, 0, 0, 0, time.UTC)
+			tod := time.Date(asof.Year(), asof.Month(), asof.Day(), 8, 0, 0, 0, time.UTC)
 			daysToAdd := (5-int64(tod.Weekday()))%7 + 7
 			c.expiry = tod.Add(time.Duration(daysToAdd) * time.Hour * 24)
 			c.delivery = c.expiry
 			continue
-		case "BTC":
-			c.underlying = Pair{BTC, USD}
-			continue
-		case "ETH":
-			c.underlying = Pair{ETH, USD}
-			continue
-		case "BCH":
-			c.underlying = Pair{BCH, USD}
-			continue
-		case "XRP":
-			c.underlying = Pair{XRP, USD}
-			continue
-		case "DOT":
-			c.underlying = Pair{DOT, USD}
-			continue
 		case "C":
 			c.callPut = Call
 			c.isOption = true
@@ -291,6 +238,11 @@ func ContractFromPartialName(partialName string) (*Contract, error) {
 		case "":
 			continue
 		}
+		if spec, ok := GetContractSpec(NameDeribit, strings.ToUpper(s)); ok {
+			c.underlying = spec.Underlying
+			c.spec = &spec
+			continue
+		}
 		if d, err := time.Parse(ContractDateFormat+" 15:04", strings.ToTitle(s)+" 08:00"); err == nil {
 			c.expiry = d
 			c.delivery = d
@@ -310,6 +262,9 @@ func ContractFromPartialName(partialName string) (*Contract, error) {
 		}
 		return &c, errors.New("Don't recognise:" + s + example)
 	}
+	if c.isOption && c.strike == 0 {
+		return &c, errors.New("Need a strike" + example)
+	}
 	return &c, nil
 }
 
@@ -319,7 +274,8 @@ func PerpContract(p Pair) *Contract {
 		perp:       true,
 		expiry:     n.Add(24 * time.Hour),
 		delivery:   n.Add(24 * time.Hour),
-		underlying: p}
+		underlying: p,
+		spec:       deribitSpec(p)}
 }
 
 func IndexContract(p Pair) *Contract {
@@ -329,6 +285,7 @@ func IndexContract(p Pair) *Contract {
 		expiry:     n,
 		delivery:   n,
 		underlying: p,
+		spec:       deribitSpec(p),
 	}
 }
 
@@ -339,7 +296,8 @@ func OptContract(p Pair, d time.Time, strike float64, cp CallOrPut) *Contract {
 		expiry:     d,
 		delivery:   d,
 		strike:     strike,
-		callPut:    cp}
+		callPut:    cp,
+		spec:       deribitSpec(p)}
 }
 
 func FutContract(p Pair, d time.Time) *Contract {
@@ -348,7 +306,8 @@ func FutContract(p Pair, d time.Time) *Contract {
 		underlying: p,
 		expiry:     d,
 		delivery:   d,
-		callPut:    NA}
+		callPut:    NA,
+		spec:       deribitSpec(p)}
 }
 
 func (c *Contract) UnderFuture() *Contract {
@@ -359,13 +318,17 @@ func (c *Contract) UnderFuture() *Contract {
 			expiry:     c.expiry,
 			delivery:   c.delivery,
 			strike:     0.0,
-			callPut:    NA}
+			callPut:    NA,
+			spec:       c.spec}
 	} else {
 		return c
 	}
 }
 
 func (c *Contract) Name() string {
+	if c.name == "" && c.spec != nil {
+		c.name = c.spec.name(c)
+	}
 	if c.name == "" {
 		if c.isOption {
 			var cptext string
@@ -428,7 +391,44 @@ func (c Contract) IsFuture() bool {
 	return !c.isOption && !c.index
 }
 
+// Spec returns the exchange spec of the contract, a 10 USD inverse Deribit contract if not registered
+func (c Contract) Spec() ContractSpec {
+	if c.spec != nil {
+		return *c.spec
+	}
+	return ContractSpec{Exchange: NameDeribit, Symbol: string(c.underlying.Coin), Underlying: c.underlying, Settlement: Inverse,
+		SettleCoin: c.underlying.Coin, Multiplier: 10, FutureTick: futurePriceRounding, OptionTick: optionPriceRounding, Naming: DeribitNaming,
+		InitialMargin: 0.01, MaintenanceMargin: 0.005}
+}
+
+func (c Contract) Exchange() string {
+	return c.Spec().Exchange
+}
+
+func (c Contract) Settlement() Settlement {
+	return c.Spec().Settlement
+}
+
+func (c Contract) SettleCoin() Coin {
+	return c.Spec().SettleCoin
+}
+
+func (c Contract) Multiplier() float64 {
+	return c.Spec().Multiplier
+}
+
+// TickSize is the minimum price increment, options on Deribit are priced in coin
+func (c Contract) TickSize() float64 {
+	if c.IsOption() {
+		return c.Spec().OptionTick
+	}
+	return c.Spec().FutureTick
+}
+
 func (c1 *Contract) Equal(c2 *Contract) bool {
+	if c1.Exchange() != c2.Exchange() {
+		return false
+	}
 	if c1.isOption {
 		return c2.isOption &&
 			c1.callPut == c2.callPut &&
@@ -490,11 +490,8 @@ func (c *Contract) CallPutMirror() *Contract {
 }
 
 func (c *Contract) RoundPrice(price float64) float64 {
-	if c.IsOption() {
-		return math.Round(price/optionPriceRounding) * optionPriceRounding
-	} else {
-		return math.Round(price/futurePriceRounding) * futurePriceRounding
-	}
+	tick := c.TickSize()
+	return math.Round(price/tick) * tick
 }
 
 // Calculate the implied vol of a contract given its price in LHS coin value spot
@@ -523,6 +520,17 @@ func (c Contract) OptPrice(asof time.Time, spotPrice, futPrice, vol float64) flo
 	}
 }
 
+// IntrinsicPrice returns the exercise value of an option at futPrice, in the units of OptPrice, i.e. its price at expiry
+func (c Contract) IntrinsicPrice(spotPrice, futPrice float64) float64 {
+	if !c.IsOption() {
+		return math.NaN()
+	}
+	if c.CallPut() == Call {
+		return math.Max(futPrice-c.Strike(), 0) * spotPrice / futPrice
+	}
+	return math.Max(c.Strike()-futPrice, 0) * spotPrice / futPrice
+}
+
 // Return the 'simple' delta computed analytically
 func (c Contract) SimpleDelta(asof time.Time, spotPrice, futPrice, vol float64) float64 {
 	expiryDays := c.ExpiryDays(asof)
@@ -0,0 +1,268 @@
+package bean
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settlement is how a contract is margined and settled
+type Settlement string
+
+const (
+	Inverse Settlement = "INVERSE" // in the coin (LHS), the multiplier is in RHS per contract, e.g. 10 USD on Deribit BTC
+	Linear  Settlement = "LINEAR"  // in the base (RHS), e.g. USDT, the multiplier is in coin per contract
+	Quanto  Settlement = "QUANTO"  // in a third coin, the multiplier is in settlement coin per RHS point per contract
+)
+
+// Naming is the symbology of an exchange
+type Naming string
+
+const (
+	DeribitNaming Naming = "DERIBIT" // BTC-PERPETUAL, BTC-27DEC19, BTC-27DEC19-10000-C, BTC-DERIBIT-INDEX
+	BitMexNaming  Naming = "BITMEX"  // XBTUSD, XBTZ19 (month code and year, expiring the last Friday 12:00 UTC)
+	BinanceNaming Naming = "BINANCE" // BTCUSDT, BTCUSDT_191227
+)
+
+// ContractSpecFile is the contract spec config file under BeanexConfigPath(), a list of ContractSpec, e.g.
+//
+//	[{"exchange": "DERIBIT", "symbol": "SOL", "perp": "SOL-PERPETUAL", "underlying": {"Coin": "SOL", "Base": "USD"},
+//	  "settlement": "INVERSE", "settleCoin": "SOL", "multiplier": 10, "futureTick": 0.01, "optionTick": 0.0005, "naming": "DERIBIT",
+//	  "initialMargin": 0.02, "maintenanceMargin": 0.01}]
+const ContractSpecFile = "contracts.json"
+
+// ContractSpec describes the contracts of an underlying on an exchange
+type ContractSpec struct {
+	Exchange   string     `json:"exchange"`
+	Symbol     string     `json:"symbol"` // the underlying in contract names, e.g. BTC on Deribit, XBT on BitMEX, BTCUSDT on Binance
+	Perp       string     `json:"perp"`   // name of the perpetual, empty if none
+	Underlying Pair       `json:"underlying"`
+	Settlement Settlement `json:"settlement"`
+	SettleCoin Coin       `json:"settleCoin"`
+	Multiplier float64    `json:"multiplier"`
+	FutureTick float64    `json:"futureTick"`
+	OptionTick float64    `json:"optionTick"`
+	Naming     Naming     `json:"naming"`
+	// margin rates of futures as a fraction of the notional
+	InitialMargin     float64 `json:"initialMargin"`
+	MaintenanceMargin float64 `json:"maintenanceMargin"`
+}
+
+var specLock sync.RWMutex
+var contractSpecs = []ContractSpec{
+	{Exchange: NameDeribit, Symbol: "BTC", Perp: "BTC-PERPETUAL", Underlying: Pair{BTC, USD}, Settlement: Inverse, SettleCoin: BTC, Multiplier: 10, FutureTick: 0.5, OptionTick: 0.0005, Naming: DeribitNaming, InitialMargin: 0.01, MaintenanceMargin: 0.005},
+	{Exchange: NameDeribit, Symbol: "ETH", Perp: "ETH-PERPETUAL", Underlying: Pair{ETH, USD}, Settlement: Inverse, SettleCoin: ETH, Multiplier: 1, FutureTick: 0.05, OptionTick: 0.0005, Naming: DeribitNaming, InitialMargin: 0.01, MaintenanceMargin: 0.005},
+	{Exchange: NameDeribit, Symbol: "BCH", Perp: "BCH-PERPETUAL", Underlying: Pair{BCH, USD}, Settlement: Inverse, SettleCoin: BCH, Multiplier: 10, FutureTick: 0.05, OptionTick: 0.0005, Naming: DeribitNaming, InitialMargin: 0.01, MaintenanceMargin: 0.005},
+	{Exchange: NameDeribit, Symbol: "XRP", Perp: "XRP-PERPETUAL", Underlying: Pair{XRP, USD}, Settlement: Inverse, SettleCoin: XRP, Multiplier: 10, FutureTick: 0.0001, OptionTick: 0.0005, Naming: DeribitNaming, InitialMargin: 0.01, MaintenanceMargin: 0.005},
+	{Exchange: NameDeribit, Symbol: "DOT", Perp: "DOT-PERPETUAL", Underlying: Pair{DOT, USD}, Settlement: Inverse, SettleCoin: DOT, Multiplier: 10, FutureTick: 0.001, OptionTick: 0.0005, Naming: DeribitNaming, InitialMargin: 0.01, MaintenanceMargin: 0.005},
+	{Exchange: NameBitMex, Symbol: "XBT", Perp: "XBTUSD", Underlying: Pair{BTC, USD}, Settlement: Inverse, SettleCoin: XBT, Multiplier: 1, FutureTick: 0.5, Naming: BitMexNaming, InitialMargin: 0.01, MaintenanceMargin: 0.005},
+	{Exchange: NameBitMex, Symbol: "ETH", Perp: "ETHUSD", Underlying: Pair{ETH, USD}, Settlement: Quanto, SettleCoin: XBT, Multiplier: 0.000001, FutureTick: 0.05, Naming: BitMexNaming, InitialMargin: 0.02, MaintenanceMargin: 0.01},
+	{Exchange: NameBinance, Symbol: "BTCUSDT", Perp: "BTCUSDT", Underlying: Pair{BTC, USDT}, Settlement: Linear, SettleCoin: USDT, Multiplier: 1, FutureTick: 0.01, Naming: BinanceNaming, InitialMargin: 0.01, MaintenanceMargin: 0.004},
+	{Exchange: NameBinance, Symbol: "ETHUSDT", Perp: "ETHUSDT", Underlying: Pair{ETH, USDT}, Settlement: Linear, SettleCoin: USDT, Multiplier: 1, FutureTick: 0.01, Naming: BinanceNaming, InitialMargin: 0.01, MaintenanceMargin: 0.004},
+}
+
+// RegisterContractSpec adds a spec to the registry, replacing any spec of the same exchange and symbol
+func RegisterContractSpec(spec ContractSpec) {
+	specLock.Lock()
+	defer specLock.Unlock()
+	spec.Exchange = strings.ToUpper(spec.Exchange)
+	for i, s := range contractSpecs {
+		if s.Exchange == spec.Exchange && s.Symbol == spec.Symbol {
+			contractSpecs[i] = spec
+			return
+		}
+	}
+	contractSpecs = append(contractSpecs, spec)
+}
+
+// ContractSpecs returns the registered specs of an exchange, or of all exchanges if exName is empty
+func ContractSpecs(exName string) []ContractSpec {
+	specLock.RLock()
+	defer specLock.RUnlock()
+	var specs []ContractSpec
+	for _, s := range contractSpecs {
+		if exName == "" || s.Exchange == strings.ToUpper(exName) {
+			specs = append(specs, s)
+		}
+	}
+	return specs
+}
+
+// GetContractSpec returns the spec of an underlying symbol on an exchange
+func GetContractSpec(exName string, symbol string) (ContractSpec, bool) {
+	for _, s := range ContractSpecs(exName) {
+		if s.Symbol == symbol {
+			return s, true
+		}
+	}
+	return ContractSpec{}, false
+}
+
+// deribitSpec returns the Deribit spec of an underlying, used by contracts built without a name
+func deribitSpec(p Pair) *ContractSpec {
+	for _, s := range ContractSpecs(NameDeribit) {
+		if s.Underlying == p {
+			return &s
+		}
+	}
+	return nil
+}
+
+// LoadContractSpecs reads a list of specs from a json file
+func LoadContractSpecs(filename string) ([]ContractSpec, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var specs []ContractSpec
+	if err = json.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// RegisterContractSpecsFromConfig registers the specs in ContractSpecFile under BeanexConfigPath(),
+// so that new underlyings and exchanges need no code change
+func RegisterContractSpecsFromConfig() error {
+	specs, err := LoadContractSpecs(BeanexConfigPath() + ContractSpecFile)
+	if err != nil {
+		return err
+	}
+	for _, s := range specs {
+		RegisterContractSpec(s)
+	}
+	return nil
+}
+
+// parse builds the contract of a name in the spec's naming, nil if the name is not one of the spec's contracts
+func (spec ContractSpec) parse(name string) (*Contract, error) {
+	s := spec
+	if spec.Perp != "" && name == spec.Perp {
+		c := PerpContract(spec.Underlying)
+		c.spec = &s
+		return c, nil
+	}
+	switch spec.Naming {
+	case DeribitNaming:
+		return spec.parseDeribit(name)
+	case BitMexNaming:
+		if !strings.HasPrefix(name, spec.Symbol) || len(name) != len(spec.Symbol)+3 {
+			return nil, nil
+		}
+		expiry, err := bitmexExpiry(name[len(spec.Symbol):])
+		if err != nil {
+			return nil, err
+		}
+		c := FutContract(spec.Underlying, expiry)
+		c.spec = &s
+		return c, nil
+	case BinanceNaming:
+		if !strings.HasPrefix(name, spec.Symbol+"_") {
+			return nil, nil
+		}
+		d, err := time.Parse("060102", name[len(spec.Symbol)+1:])
+		if err != nil {
+			return nil, err
+		}
+		c := FutContract(spec.Underlying, d.Add(8*time.Hour))
+		c.spec = &s
+		return c, nil
+	}
+	return nil, errors.New("unknown naming " + string(spec.Naming))
+}
+
+func (spec ContractSpec) parseDeribit(name string) (*Contract, error) {
+	st := strings.Split(name, "-")
+	if len(st) < 2 || st[0] != spec.Symbol {
+		return nil, nil
+	}
+	s := spec
+	var con *Contract
+	switch len(st) {
+	case 2:
+		if st[1] == "PERPETUAL" {
+			con = PerpContract(spec.Underlying)
+		} else {
+			expiry, err := strToExpiry(st[1])
+			if err != nil {
+				return nil, err
+			}
+			con = FutContract(spec.Underlying, expiry)
+		}
+	case 3:
+		if st[1] == "DERIBIT" && st[2] == "INDEX" {
+			con = IndexContract(spec.Underlying)
+		} else {
+			return nil, errors.New("Don't recognise contract")
+		}
+	case 4:
+		expiry, err := strToExpiry(st[1])
+		if err != nil {
+			return nil, err
+		}
+		strike, err := strconv.Atoi(st[2])
+		if err != nil {
+			return nil, err
+		}
+		var callPut CallOrPut
+		switch st[3] {
+		case "C":
+			callPut = Call
+		case "P":
+			callPut = Put
+		default:
+			return nil, errors.New("Need C OR P")
+		}
+		con = OptContract(spec.Underlying, expiry, float64(strike), callPut)
+	default:
+		return nil, errors.New("not a good contract formation")
+	}
+	con.spec = &s
+	return con, nil
+}
+
+// bitmexMonths are the futures month codes
+const bitmexMonths = "FGHJKMNQUVXZ"
+
+// bitmexExpiry returns the expiry of a BitMEX month code and year, e.g. Z19, the last Friday of the month at 12:00 UTC
+func bitmexExpiry(code string) (time.Time, error) {
+	m := strings.IndexByte(bitmexMonths, code[0])
+	year, err := strconv.Atoi(code[1:])
+	if m < 0 || err != nil {
+		return time.Time{}, errors.New("Contract date not recognised " + code)
+	}
+	return lastFriday(2000+year, time.Month(m+1), 12), nil
+}
+
+// lastFriday returns the last Friday of a month at hour UTC
+func lastFriday(year int, month time.Month, hour int) time.Time {
+	dt := time.Date(year, month+1, 1, hour, 0, 0, 0, time.UTC) // first day of the following month
+	daysToAdd := -1 - (dt.Weekday()+1)%7                       // go back to the strictly previous friday
+	return dt.AddDate(0, 0, int(daysToAdd))
+}
+
+// name returns the name of a contract in the spec's naming
+func (spec ContractSpec) name(c *Contract) string {
+	if c.perp && spec.Perp != "" {
+		return spec.Perp
+	}
+	switch spec.Naming {
+	case BitMexNaming:
+		return fmt.Sprintf("%s%c%02d", spec.Symbol, bitmexMonths[c.expiry.Month()-1], c.expiry.Year()%100)
+	case BinanceNaming:
+		return spec.Symbol + "_" + c.expiry.Format("060102")
+	}
+	if c.isOption {
+		return spec.Symbol + "-" + c.ExpiryStr() + "-" + strconv.FormatFloat(c.strike, 'f', 0, 64) + "-" + string(c.callPut)
+	} else if c.perp {
+		return spec.Symbol + "-PERPETUAL"
+	} else if c.index {
+		return spec.Symbol + "-DERIBIT-INDEX"
+	}
+	return spec.Symbol + "-" + c.ExpiryStr()
+}
@@ -0,0 +1,450 @@
+package mds
+
+import (
+	. "bean"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cacheOrderBook   = "orderbook"
+	cacheTransaction = "transaction"
+	cacheExt         = ".gob.gz"
+)
+
+// CacheDir is the default location of the local market data cache, empty if BEANEX is not set
+func CacheDir() string {
+	if os.Getenv(BEANEX) == "" {
+		return ""
+	}
+	return filepath.Join(BeanexDataPath(), "mdcache")
+}
+
+// Cache serves order books and transactions from a local on-disk cache, and only fetches
+// the time ranges it does not hold yet from its source. Data is stored in gzipped columnar chunks,
+// one file per fetched window under dir/exchange/pair/kind/. The contiguous chunks a request reads are merged
+// into one, so that a range fetched in pieces does not stay spread over more and more files.
+// With a nil source, MDS is connected to on the first cache miss, so cached backtests can run offline.
+// A Cache with an empty dir reads straight from the source
+type Cache struct {
+	dir    string
+	src    Source
+	conn   *MDS          // connection made by the cache, closed by Close
+	Settle time.Duration // data within Settle of now may still be incomplete in MDS and is not cached
+}
+
+// DefaultSettle is how long MDS takes to hold all the data of a time range
+const DefaultSettle = time.Hour
+
+// NewCache creates a cache under dir, which is created on first write, in front of src (MDS if nil)
+func NewCache(dir string, src Source) *Cache {
+	return &Cache{dir: dir, src: src, Settle: DefaultSettle}
+}
+
+// window is a half open [From, To) time range held in one chunk file
+type window struct {
+	From, To time.Time
+}
+
+// orderBookColumns stores an OrderBookTS column by column, the levels of all snapshots are
+// flattened into Price and Amount, bids first, with NBids and NAsks levels per snapshot
+type orderBookColumns struct {
+	Time     []int64
+	ChangeId []int64
+	NBids    []int32
+	NAsks    []int32
+	Price    []float64
+	Amount   []float64
+}
+
+// transactionColumns stores Transactions column by column, the pair is given by the chunk's path
+type transactionColumns struct {
+	Time            []int64
+	Price           []float64
+	Amount          []float64
+	Maker           []TraderType
+	TxnID           []string
+	Commission      []float64
+	CommissionAsset []Coin
+}
+
+func (c *Cache) source() (Source, error) {
+	if c.src == nil {
+		m, err := ConnectService()
+		if err != nil {
+			return nil, err
+		}
+		c.conn = &m
+		c.src = m
+	}
+	return c.src, nil
+}
+
+// Close closes the MDS connection, if the cache made one
+func (c *Cache) Close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.src = nil
+	}
+}
+
+func (c *Cache) path(exName string, pair Pair, kind string) string {
+	return filepath.Join(c.dir, exName, string(pair.Coin)+"_"+string(pair.Base), kind)
+}
+
+// windows lists the chunks held for a key, sorted by start time
+func (c *Cache) windows(path string) []window {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+	var ws []window
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, cacheExt) {
+			continue
+		}
+		bounds := strings.Split(strings.TrimSuffix(name, cacheExt), "-")
+		if len(bounds) != 2 {
+			continue
+		}
+		from, err1 := strconv.ParseInt(bounds[0], 10, 64)
+		to, err2 := strconv.ParseInt(bounds[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		ws = append(ws, window{time.Unix(0, from), time.Unix(0, to)})
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i].From.Before(ws[j].From) })
+	return ws
+}
+
+func (w window) filename() string {
+	return fmt.Sprintf("%d-%d%s", w.From.UnixNano(), w.To.UnixNano(), cacheExt)
+}
+
+func (w window) overlaps(v window) bool {
+	return w.From.Before(v.To) && v.From.Before(w.To)
+}
+
+// fetches returns the parts of w not covered by the sorted chunks ws, split at the settle horizon
+func (c *Cache) fetches(w window, ws []window) []window {
+	horizon := time.Now().Add(-c.Settle)
+	var res []window
+	for _, gap := range missing(w, ws) {
+		if gap.From.Before(horizon) && gap.To.After(horizon) {
+			res = append(res, window{gap.From, horizon}, window{horizon, gap.To})
+		} else {
+			res = append(res, gap)
+		}
+	}
+	return res
+}
+
+// cacheable returns true if a fetched window can be stored: it has to end before the settle horizon, so that
+// MDS holds all its data, and to have returned some data, as an empty result may be a gap in MDS yet to be filled
+func (c *Cache) cacheable(w window, n int) bool {
+	return n > 0 && !w.To.After(time.Now().Add(-c.Settle))
+}
+
+// missing returns the parts of w not covered by the sorted chunks ws
+func missing(w window, ws []window) []window {
+	var gaps []window
+	from := w.From
+	for _, v := range ws {
+		if !v.overlaps(window{from, w.To}) {
+			continue
+		}
+		if from.Before(v.From) {
+			gaps = append(gaps, window{from, v.From})
+		}
+		if v.To.After(from) {
+			from = v.To
+		}
+	}
+	if from.Before(w.To) {
+		gaps = append(gaps, window{from, w.To})
+	}
+	return gaps
+}
+
+func writeChunk(path string, w window, data interface{}) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	// write to a temporary file first, so that an interrupted write never leaves a partial chunk
+	f, err := ioutil.TempFile(path, "tmp")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	err = gob.NewEncoder(zw).Encode(data)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(path, w.filename()))
+}
+
+// compact merges the chunks read for a request into one chunk of data() when they are contiguous,
+// chunks separated by a window that was not cached are left as they are
+func compact(path string, read []window, data func() interface{}) error {
+	if len(read) < 2 {
+		return nil
+	}
+	for i := 1; i < len(read); i++ {
+		if !read[i].From.Equal(read[i-1].To) {
+			return nil
+		}
+	}
+	if err := writeChunk(path, window{read[0].From, read[len(read)-1].To}, data()); err != nil {
+		return err
+	}
+	for _, w := range read {
+		if err := os.Remove(filepath.Join(path, w.filename())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readChunk(path string, w window, data interface{}) error {
+	f, err := os.Open(filepath.Join(path, w.filename()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return gob.NewDecoder(zr).Decode(data)
+}
+
+// request turns the closed [start, end] range of the MDS queries into a half open window
+func request(start, end time.Time) window {
+	return window{start, end.Add(time.Nanosecond)}
+}
+
+func inWindow(t time.Time, w window) bool {
+	return !t.Before(w.From) && t.Before(w.To)
+}
+
+func toOrderBookColumns(obts OrderBookTS) orderBookColumns {
+	var cols orderBookColumns
+	for _, ob := range obts {
+		bids, asks := ob.Bids(), ob.Asks()
+		cols.Time = append(cols.Time, ob.Time.UnixNano())
+		cols.ChangeId = append(cols.ChangeId, ob.ChangeId)
+		cols.NBids = append(cols.NBids, int32(len(bids)))
+		cols.NAsks = append(cols.NAsks, int32(len(asks)))
+		for _, orders := range [][]Order{bids, asks} {
+			for _, o := range orders {
+				cols.Price = append(cols.Price, o.Price)
+				cols.Amount = append(cols.Amount, o.Amount)
+			}
+		}
+	}
+	return cols
+}
+
+func (cols orderBookColumns) orderBookTS() OrderBookTS {
+	obts := make(OrderBookTS, len(cols.Time))
+	k := 0
+	for i := range cols.Time {
+		orders := func(n int32) []Order {
+			res := make([]Order, n)
+			for j := range res {
+				res[j] = Order{Price: cols.Price[k], Amount: cols.Amount[k]}
+				k++
+			}
+			return res
+		}
+		bids := orders(cols.NBids[i])
+		asks := orders(cols.NAsks[i])
+		obts[i] = OrderBookT{OrderBook: NewOrderBook(bids, asks), Time: time.Unix(0, cols.Time[i]).UTC(), ChangeId: cols.ChangeId[i]}
+	}
+	return obts
+}
+
+func toTransactionColumns(txns Transactions) transactionColumns {
+	var cols transactionColumns
+	for _, t := range txns {
+		cols.Time = append(cols.Time, t.TimeStamp.UnixNano())
+		cols.Price = append(cols.Price, t.Price)
+		cols.Amount = append(cols.Amount, t.Amount)
+		cols.Maker = append(cols.Maker, t.Maker)
+		cols.TxnID = append(cols.TxnID, t.TxnID)
+		cols.Commission = append(cols.Commission, t.Commission)
+		cols.CommissionAsset = append(cols.CommissionAsset, t.CommissionAsset)
+	}
+	return cols
+}
+
+func (cols transactionColumns) transactions(pair Pair) Transactions {
+	txns := make(Transactions, len(cols.Time))
+	for i := range cols.Time {
+		txns[i] = Transaction{
+			Pair:            pair,
+			Price:           cols.Price[i],
+			Amount:          cols.Amount[i],
+			TimeStamp:       time.Unix(0, cols.Time[i]).UTC(),
+			Maker:           cols.Maker[i],
+			TxnID:           cols.TxnID[i],
+			Commission:      cols.Commission[i],
+			CommissionAsset: cols.CommissionAsset[i],
+		}
+	}
+	return txns
+}
+
+// GetOrderBookTS2 returns the same as the source, fetching only the ranges not in the cache
+func (c *Cache) GetOrderBookTS2(exName string, pair Pair, start, end time.Time) (OrderBookTS, error) {
+	if c.dir == "" {
+		m, err := c.source()
+		if err != nil {
+			return nil, err
+		}
+		return m.GetOrderBookTS2(exName, pair, start, end)
+	}
+	path := c.path(exName, pair, cacheOrderBook)
+	req := request(start, end)
+	var res OrderBookTS // fetched but not cached
+	for _, gap := range c.fetches(req, c.windows(path)) {
+		m, err := c.source()
+		if err != nil {
+			return nil, err
+		}
+		// MDS queries are to the second, so fetch up to the next second and keep what falls in the gap
+		obts, err := m.GetOrderBookTS2(exName, pair, gap.From, gap.To.Add(time.Second))
+		if err != nil {
+			return nil, err
+		}
+		var fetched OrderBookTS
+		for _, ob := range obts {
+			if inWindow(ob.Time, gap) {
+				fetched = append(fetched, ob)
+			}
+		}
+		if !c.cacheable(gap, len(fetched)) {
+			res = append(res, fetched...)
+			continue
+		}
+		if err := writeChunk(path, gap, toOrderBookColumns(fetched)); err != nil {
+			return nil, err
+		}
+	}
+	var read []window
+	var all OrderBookTS
+	for _, w := range c.windows(path) {
+		if !w.overlaps(req) {
+			continue
+		}
+		var cols orderBookColumns
+		if err := readChunk(path, w, &cols); err != nil {
+			return nil, err
+		}
+		obts := cols.orderBookTS()
+		for _, ob := range obts {
+			if inWindow(ob.Time, req) {
+				res = append(res, ob)
+			}
+		}
+		read = append(read, w)
+		all = append(all, obts...)
+	}
+	if err := compact(path, read, func() interface{} { return toOrderBookColumns(all) }); err != nil {
+		return nil, err
+	}
+	return res.Sort(), nil
+}
+
+// GetTransactions2 returns the same as the source, fetching only the ranges not in the cache
+func (c *Cache) GetTransactions2(exName string, pair Pair, start, end time.Time) (Transactions, error) {
+	if c.dir == "" {
+		m, err := c.source()
+		if err != nil {
+			return nil, err
+		}
+		return m.GetTransactions2(exName, pair, start, end)
+	}
+	path := c.path(exName, pair, cacheTransaction)
+	req := request(start, end)
+	var res Transactions // fetched but not cached
+	for _, gap := range c.fetches(req, c.windows(path)) {
+		m, err := c.source()
+		if err != nil {
+			return nil, err
+		}
+		// MDS queries are to the second, so fetch up to the next second and keep what falls in the gap
+		txns, err := m.GetTransactions2(exName, pair, gap.From, gap.To.Add(time.Second))
+		if err != nil {
+			return nil, err
+		}
+		var fetched Transactions
+		for _, t := range txns {
+			if inWindow(t.TimeStamp, gap) {
+				fetched = append(fetched, t)
+			}
+		}
+		if !c.cacheable(gap, len(fetched)) {
+			res = append(res, fetched...)
+			continue
+		}
+		if err := writeChunk(path, gap, toTransactionColumns(fetched)); err != nil {
+			return nil, err
+		}
+	}
+	var read []window
+	var all Transactions
+	for _, w := range c.windows(path) {
+		if !w.overlaps(req) {
+			continue
+		}
+		var cols transactionColumns
+		if err := readChunk(path, w, &cols); err != nil {
+			return nil, err
+		}
+		txns := cols.transactions(pair)
+		for _, t := range txns {
+			if inWindow(t.TimeStamp, req) {
+				res = append(res, t)
+			}
+		}
+		read = append(read, w)
+		all = append(all, txns...)
+	}
+	if err := compact(path, read, func() interface{} { return toTransactionColumns(all) }); err != nil {
+		return nil, err
+	}
+	return res.Sort(), nil
+}
+
+// GetFundingRates gets the funding rates of a perpetual from MDS, they are not cached
+func (c *Cache) GetFundingRates(exName string, instr string, start, end time.Time) (FundingRates, error) {
+	src, err := c.source()
+	if err != nil {
+		return nil, err
+	}
+	fs, ok := src.(FundingSource)
+	if !ok {
+		return nil, nil
+	}
+	return fs.GetFundingRates(exName, instr, start, end)
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -290,6 +291,61 @@ func (mds MDS) GetContractTXNs(exName string, instr string, start, end time.Time
 	return txns, nil
 }
 
+// GetFundingRates gets the funding rate history of a perpetual, e.g. BTC-PERPETUAL, sorted by time
+func (mds MDS) GetFundingRates(exName string, instr string, start, end time.Time) (FundingRates, error) {
+	var rates FundingRates
+	cmd := "select Rate,IndexPrice from " + MT_FUNDING_RATE +
+		" where time >='" + start.Format(time.RFC3339) + "' and time <='" + end.Format(time.RFC3339) +
+		"' and exchange = '" + exName +
+		"' and instr = '" + instr + "'"
+	if len(mds.cs) == 0 {
+		return nil, errors.New("no MDS connection established")
+	}
+	resp, err := influx.QueryDB(MDS_DBNAME, mds.cs[0], cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) <= 0 || len(resp[0].Series) <= 0 {
+		return rates, nil
+	}
+	for _, d := range resp[0].Series[0].Values {
+		t, err := time.Parse(time.RFC3339, d[0].(string))
+		if err != nil {
+			return nil, err
+		}
+		rate, _ := d[1].(json.Number).Float64()
+		index, _ := d[2].(json.Number).Float64()
+		rates = append(rates, FundingRate{Instrument: instr, TimeStamp: t, Rate: rate, IndexPrice: index})
+	}
+	rates.Sort()
+	return rates, nil
+}
+
+// GetIndexPrice gets the last index price of an underlying at or before t, from the orderbook of its IndexContract
+func (mds MDS) GetIndexPrice(exName string, underlying Pair, t time.Time) (float64, error) {
+	instr := IndexContract(underlying).Name()
+	cmd := "select last(Price) from " + MT_CONTRACT_ORDERBOOK +
+		" where instrument='" + instr + "'" +
+		" and exchange='" + exName + "'" +
+		" and index='0'" +
+		" and time >='" + t.Add(-time.Hour).Format(time.RFC3339) + "' and time <='" + t.Format(time.RFC3339) + "'"
+	if len(mds.cs) == 0 {
+		return math.NaN(), errors.New("no MDS connection established")
+	}
+	resp, err := influx.QueryDB(MDS_DBNAME, mds.cs[0], cmd)
+	if err != nil {
+		return math.NaN(), err
+	}
+	if len(resp) <= 0 || len(resp[0].Series) <= 0 || len(resp[0].Series[0].Values) <= 0 {
+		return math.NaN(), errors.New("no index price of " + instr + " at " + t.Format(time.RFC3339))
+	}
+	price, err := resp[0].Series[0].Values[0][1].(json.Number).Float64()
+	if err != nil {
+		return math.NaN(), err
+	}
+	return price, nil
+}
+
 // internal functions
 func getOrders2(c client.Client, instrument string, side string, timeFrom string, timeTo string, indexLimit int, sample string) map[string][]Order {
 	if indexLimit < 1 {
@@ -0,0 +1,104 @@
+package mds
+
+import (
+	. "bean"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Source provides the historical orderbooks and transactions of an exchange, for simulations.
+// It is implemented by MDS, Cache and FileSource
+type Source interface {
+	// GetOrderBookTS2 returns the orderbooks of pair on exName in [start, end], sorted by time
+	GetOrderBookTS2(exName string, pair Pair, start, end time.Time) (OrderBookTS, error)
+	// GetTransactions2 returns the transactions of pair on exName in [start, end], sorted by time
+	GetTransactions2(exName string, pair Pair, start, end time.Time) (Transactions, error)
+}
+
+// ContractSource provides the historical orderbooks and transactions of contracts, for contract simulations.
+// It is implemented by MDS
+type ContractSource interface {
+	GetContractOrderBookTS(con *Contract, start, end time.Time, depth int, sample time.Duration) (OrderBookTS, error)
+	GetContractTXNs(exName string, instr string, start, end time.Time) (ContractTXNs, error)
+}
+
+// FundingSource provides the funding rate history of perpetuals, which simulators accrue when their source
+// implements it. It is implemented by MDS and Cache
+type FundingSource interface {
+	GetFundingRates(exName string, instr string, start, end time.Time) (FundingRates, error)
+}
+
+// FileSource reads market data from files under dir/exchange/COIN_BASE/, orderbook.csv or orderbook.jsonl
+// for orderbooks as written by OrderBookTS.ToCSV / ToJSONL, and transactions.csv or transactions.jsonl for
+// transactions as written by Transactions.ToCSV / ToJSONL. A missing file means there is no data
+type FileSource struct {
+	dir string
+}
+
+func NewFileSource(dir string) FileSource {
+	return FileSource{dir: dir}
+}
+
+// Path returns the directory holding the files of pair on exName
+func (fs FileSource) Path(exName string, pair Pair) string {
+	return filepath.Join(fs.dir, exName, string(pair.Coin)+"_"+string(pair.Base))
+}
+
+// Save writes the orderbooks and transactions of pair on exName as CSV, e.g. to share a dataset fetched from MDS
+func (fs FileSource) Save(exName string, pair Pair, obts OrderBookTS, txn Transactions) error {
+	path := fs.Path(exName, pair)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	obts.ToCSV(filepath.Join(path, "orderbook.csv"))
+	txn.ToCSV(pair, filepath.Join(path, "transactions.csv"))
+	return nil
+}
+
+// file returns the first of name.csv and name.jsonl that exists
+func (fs FileSource) file(exName string, pair Pair, name string) (string, bool) {
+	for _, ext := range []string{".csv", ".jsonl"} {
+		filename := filepath.Join(fs.Path(exName, pair), name+ext)
+		if _, err := os.Stat(filename); err == nil {
+			return filename, true
+		}
+	}
+	return "", false
+}
+
+func (fs FileSource) GetOrderBookTS2(exName string, pair Pair, start, end time.Time) (OrderBookTS, error) {
+	filename, ok := fs.file(exName, pair, "orderbook")
+	if !ok {
+		return nil, nil
+	}
+	obts, err := ReadOrderBookTS(filename)
+	if err != nil {
+		return nil, err
+	}
+	var res OrderBookTS
+	for _, ob := range obts {
+		if !ob.Time.Before(start) && !ob.Time.After(end) {
+			res = append(res, ob)
+		}
+	}
+	return res, nil
+}
+
+func (fs FileSource) GetTransactions2(exName string, pair Pair, start, end time.Time) (Transactions, error) {
+	filename, ok := fs.file(exName, pair, "transactions")
+	if !ok {
+		return nil, nil
+	}
+	txn, err := ReadTransactions(filename, pair)
+	if err != nil {
+		return nil, err
+	}
+	var res Transactions
+	for _, t := range txn {
+		if !t.TimeStamp.Before(start) && !t.TimeStamp.After(end) {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
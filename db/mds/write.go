@@ -61,6 +61,30 @@ func (mds MDS) WriteTXNPoints(trans Transactions, exName string) error {
 	return mds.WriteBatchPoints(bp)
 }
 
+// WriteFundingRates writes the funding rates of perpetuals to the FUNDING_RATE table
+func (mds MDS) WriteFundingRates(rates FundingRates, exName string) error {
+	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{
+		Database:  MDS_DBNAME,
+		Precision: "ms",
+	})
+	for _, r := range rates {
+		tags := map[string]string{
+			"exchange": exName,
+			"instr":    r.Instrument,
+		}
+		fields := map[string]interface{}{
+			"Rate":       r.Rate,
+			"IndexPrice": r.IndexPrice,
+		}
+		pt, err := client.NewPoint(MT_FUNDING_RATE, tags, fields, r.TimeStamp)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+	return mds.WriteBatchPoints(bp)
+}
+
 func (mds MDS) WritePoints(pts []influx.Point, measurement string) error {
 	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{
 		Database:  MDS_DBNAME,
@@ -22,6 +22,7 @@ const MT_RISK_DELTA = "RISK_DELTA"
 const MT_RISK_MARGIN_INFO = "RISK_MARGIN_INFO"
 const MT_MTM = "MTM"
 const MT_CONTRACT_TRADE = "CONTRACT_TRADE"
+const MT_SETTLEMENT = "SETTLEMENT"
 
 const TDS_DBNAME = "TDS"
 const BALANCE_DBNAME = "BALANCE"
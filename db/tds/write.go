@@ -95,6 +95,63 @@ func RecordPortfolios(ports map[string]Portfolio, acctName string, timeStamp tim
 	return influx.WriteBatchPoints(cs, bp)
 }
 
+// RecordSettlements records the settlements of expired positions of an exchange account
+func RecordSettlements(settled []ExpirySettlement, acctName, exName string) error {
+	if len(settled) == 0 {
+		return nil
+	}
+	cs, err := connect()
+	for _, c := range cs {
+		defer c.Close()
+	}
+	if err != nil {
+		return err
+	}
+	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{
+		Database:  BALANCE_DBNAME,
+		Precision: "s",
+	})
+	for _, s := range settled {
+		tags := map[string]string{
+			"account":    acctName,
+			"exchange":   exName,
+			"instrument": s.Position.Name(),
+			"coin":       string(s.Coin),
+		}
+		fields := map[string]interface{}{
+			"Qty":        s.Position.Qty(),
+			"IndexPrice": s.IndexPrice,
+			"Amount":     s.Amount,
+		}
+		pt, err := client.NewPoint(MT_SETTLEMENT, tags, fields, s.Time)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+	return influx.WriteBatchPoints(cs, bp)
+}
+
+// SettleAndRecordPortfolios settles the expired positions of the portfolios as of timeStamp, records the
+// settlements, then records the portfolios as RecordPortfolios. Positions which cannot be settled yet are
+// recorded as they are, and the last error is returned once everything else is recorded
+func SettleAndRecordPortfolios(ports map[string]Portfolio, acctName string, timeStamp time.Time, agg bool, pricer IndexPricer) error {
+	var lastErr error
+	for exName, port := range ports {
+		settled, err := SettleExpired(port, timeStamp, pricer)
+		if err != nil {
+			lastErr = err
+		}
+		if err := RecordSettlements(settled, acctName, exName); err != nil {
+			lastErr = err
+		}
+	}
+	if err := RecordPortfolios(ports, acctName, timeStamp, agg); err != nil {
+		return err
+	}
+	return lastErr
+}
+
 // record aggregated portfolio to influx db as of now, isPL: true: write to MT_PNL_BALANCE, false: write to MT_TOTAL_BALANCE
 func RecordTotalPortfolio(port Portfolio, acctName string, timeStamp time.Time, isPL bool, agg bool) error {
 	cs, err := connect()
@@ -173,6 +173,9 @@ func GenerateSnapshot(t Transaction, p Portfolio) Snapshot {
 
 	p.AddBalance(coin, coinChange)
 	p.RemoveBalance(base, baseChange)
+	if t.Commission != 0 {
+		p.RemoveBalance(t.CommissionAsset, t.Commission)
+	}
 
 	snap.Port = p
 	snap.Time = t.TimeStamp
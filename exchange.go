@@ -7,6 +7,7 @@ import (
 	"math"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -55,6 +56,33 @@ const (
 	FillOrKill         OrderLife = 3
 )
 
+var orderLifeNames = map[OrderLife]string{
+	GoodTillCancelled:  "GTC",
+	InstantOrCancelled: "IOC",
+	FillOrKill:         "FOK",
+}
+
+func (l OrderLife) String() string {
+	if s, ok := orderLifeNames[l]; ok {
+		return s
+	}
+	return "GTC"
+}
+
+func (l OrderLife) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *OrderLife) UnmarshalText(text []byte) error {
+	for ol, s := range orderLifeNames {
+		if s == string(text) {
+			*l = ol
+			return nil
+		}
+	}
+	return errors.New("unknown order life " + string(text))
+}
+
 func IsContractExchange(exName string) bool {
 	conEx := []string{NameDeribit, NameBitMex}
 	return util.Contains(conEx, strings.ToUpper(exName))
@@ -266,3 +294,27 @@ func ExShortName(exName string) string {
 	}
 
 }
+
+// ExchangeFactory creates a connected exchange, e.g. from the keys in the account config
+type ExchangeFactory func() (Exchange, error)
+
+var exchangeLock sync.RWMutex
+var exchangeFactories = make(map[string]ExchangeFactory)
+
+// RegisterExchange registers the factory of an exchange, so that it can be created by name with NewExchange
+func RegisterExchange(exName string, f ExchangeFactory) {
+	exchangeLock.Lock()
+	defer exchangeLock.Unlock()
+	exchangeFactories[strings.ToUpper(exName)] = f
+}
+
+// NewExchange creates a registered exchange by name
+func NewExchange(exName string) (Exchange, error) {
+	exchangeLock.RLock()
+	f, ok := exchangeFactories[strings.ToUpper(exName)]
+	exchangeLock.RUnlock()
+	if !ok {
+		return nil, errors.New("exchange " + exName + " is not registered")
+	}
+	return f()
+}
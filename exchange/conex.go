@@ -0,0 +1,162 @@
+package exchange
+
+import (
+	. "bean"
+	"errors"
+	"math"
+	"time"
+)
+
+// ContractExchange trades the instruments of a ContractSimulator as an Exchange, one instrument per pair, so that
+// a Strat and brew.PerformActions run on contracts, e.g. a perpetual traded as its underlying pair.
+// Pairs without an instrument have empty orderbooks and reject orders
+type ContractExchange struct {
+	sim         *ContractSimulator
+	instruments map[Pair]string
+}
+
+// NewContractExchange trades sim with the instruments keyed by the pair they are traded as
+func NewContractExchange(sim *ContractSimulator, instruments map[Pair]string) *ContractExchange {
+	return &ContractExchange{sim: sim, instruments: instruments}
+}
+
+// Simulator returns the contract simulator traded
+func (ex *ContractExchange) Simulator() *ContractSimulator {
+	return ex.sim
+}
+
+func (ex *ContractExchange) instrument(pair Pair) (string, error) {
+	instr, ok := ex.instruments[pair]
+	if !ok {
+		return "", errors.New("no instrument traded as " + pair.String() + " on " + ex.sim.Name())
+	}
+	return instr, nil
+}
+
+func (ex *ContractExchange) Name() string {
+	return ex.sim.Name()
+}
+
+func (ex *ContractExchange) GetOrderBook(pair Pair) OrderBook {
+	instr, err := ex.instrument(pair)
+	if err != nil || len(ex.sim.OrderBookTS(instr)) == 0 {
+		return EmptyOrderBook()
+	}
+	return ex.sim.GetOrderBook(instr)
+}
+
+// GetTicker returns the best bid and ask of the orderbook of the instrument
+func (ex *ContractExchange) GetTicker(pair Pair) (Ticker, error) {
+	ob := ex.GetOrderBook(pair)
+	if !ob.Valid() {
+		return Ticker{}, errors.New("no two sided orderbook for " + pair.String())
+	}
+	return Ticker{BestBid: ob.BestBid().Price, BestAsk: ob.BestAsk().Price}, nil
+}
+
+func (ex *ContractExchange) GetLastPrice(pair Pair) (float64, error) {
+	txns := ex.GetTransactionHistory(pair)
+	if len(txns) == 0 {
+		return math.NaN(), errors.New("no recent trade of " + pair.String())
+	}
+	return txns[len(txns)-1].Price, nil
+}
+
+func (ex *ContractExchange) GetTransactionHistory(pair Pair) Transactions {
+	instr, err := ex.instrument(pair)
+	if err != nil {
+		return nil
+	}
+	return ex.sim.GetTransactionHistory(instr)
+}
+
+// GetPortfolio returns the balances and positions of the simulator
+func (ex *ContractExchange) GetPortfolio() Portfolio {
+	return ex.sim.GetPortfolio()
+}
+
+func (ex *ContractExchange) GetPortfolioByCoins(coins Coins) Portfolio {
+	p := ex.GetPortfolio()
+	return p.Filter(coins)
+}
+
+// PlaceLimitOrder places an order on the instrument of pair, in contracts for futures and coins for options
+func (ex *ContractExchange) PlaceLimitOrder(pair Pair, price float64, amount float64) (string, error) {
+	instr, err := ex.instrument(pair)
+	if err != nil {
+		return "", err
+	}
+	return ex.sim.PlaceLimitOrder(instr, price, amount)
+}
+
+func (ex *ContractExchange) CancelOrder(pair Pair, orderID string) error {
+	instr, err := ex.instrument(pair)
+	if err != nil {
+		return err
+	}
+	return ex.sim.CancelOrder(instr, orderID)
+}
+
+func (ex *ContractExchange) GetOrderStatus(orderID string, pair Pair) (OrderStatus, error) {
+	instr, err := ex.instrument(pair)
+	if err != nil {
+		return OrderStatus{}, err
+	}
+	return ex.sim.GetOrderStatus(orderID, instr)
+}
+
+func (ex *ContractExchange) GetMyOrders(pair Pair) []OrderStatus {
+	instr, err := ex.instrument(pair)
+	if err != nil {
+		return nil
+	}
+	return ex.sim.GetMyOrders(instr)
+}
+
+func (ex *ContractExchange) GetAccountOrders(pair Pair) []OrderStatus {
+	return ex.GetMyOrders(pair)
+}
+
+func (ex *ContractExchange) CancelAllOrders(pair Pair) {
+	if instr, err := ex.instrument(pair); err == nil {
+		ex.sim.CancelAllOrders(instr)
+	}
+}
+
+// GetMyTrades returns the simulated trades of the instrument of pair between start and end, with commission
+func (ex *ContractExchange) GetMyTrades(pair Pair, start, end time.Time) TradeLogS {
+	instr, err := ex.instrument(pair)
+	if err != nil {
+		return TradeLogS{}
+	}
+	var txns Transactions
+	for _, t := range ex.sim.GetMyTrades(instr, start, end) {
+		txns = append(txns, Transaction{Pair: pair, Price: t.Price, Amount: t.Amount, TimeStamp: t.TimeStamp, Maker: t.Maker,
+			TxnID: t.TxnID, OrderID: t.OrderID, Commission: t.Commission, CommissionAsset: t.CommissionAsset})
+	}
+	return TradeLogsFromTxn(txns)
+}
+
+// dummy function, the simulator doesn't need to trace the orders for each strategy separately
+func (ex *ContractExchange) TrackOrderID(pair Pair, oid string) {
+}
+
+func (ex *ContractExchange) GetMakerFee(pair Pair) float64 {
+	instr, err := ex.instrument(pair)
+	if err != nil {
+		return math.NaN()
+	}
+	return ex.sim.GetMakerFee(instr)
+}
+
+func (ex *ContractExchange) GetTakerFee(pair Pair) float64 {
+	instr, err := ex.instrument(pair)
+	if err != nil {
+		return math.NaN()
+	}
+	return ex.sim.GetTakerFee(instr)
+}
+
+func (ex *ContractExchange) GetKline(pair Pair, interval string, limit int) (OHLCVBSTS, error) {
+	return nil, errors.New("no klines on " + ex.sim.Name())
+}
@@ -0,0 +1,548 @@
+package exchange
+
+import (
+	. "bean"
+	"bean/db/mds"
+	"bean/logger"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInsufficientMargin is returned when an order would leave the equity of its settlement coin below the
+// initial margin of the positions and open orders
+var ErrInsufficientMargin = errors.New("insufficient margin")
+
+// ContractSimulator replays the orderbooks and trades of contracts, e.g. Deribit futures and options, with the
+// fill models and latencies of Simulator. Instruments are traded by name and fills update the Positions of the
+// portfolio, with premiums, realised PnL and commissions in their settlement coins. Orders are checked against
+// the initial margin of their settlement coin
+type ContractSimulator struct {
+	exName string
+	now    time.Time
+	last   time.Time
+
+	// historical data, by instrument name
+	contracts map[string]*Contract
+	obts      map[string]OrderBookTS
+	txn       map[string]Transactions
+
+	// simulated orders and deals
+	myOrders       map[string]([]SimOrder)
+	myTransactions ContractTXNs
+	oid            int
+	myPortfolio    Portfolio
+	fillModel      FillModel
+	latency        Latency
+	fees           FeeSchedule
+	funding        FundingRates
+	index          IndexPricer
+	settlements    []ExpirySettlement
+	unsettled      SettlementErrors
+}
+
+// NewContractSimulator creates a contract simulator with the minutely orderbooks and the trades of the
+// instruments of exName from MDS
+func NewContractSimulator(exName string, names []string, start, end time.Time, initPortfolio Portfolio) ContractSimulator {
+	m, err := mds.ConnectService()
+	if err != nil {
+		panic("failed connecting to MDS " + err.Error())
+	}
+	defer m.Close()
+	return NewContractSimulatorFrom(m, exName, names, start, end, time.Minute, initPortfolio)
+}
+
+// NewContractSimulatorFrom creates a contract simulator with the orderbooks of the instruments sampled every
+// sample, and their trades, from src
+func NewContractSimulatorFrom(src mds.ContractSource, exName string, names []string, start, end time.Time, sample time.Duration, initPortfolio Portfolio) ContractSimulator {
+	contracts := make(map[string]*Contract, len(names))
+	obts := make(map[string]OrderBookTS, len(names))
+	txn := make(map[string]Transactions, len(names))
+	myOrders := make(map[string]([]SimOrder), len(names))
+	for _, name := range names {
+		c, err := ContractFromExchangeName(exName, name)
+		if err != nil {
+			panic("unknown instrument " + name + " " + err.Error())
+		}
+		contracts[name] = c
+		obts[name], err = src.GetContractOrderBookTS(c, start, end, 20, sample) // TODO: hard code 20 depth for now
+		if err != nil {
+			panic("failed loading orderbooks " + err.Error())
+		}
+		ctxn, err := src.GetContractTXNs(exName, name, start, end)
+		if err != nil {
+			panic("failed loading transactions " + err.Error())
+		}
+		txn[name] = toTransactions(c, ctxn)
+		myOrders[name] = make([]SimOrder, 0)
+	}
+	// funding of the perpetuals, if the source has funding rates
+	var funding FundingRates
+	if fs, ok := src.(mds.FundingSource); ok {
+		for name, c := range contracts {
+			if !c.Perp() {
+				continue
+			}
+			rates, err := fs.GetFundingRates(exName, name, start, end)
+			if err != nil {
+				panic("failed loading funding rates " + err.Error())
+			}
+			funding = append(funding, rates...)
+		}
+		funding.Sort()
+	}
+	// fee schedule from config, fall back to the Deribit option rate of 0.03% of the underlying if not configured
+	fees, err := GetFeeSchedule(exName)
+	if err == ErrNoFeeSchedule {
+		fees = FeeSchedule{Default: FeeRate{Maker: 0.0003, Taker: 0.0003}}
+		logger.Warn().Str("exchange", exName).Msg("no fee schedule, charging 0.03% until SetFeeSchedule")
+	} else if err != nil {
+		panic("failed loading fee schedule " + err.Error())
+	}
+	return ContractSimulator{
+		exName:      exName,
+		now:         start,
+		contracts:   contracts,
+		obts:        obts,
+		txn:         txn,
+		myOrders:    myOrders,
+		myPortfolio: initPortfolio,
+		fillModel:   TradeThroughFill{},
+		fees:        fees,
+		funding:     funding,
+	}
+}
+
+// toTransactions converts contract trades for the fill models, priced as the contract
+func toTransactions(c *Contract, ctxn ContractTXNs) Transactions {
+	txns := make(Transactions, len(ctxn))
+	for i, t := range ctxn.Sort() {
+		txns[i] = Transaction{Pair: c.Underlying(), Price: t.Price, Amount: t.Amount, TimeStamp: t.TimeStamp, Maker: t.Maker, TxnID: t.TxnID}
+	}
+	return txns
+}
+
+// Reset clears the orders, trades and settlements, keeping the historical data
+func (sim *ContractSimulator) Reset(start time.Time, initPortfolio Portfolio) {
+	for name := range sim.myOrders {
+		sim.myOrders[name] = make([]SimOrder, 0)
+	}
+	sim.oid = 0
+	sim.myPortfolio = initPortfolio
+	sim.now = start
+	sim.myTransactions = nil
+	sim.settlements = nil
+	sim.unsettled = nil
+	if fm, ok := sim.fillModel.(*ProbFill); ok {
+		fm.Reseed()
+	}
+	sim.latency.reseed()
+}
+
+func (sim ContractSimulator) Name() string {
+	return sim.exName
+}
+
+// Contract returns the contract of an instrument loaded in the simulator
+func (sim ContractSimulator) Contract(instr string) (*Contract, bool) {
+	c, ok := sim.contracts[instr]
+	return c, ok
+}
+
+func (sim ContractSimulator) GetOrderBook(instr string) OrderBook {
+	return sim.obts[instr].GetOrderBook(sim.now).OrderBook
+}
+
+// OrderBookTS returns the historical orderbooks of instr loaded in the simulator
+func (sim ContractSimulator) OrderBookTS(instr string) OrderBookTS {
+	return sim.obts[instr]
+}
+
+// Transactions returns the historical trades of instr loaded in the simulator
+func (sim ContractSimulator) Transactions(instr string) Transactions {
+	return sim.txn[instr]
+}
+
+func (sim ContractSimulator) GetTransactionHistory(instr string) Transactions {
+	return sim.txn[instr].Between(sim.now.Add(-10*time.Minute), sim.now)
+}
+
+func (sim *ContractSimulator) SetFillModel(fm FillModel) {
+	sim.fillModel = fm
+}
+
+func (sim *ContractSimulator) SetLatency(l Latency) {
+	sim.latency = l
+}
+
+func (sim *ContractSimulator) SetFeeSchedule(fs FeeSchedule) {
+	sim.fees = fs
+}
+
+// SetFundingRates sets the funding rates accrued by the perpetual positions, as Simulator.SetFundingRates
+func (sim *ContractSimulator) SetFundingRates(rates FundingRates) {
+	sim.funding = append(FundingRates{}, rates...)
+	sim.funding.Sort()
+}
+
+// SetIndexPricer sets the index prices expired positions are settled against, as Simulator.SetIndexPricer
+func (sim *ContractSimulator) SetIndexPricer(ip IndexPricer) {
+	sim.index = ip
+}
+
+// Settlements returns the expired positions settled since the start
+func (sim ContractSimulator) Settlements() []ExpirySettlement {
+	return sim.settlements
+}
+
+// Unsettled returns the expired positions left unsettled for lack of an index price, as Simulator.Unsettled
+func (sim ContractSimulator) Unsettled() SettlementErrors {
+	return sim.unsettled
+}
+
+// SetTime moves the simulation to t, filling the live orders over the step, accruing funding and settling
+// expired positions
+func (sim *ContractSimulator) SetTime(t time.Time) {
+	for name := range sim.myOrders {
+		for i, myOrder := range sim.myOrders[name] {
+			if myOrder.Status != ALIVE {
+				continue
+			}
+			from := sim.now
+			if myOrder.LiveTime.After(from) {
+				from = myOrder.LiveTime
+			}
+			to := t
+			if !myOrder.CancelTime.IsZero() && myOrder.CancelTime.Before(to) {
+				to = myOrder.CancelTime
+			}
+			if from.Before(to) && len(sim.obts[name]) > 0 {
+				ob := sim.obts[name].GetOrderBook(from).OrderBook
+				taker := 0.0
+				if !myOrder.resting {
+					taker = math.Abs(ob.Match(Order{Amount: myOrder.Amount, Price: myOrder.Price}).Amount)
+					sim.myOrders[name][i].resting = true
+				}
+				fill := sim.fillModel.Fill(&sim.myOrders[name][i], ob, sim.obts[name].Between(from, to), sim.txn[name].Between(from, to))
+				if fill.Amount != 0.0 {
+					sim.applyFill(name, i, fill, math.Min(taker, math.Abs(fill.Amount)))
+				}
+			}
+			if sim.myOrders[name][i].Status == ALIVE && !myOrder.CancelTime.IsZero() && !myOrder.CancelTime.After(t) {
+				sim.myOrders[name][i].Status = CANCELLED
+			}
+		}
+	}
+	AccrueFunding(sim.myPortfolio, sim.funding.Between(sim.now, t))
+	if sim.index != nil {
+		settled, err := SettleExpired(sim.myPortfolio, t, sim.index)
+		sim.unsettled = recordUnsettled(sim.unsettled, settled, err)
+		sim.settlements = append(sim.settlements, settled...)
+	}
+	sim.last = sim.now
+	sim.now = t
+}
+
+// applyFill updates the i-th order of instr, the position and the settlement coin balance with a (partial) fill
+// of which takerAmount is filled as a taker, and charges the commission
+func (sim *ContractSimulator) applyFill(instr string, i int, fill Order, takerAmount float64) {
+	myOrder := sim.myOrders[instr][i]
+	if fill.Amount == myOrder.Amount {
+		sim.myOrders[instr][i].Status = FILLED
+	} else {
+		sim.myOrders[instr][i].Amount -= fill.Amount
+	}
+	sim.myOrders[instr][i].Filled += fill.Amount
+	sim.myOrders[instr][i].filledValue += math.Abs(fill.Amount) * fill.Price
+	c := sim.contracts[instr]
+	coin := c.SettleCoin()
+	pos, realised := sim.GetPosition(instr).Trade(fill.Amount, fill.Price)
+	sim.myPortfolio.AddBalance(coin, realised)
+	if c.IsOption() {
+		// the premium is paid in cash
+		sim.myPortfolio.AddBalance(coin, -fill.Amount*fill.Price)
+	}
+	makerAmount := math.Abs(fill.Amount) - takerAmount
+	commission := contractCommission(c, sim.fees.Rate(c.Underlying()), fill.Price, makerAmount, takerAmount)
+	sim.myPortfolio.RemoveBalance(coin, commission)
+	sim.myPortfolio.RemovePosition(c)
+	if pos.Qty() != 0 {
+		sim.myPortfolio.AddPosition(pos)
+	}
+	maker := Seller
+	if fill.Amount > 0 {
+		maker = Buyer
+	}
+	sim.myTransactions = append(sim.myTransactions, ContractTXN{
+		Instrument:      instr,
+		Price:           fill.Price,
+		Amount:          fill.Amount,
+		TimeStamp:       sim.now,
+		Maker:           maker,
+		TxnID:           fmt.Sprint(len(sim.myTransactions)),
+		OrderID:         myOrder.OrderID,
+		Commission:      commission,
+		CommissionAsset: coin,
+	})
+}
+
+// contractCommission returns the commission of a fill in the settlement coin. Futures pay the rates on their
+// notional and options on the underlying, capped at 12.5% of the premium as on Deribit
+func contractCommission(c *Contract, r FeeRate, price, makerAmount, takerAmount float64) float64 {
+	fee := math.Abs(makerAmount)*r.Maker + math.Abs(takerAmount)*r.Taker
+	if c.IsOption() {
+		return math.Min(fee, 0.125*price*(math.Abs(makerAmount)+math.Abs(takerAmount)))
+	}
+	return fee * NewPosition(c, 1, price).Notional(price)
+}
+
+// PlaceLimitOrder places an order on instr, positive amounts buy and negative amounts sell, in contracts for
+// futures and coins for options. The order is rejected with ErrInsufficientMargin if it adds to the initial
+// margin of its settlement coin beyond the equity
+func (sim *ContractSimulator) PlaceLimitOrder(instr string, price float64, amount float64) (string, error) {
+	c, ok := sim.contracts[instr]
+	if !ok {
+		return "", errors.New("unknown instrument " + instr)
+	}
+	price = c.RoundPrice(price)
+	coin := c.SettleCoin()
+	before := sim.requiredMargin(coin)
+
+	oid := fmt.Sprint(sim.oid)
+	live := sim.now.Add(sample(sim.latency.Entry))
+	order := SimOrder{
+		OrderID:   oid,
+		Price:     price,
+		Amount:    amount,
+		TimeStamp: sim.now,
+		LiveTime:  live,
+		AckTime:   live.Add(sample(sim.latency.Ack)),
+		Status:    ALIVE,
+	}
+	sim.myOrders[instr] = append(sim.myOrders[instr], order)
+	if after := sim.requiredMargin(coin); after > before && after > sim.Equity(coin) {
+		sim.myOrders[instr] = sim.myOrders[instr][:len(sim.myOrders[instr])-1]
+		return "", ErrInsufficientMargin
+	}
+	if len(sim.obts[instr]) > 0 {
+		sim.fillModel.Place(&sim.myOrders[instr][len(sim.myOrders[instr])-1], sim.obts[instr].GetOrderBook(live).OrderBook)
+	}
+	sim.oid++
+	return oid, nil
+}
+
+func (sim *ContractSimulator) CancelOrder(instr string, oid string) error {
+	cancelTime := sim.now.Add(sample(sim.latency.Cancel))
+	for i := range sim.myOrders[instr] {
+		o := &sim.myOrders[instr][i]
+		if o.OrderID == oid && o.Status == ALIVE {
+			if !cancelTime.After(sim.now) {
+				o.Status = CANCELLED
+			} else if o.CancelTime.IsZero() || cancelTime.Before(o.CancelTime) {
+				o.CancelTime = cancelTime
+			}
+		}
+	}
+	return nil
+}
+
+func (sim *ContractSimulator) CancelAllOrders(instr string) {
+	for _, o := range sim.myOrders[instr] {
+		if o.Status == ALIVE {
+			sim.CancelOrder(instr, o.OrderID)
+		}
+	}
+}
+
+// GetMyOrders returns the open orders of instr acknowledged by the exchange
+func (sim ContractSimulator) GetMyOrders(instr string) []OrderStatus {
+	var ostatus []OrderStatus
+	for _, o := range sim.myOrders[instr] {
+		if o.Status == ALIVE && !o.AckTime.After(sim.now) {
+			ostatus = append(ostatus, OrderStatus{
+				OrderID:     o.OrderID,
+				PlacedTime:  o.TimeStamp,
+				Side:        AmountToSide(o.Amount),
+				Instrument:  instr,
+				LeftAmount:  math.Abs(o.Amount),
+				PlacedPrice: o.Price,
+				Price:       o.Price,
+				State:       o.Status,
+			})
+		}
+	}
+	return ostatus
+}
+
+func (sim ContractSimulator) GetAccountOrders(instr string) []OrderStatus {
+	return sim.GetMyOrders(instr)
+}
+
+// GetOrderStatus returns the status of an order placed on instr, filled and cancelled orders included
+func (sim ContractSimulator) GetOrderStatus(oid string, instr string) (OrderStatus, error) {
+	for _, o := range sim.myOrders[instr] {
+		if o.OrderID == oid {
+			st := o.status(sim.now)
+			st.Instrument = instr
+			return st, nil
+		}
+	}
+	return OrderStatus{}, errors.New("order " + oid + " not found on " + instr)
+}
+
+// GetTrades returns all simulated trades
+func (sim ContractSimulator) GetTrades() ContractTXNs {
+	return sim.myTransactions
+}
+
+// GetMyTrades returns the simulated trades of instr between start and end, with commission
+func (sim ContractSimulator) GetMyTrades(instr string, start, end time.Time) ContractTXNs {
+	var txns ContractTXNs
+	for _, txn := range sim.myTransactions {
+		if txn.Instrument == instr && !txn.TimeStamp.Before(start) && !txn.TimeStamp.After(end) {
+			txns = append(txns, txn)
+		}
+	}
+	return txns
+}
+
+func (sim ContractSimulator) GetPortfolio() Portfolio {
+	return sim.myPortfolio
+}
+
+// GetPosition returns the position in instr, with zero quantity if there is none
+func (sim ContractSimulator) GetPosition(instr string) Position {
+	c := sim.contracts[instr]
+	for _, pos := range sim.myPortfolio.Positions() {
+		if pos.Contract.Equal(c) {
+			return pos
+		}
+	}
+	return NewPosition(c, 0.0, 0.0)
+}
+
+func (sim ContractSimulator) GetMakerFee(instr string) float64 {
+	return sim.fees.Rate(sim.contracts[instr].Underlying()).Maker
+}
+
+func (sim ContractSimulator) GetTakerFee(instr string) float64 {
+	return sim.fees.Rate(sim.contracts[instr].Underlying()).Taker
+}
+
+// mark returns the mid of the orderbook of instr, NaN if it is not two sided
+func (sim ContractSimulator) mark(instr string) float64 {
+	if len(sim.obts[instr]) == 0 {
+		return math.NaN()
+	}
+	ob := sim.GetOrderBook(instr)
+	if ob.OrderBookCore == nil || !ob.Valid() {
+		return math.NaN()
+	}
+	return ob.Mid()
+}
+
+// forward returns the price of the underlying of a contract, from its own book for futures, and for options
+// from the book of their future, the perpetual or the index, whichever is loaded. NaN if none is
+func (sim ContractSimulator) forward(c *Contract) float64 {
+	if !c.IsOption() {
+		return sim.mark(c.Name())
+	}
+	for _, u := range []*Contract{c.UnderFuture(), PerpContract(c.Underlying()), IndexContract(c.Underlying())} {
+		if f := sim.mark(u.Name()); !math.IsNaN(f) {
+			return f
+		}
+	}
+	return math.NaN()
+}
+
+// Equity returns the balance of a settlement coin plus the unrealised PnL of its futures and the value of its
+// options at the mids of their orderbooks
+func (sim ContractSimulator) Equity(coin Coin) float64 {
+	equity := sim.myPortfolio.Balance(coin)
+	for _, pos := range sim.myPortfolio.Positions() {
+		if pos.SettleCoin() != coin {
+			continue
+		}
+		mark := sim.mark(pos.Name())
+		if math.IsNaN(mark) {
+			continue
+		}
+		if pos.IsOption() {
+			equity += pos.Qty() * mark
+		} else {
+			equity += pos.SettlePnL(mark)
+		}
+	}
+	return equity
+}
+
+// Margins returns the initial and maintenance margins of the positions settled in coin
+func (sim ContractSimulator) Margins(coin Coin) (initial, maintenance float64) {
+	for name, c := range sim.contracts {
+		if c.SettleCoin() != coin {
+			continue
+		}
+		im, mm := sim.margins(name, sim.GetPosition(name).Qty())
+		initial += im
+		maintenance += mm
+	}
+	return
+}
+
+// AvailableMargin returns the equity of coin less the initial margin of the positions and open orders
+func (sim ContractSimulator) AvailableMargin(coin Coin) float64 {
+	return sim.Equity(coin) - sim.requiredMargin(coin)
+}
+
+// margins returns the margins of a position of qty in instr
+func (sim ContractSimulator) margins(instr string, qty float64) (initial, maintenance float64) {
+	c := sim.contracts[instr]
+	pos := sim.GetPosition(instr)
+	fwd := sim.forward(c)
+	if math.IsNaN(fwd) {
+		// no market, margin at the entry price or the strike
+		fwd = pos.Price()
+		if c.IsOption() || fwd == 0 {
+			fwd = c.Strike()
+		}
+	}
+	mark := 0.0
+	if c.IsOption() {
+		if m := sim.mark(instr); !math.IsNaN(m) {
+			mark = m
+		}
+	}
+	return NewPosition(c, qty, pos.Price()).MarginAtMark(fwd, mark)
+}
+
+// requiredMargin returns the initial margin of the positions settled in coin, each with all its open buys or
+// all its open sells filled, whichever needs more, and the premium of the open option buys
+func (sim ContractSimulator) requiredMargin(coin Coin) float64 {
+	required := 0.0
+	for name, c := range sim.contracts {
+		if c.SettleCoin() != coin {
+			continue
+		}
+		buys, sells, premium := 0.0, 0.0, 0.0
+		for _, o := range sim.myOrders[name] {
+			if o.Status != ALIVE {
+				continue
+			}
+			if o.Amount > 0 {
+				buys += o.Amount
+				if c.IsOption() {
+					premium += o.Amount * o.Price
+				}
+			} else {
+				sells += o.Amount
+			}
+		}
+		qty := sim.GetPosition(name).Qty()
+		im, _ := sim.margins(name, qty)
+		imBuy, _ := sim.margins(name, qty+buys)
+		imSell, _ := sim.margins(name, qty+sells)
+		required += math.Max(im, math.Max(imBuy+premium, imSell))
+	}
+	return required
+}
@@ -0,0 +1,147 @@
+package exchange
+
+import (
+	. "bean"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// FillModel decides how much of a resting order is filled as the simulator steps through time.
+// Swap the model of a simulator with SetFillModel to compare optimistic and pessimistic backtests.
+type FillModel interface {
+	Name() string
+	// Place is called when an order is placed, ob is the orderbook at the time
+	Place(o *SimOrder, ob OrderBook)
+	// Fill returns the signed amount filled and the average fill price of a resting order over a simulation step.
+	// ob is the orderbook at the start of the step, obs and txns are the orderbooks and transactions during the step
+	Fill(o *SimOrder, ob OrderBook, obs OrderBookTS, txns Transactions) Order
+}
+
+// TradeThroughFill fills the order against the immediate order book, and then against any
+// transaction traded through the order price
+type TradeThroughFill struct{}
+
+func (fm TradeThroughFill) Name() string {
+	return "TRADE_THROUGH"
+}
+
+func (fm TradeThroughFill) Place(o *SimOrder, ob OrderBook) {
+}
+
+func (fm TradeThroughFill) Fill(o *SimOrder, ob OrderBook, obs OrderBookTS, txns Transactions) Order {
+	// first see if the order can be filled against the immediate order book
+	obFill := ob.Match(Order{Amount: o.Amount, Price: o.Price})
+
+	txnFill := 0.0
+	if math.Abs(obFill.Amount-o.Amount) > 0.0 {
+		// if not then see if it can be filled against subsequent transactions
+		txnFill = txns.Fill(o.Price, o.Amount-obFill.Amount)
+	}
+	return combineFill(obFill, o.Price, txnFill)
+}
+
+// StrictFill only fills the order when the price trades strictly through it:
+// the opposite side of the orderbook has to cross the order price, touching it is not enough
+type StrictFill struct{}
+
+func (fm StrictFill) Name() string {
+	return "STRICT"
+}
+
+func (fm StrictFill) Place(o *SimOrder, ob OrderBook) {
+}
+
+func (fm StrictFill) Fill(o *SimOrder, ob OrderBook, obs OrderBookTS, txns Transactions) Order {
+	obFill := Order{Price: 0.0, Amount: 0.0}
+	if o.Amount > 0 && ob.BestAsk().Price < o.Price {
+		obFill = ob.Match(Order{Amount: o.Amount, Price: math.Nextafter(o.Price, 0)})
+	} else if o.Amount < 0 && ob.BestBid().Price > o.Price {
+		obFill = ob.Match(Order{Amount: o.Amount, Price: math.Nextafter(o.Price, math.Inf(1))})
+	}
+
+	txnFill := 0.0
+	if math.Abs(obFill.Amount-o.Amount) > 0.0 {
+		txnFill = txns.Fill(o.Price, o.Amount-obFill.Amount)
+	}
+	return combineFill(obFill, o.Price, txnFill)
+}
+
+// ProbFill fills the order against the crossing orderbook and trades through its price as TradeThroughFill does,
+// and in addition each trade at the order price fills it with probability Prob.
+// The random numbers are seeded so that a backtest can be reproduced
+type ProbFill struct {
+	Prob float64
+	seed int64
+	rng  *rand.Rand
+}
+
+func NewProbFill(prob float64, seed int64) *ProbFill {
+	return &ProbFill{
+		Prob: prob,
+		seed: seed,
+		rng:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (fm *ProbFill) Name() string {
+	return "PROB_" + strconv.FormatFloat(fm.Prob, 'f', -1, 64)
+}
+
+// Reseed restarts the random number sequence, e.g. before running the next backtest
+func (fm *ProbFill) Reseed() {
+	fm.rng = rand.New(rand.NewSource(fm.seed))
+}
+
+func (fm *ProbFill) Place(o *SimOrder, ob OrderBook) {
+}
+
+func (fm *ProbFill) Fill(o *SimOrder, ob OrderBook, obs OrderBookTS, txns Transactions) Order {
+	obFill := ob.Match(Order{Amount: o.Amount, Price: o.Price})
+	left := math.Abs(o.Amount - obFill.Amount)
+	txnFill := 0.0
+	for _, txn := range txns {
+		if left <= 0.0 {
+			break
+		}
+		if tradeThrough(txn, o.Price, o.Amount) || (tradeAt(txn, o.Price, o.Amount) && fm.rng.Float64() < fm.Prob) {
+			fill := math.Min(math.Abs(txn.Amount), left)
+			txnFill += fill
+			left -= fill
+		}
+	}
+	if o.Amount < 0 {
+		txnFill = -txnFill
+	}
+	return combineFill(obFill, o.Price, txnFill)
+}
+
+// combineFill adds up a fill against the orderbook and a fill against transactions at the order price
+func combineFill(obFill Order, price, txnFill float64) Order {
+	fillAmount := obFill.Amount + txnFill
+	if fillAmount == 0.0 {
+		return Order{Price: 0.0, Amount: 0.0}
+	}
+	fillPrice := (obFill.Price*obFill.Amount + price*txnFill) / fillAmount
+	return Order{Price: fillPrice, Amount: fillAmount}
+}
+
+// tradeThrough is true if the transaction traded strictly through the price of an order of the given amount
+func tradeThrough(txn Transaction, price, amount float64) bool {
+	if amount > 0 {
+		return txn.Price < price
+	}
+	return txn.Price > price
+}
+
+// tradeAt is true if the transaction traded at the price of an order of the given amount,
+// with the aggressor on the other side, i.e. hitting our bid or lifting our offer
+func tradeAt(txn Transaction, price, amount float64) bool {
+	if math.Abs(txn.Price-price) >= 1e-10 {
+		return false
+	}
+	if amount > 0 {
+		return txn.Maker == Buyer
+	}
+	return txn.Maker == Seller
+}
@@ -0,0 +1,104 @@
+package exchange
+
+import (
+	"math/rand"
+	"time"
+)
+
+// LatencyDist is a distribution of one way latencies
+type LatencyDist interface {
+	Sample() time.Duration
+}
+
+// FixedLatency always takes the same time
+type FixedLatency time.Duration
+
+func (l FixedLatency) Sample() time.Duration {
+	return time.Duration(l)
+}
+
+// UniformLatency is uniformly distributed between Min and Max
+type UniformLatency struct {
+	Min, Max time.Duration
+	seed     int64
+	rng      *rand.Rand
+}
+
+func NewUniformLatency(min, max time.Duration, seed int64) *UniformLatency {
+	return &UniformLatency{Min: min, Max: max, seed: seed, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (l *UniformLatency) Sample() time.Duration {
+	if l.Max <= l.Min {
+		return l.Min
+	}
+	return l.Min + time.Duration(l.rng.Int63n(int64(l.Max-l.Min)))
+}
+
+// Reseed restarts the random number sequence, e.g. before running the next backtest
+func (l *UniformLatency) Reseed() {
+	l.rng = rand.New(rand.NewSource(l.seed))
+}
+
+// NormalLatency is normally distributed, floored at zero
+type NormalLatency struct {
+	Mean, Stdev time.Duration
+	seed        int64
+	rng         *rand.Rand
+}
+
+func NewNormalLatency(mean, stdev time.Duration, seed int64) *NormalLatency {
+	return &NormalLatency{Mean: mean, Stdev: stdev, seed: seed, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (l *NormalLatency) Sample() time.Duration {
+	d := l.Mean + time.Duration(l.rng.NormFloat64()*float64(l.Stdev))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Reseed restarts the random number sequence, e.g. before running the next backtest
+func (l *NormalLatency) Reseed() {
+	l.rng = rand.New(rand.NewSource(l.seed))
+}
+
+// Latency holds the one way latencies of an exchange, a nil distribution means no delay
+type Latency struct {
+	Entry  LatencyDist // from sending an order to it becoming live on the exchange
+	Ack    LatencyDist // from the order becoming live to us seeing it in our open orders
+	Cancel LatencyDist // from sending a cancel to it taking effect on the exchange
+}
+
+func sample(l LatencyDist) time.Duration {
+	if l == nil {
+		return 0
+	}
+	return l.Sample()
+}
+
+// cloneDist gives a distribution its own random number generator, so that simulators can run concurrently
+func cloneDist(l LatencyDist) LatencyDist {
+	switch d := l.(type) {
+	case *UniformLatency:
+		return NewUniformLatency(d.Min, d.Max, d.seed)
+	case *NormalLatency:
+		return NewNormalLatency(d.Mean, d.Stdev, d.seed)
+	default:
+		return l
+	}
+}
+
+func (l Latency) clone() Latency {
+	return Latency{Entry: cloneDist(l.Entry), Ack: cloneDist(l.Ack), Cancel: cloneDist(l.Cancel)}
+}
+
+// reseed restarts the random distributions, so that every run samples the same latencies
+func (l Latency) reseed() {
+	for _, d := range []LatencyDist{l.Entry, l.Ack, l.Cancel} {
+		if r, ok := d.(interface{ Reseed() }); ok {
+			r.Reseed()
+		}
+	}
+}
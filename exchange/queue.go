@@ -0,0 +1,79 @@
+package exchange
+
+import (
+	. "bean"
+	"math"
+)
+
+// QueueFill is a queue position aware fill model.
+// A resting order joins the back of its price level. It is only filled once the amount sitting ahead of it
+// at that level is used up, either by trades at the level or by cancellations seen in the orderbook snapshots.
+// Trades through the order price fill it regardless of the queue.
+type QueueFill struct{}
+
+func (fm QueueFill) Name() string {
+	return "QUEUE"
+}
+
+// Place records the amount resting ahead of the order when it joins the level
+func (fm QueueFill) Place(o *SimOrder, ob OrderBook) {
+	o.QueueAhead = levelAmount(ob, o.Price, o.Amount)
+}
+
+// Fill returns the fill of a resting order over the step, and updates the queue ahead of the order
+func (fm QueueFill) Fill(o *SimOrder, ob OrderBook, obs OrderBookTS, txns Transactions) Order {
+	// first see if the book has crossed the order, in which case we are filled at the book prices
+	obFill := ob.Match(Order{Amount: o.Amount, Price: o.Price})
+	left := math.Abs(o.Amount - obFill.Amount)
+	txnFill := 0.0
+
+	k := 0
+	for _, txn := range txns {
+		// cancellations ahead of us shrink the queue, new orders join behind us
+		for ; k < len(obs) && !obs[k].Time.After(txn.TimeStamp); k++ {
+			o.QueueAhead = math.Min(o.QueueAhead, levelAmount(obs[k].OrderBook, o.Price, o.Amount))
+		}
+		if left <= 0.0 {
+			break
+		}
+		amt := math.Abs(txn.Amount)
+		if tradeThrough(txn, o.Price, o.Amount) {
+			// the whole level has been taken out
+			o.QueueAhead = 0.0
+			fill := math.Min(amt, left)
+			txnFill += fill
+			left -= fill
+		} else if tradeAt(txn, o.Price, o.Amount) {
+			used := math.Min(amt, o.QueueAhead)
+			o.QueueAhead -= used
+			fill := math.Min(amt-used, left)
+			txnFill += fill
+			left -= fill
+		}
+	}
+	for ; k < len(obs); k++ {
+		o.QueueAhead = math.Min(o.QueueAhead, levelAmount(obs[k].OrderBook, o.Price, o.Amount))
+	}
+
+	if o.Amount < 0 {
+		txnFill = -txnFill
+	}
+	return combineFill(obFill, o.Price, txnFill)
+}
+
+// levelAmount returns the amount resting at the price level an order of the given amount joins
+func levelAmount(ob OrderBook, price, amount float64) float64 {
+	if ob.OrderBookCore == nil {
+		return 0.0
+	}
+	stack := ob.Asks()
+	if amount > 0 {
+		stack = ob.Bids()
+	}
+	for _, o := range stack {
+		if math.Abs(o.Price-price) < 1e-10 {
+			return o.Amount
+		}
+	}
+	return 0.0
+}
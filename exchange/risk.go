@@ -0,0 +1,210 @@
+package exchange
+
+import (
+	. "bean"
+	"bean/logger"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the checks of RiskGate, rejected orders return a *RiskError wrapping one of them
+var (
+	ErrKillSwitch   = errors.New("kill switch is on")
+	ErrMaxNotional  = errors.New("order notional above limit")
+	ErrMaxPosition  = errors.New("position above limit")
+	ErrPriceCollar  = errors.New("price outside collar")
+	ErrNoReference  = errors.New("no reference price for the collar")
+	ErrRateExceeded = errors.New("order rate above limit")
+)
+
+// RiskError is the rejection of an order by RiskGate, use errors.Is to find which check failed
+type RiskError struct {
+	Err    error
+	Pair   Pair
+	Price  float64
+	Amount float64
+	Value  float64 // what was checked, e.g. the notional of the order
+	Limit  float64
+}
+
+func (e *RiskError) Error() string {
+	return fmt.Sprintf("%s %s %g@%g rejected: %v (%g, limit %g)", e.Pair, sideOf(e.Amount), math.Abs(e.Amount), e.Price,
+		e.Err, e.Value, e.Limit)
+}
+
+func (e *RiskError) Unwrap() error {
+	return e.Err
+}
+
+func sideOf(amount float64) Side {
+	if amount < 0 {
+		return SELL
+	}
+	return BUY
+}
+
+// RiskLimits are the pre-trade limits of RiskGate, a zero limit is not checked
+type RiskLimits struct {
+	MaxNotional     float64          // max price times amount of an order, in the base coin
+	MaxPosition     map[Coin]float64 // max absolute balance of a coin once the order and the open ones on its side fill
+	MaxDeviation    float64          // max relative distance of the price from the mid, e.g. 0.05 for 5%
+	MaxOrdersPerSec int              // max orders placed in any second
+}
+
+var globalKill int32
+
+// KillAll stops every RiskGate placing orders until ResumeAll
+func KillAll() {
+	atomic.StoreInt32(&globalKill, 1)
+	logger.Warn().Msg("global kill switch on")
+}
+
+// ResumeAll turns the global kill switch off, gates killed on their own stay killed
+func ResumeAll() {
+	atomic.StoreInt32(&globalKill, 0)
+	logger.Info().Msg("global kill switch off")
+}
+
+// RiskGate wraps an Exchange and checks every order against its limits before it reaches the venue.
+// Other calls, cancels included, go straight to the exchange. The gate places orders with PlaceLimitOrder only,
+// so brew.PerformActions emulates order lives and amends through it rather than bypassing the checks
+type RiskGate struct {
+	Exchange
+	limits RiskLimits
+	killed int32
+	mu     sync.Mutex
+	placed []time.Time // placed times within the last second
+}
+
+func NewRiskGate(ex Exchange, limits RiskLimits) *RiskGate {
+	return &RiskGate{Exchange: ex, limits: limits}
+}
+
+// Limits returns the limits of the gate
+func (g *RiskGate) Limits() RiskLimits {
+	return g.limits
+}
+
+// Kill stops the gate placing orders until Resume
+func (g *RiskGate) Kill() {
+	atomic.StoreInt32(&g.killed, 1)
+	logger.Warn().Str("exchange", g.Name()).Msg("kill switch on")
+}
+
+func (g *RiskGate) Resume() {
+	atomic.StoreInt32(&g.killed, 0)
+	logger.Info().Str("exchange", g.Name()).Msg("kill switch off")
+}
+
+// Killed returns true if either the gate or the global kill switch is on
+func (g *RiskGate) Killed() bool {
+	return atomic.LoadInt32(&g.killed) == 1 || atomic.LoadInt32(&globalKill) == 1
+}
+
+// Check runs the checks of the gate on an order without placing it, the rate limit excepted
+func (g *RiskGate) Check(pair Pair, price, amount float64) error {
+	reject := func(err error, value, limit float64) error {
+		return &RiskError{Err: err, Pair: pair, Price: price, Amount: amount, Value: value, Limit: limit}
+	}
+	if g.Killed() {
+		return reject(ErrKillSwitch, 0, 0)
+	}
+	l := g.limits
+	if notional := math.Abs(price * amount); l.MaxNotional > 0 && notional > l.MaxNotional {
+		return reject(ErrMaxNotional, notional, l.MaxNotional)
+	}
+	if limit, ok := l.MaxPosition[pair.Coin]; ok {
+		pos := g.GetPortfolio().Balance(pair.Coin) + amount + g.openAmount(pair, sideOf(amount))
+		if math.Abs(pos) > limit {
+			return reject(ErrMaxPosition, pos, limit)
+		}
+	}
+	if l.MaxDeviation > 0 {
+		mid := g.mid(pair)
+		if math.IsNaN(mid) || mid <= 0 {
+			return reject(ErrNoReference, mid, l.MaxDeviation)
+		}
+		if dev := math.Abs(price/mid - 1); dev > l.MaxDeviation {
+			return reject(ErrPriceCollar, dev, l.MaxDeviation)
+		}
+	}
+	return nil
+}
+
+// openAmount returns the signed amount left of the open orders of pair on side, which the position reaches
+// if they all fill
+func (g *RiskGate) openAmount(pair Pair, side Side) float64 {
+	open := 0.0
+	for _, o := range g.GetMyOrders(pair) {
+		if o.Side != side {
+			continue
+		}
+		if side == SELL {
+			open -= o.LeftAmount
+		} else {
+			open += o.LeftAmount
+		}
+	}
+	return open
+}
+
+// mid is the reference price of the collar, from the orderbook or the ticker if the orderbook is empty
+func (g *RiskGate) mid(pair Pair) float64 {
+	if ob := g.GetOrderBook(pair); ob.OrderBookCore != nil && ob.Valid() {
+		return ob.Mid()
+	}
+	if t, ok := g.ticker(pair); ok && t.BestBid > 0 && t.BestAsk > 0 {
+		return (t.BestBid + t.BestAsk) / 2.0
+	}
+	return math.NaN()
+}
+
+// ticker returns the ticker of pair, false if it fails or the exchange has none, e.g. the simulator panics
+func (g *RiskGate) ticker(pair Pair) (t Ticker, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	t, err := g.GetTicker(pair)
+	return t, err == nil
+}
+
+// throttle records an order placed now, unless the orders placed within the last second reach the limit
+func (g *RiskGate) throttle(now time.Time) (int, bool) {
+	if g.limits.MaxOrdersPerSec <= 0 {
+		return 0, true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	i := 0
+	for i < len(g.placed) && now.Sub(g.placed[i]) >= time.Second {
+		i++
+	}
+	g.placed = g.placed[i:]
+	if len(g.placed) >= g.limits.MaxOrdersPerSec {
+		return len(g.placed), false
+	}
+	g.placed = append(g.placed, now)
+	return len(g.placed), true
+}
+
+// PlaceLimitOrder places the order on the exchange if it passes the checks, otherwise returns a *RiskError
+func (g *RiskGate) PlaceLimitOrder(pair Pair, price float64, amount float64) (string, error) {
+	err := g.Check(pair, price, amount)
+	if err == nil {
+		if n, ok := g.throttle(time.Now()); !ok {
+			err = &RiskError{Err: ErrRateExceeded, Pair: pair, Price: price, Amount: amount, Value: float64(n),
+				Limit: float64(g.limits.MaxOrdersPerSec)}
+		}
+	}
+	if err != nil {
+		logger.Warn().Str("exchange", g.Name()).Msg(err.Error())
+		return "", err
+	}
+	return g.Exchange.PlaceLimitOrder(pair, price, amount)
+}
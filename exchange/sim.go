@@ -3,6 +3,9 @@ package exchange
 import (
 	. "bean"
 	"bean/db/mds"
+	"bean/logger"
+	util "bean/utils"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
@@ -21,11 +24,18 @@ type Simulator struct {
 	// simulated actions and deals
 	myActions []TradeActionT
 	// to review
-	myOrders map[Pair]([]simOrder)
+	myOrders map[Pair]([]SimOrder)
 	// consider using a list of orderstatus
 	myTransactions []Transaction
 	oid            int
 	myPortfolio    Portfolio
+	fillModel      FillModel
+	latency        Latency
+	fees           FeeSchedule
+	funding        FundingRates // of the perpetual positions in the portfolio
+	index          IndexPricer  // settles expired positions, none are settled if nil
+	settlements    []ExpirySettlement
+	unsettled      SettlementErrors // expired positions left for lack of an index price
 }
 
 func NewSimulator(exName string, pairs []Pair, dbhost, dbport string, start, end time.Time, initPortfolio Portfolio) Simulator {
@@ -33,26 +43,60 @@ func NewSimulator(exName string, pairs []Pair, dbhost, dbport string, start, end
 	// mds := mds.NewMDS(exName, dbhost, dbport)
 	// FIXME: be able to pass exName to RPC MDS, right now we only use Binance
 	// mds := bean.NewRPCMDSConnC("tcp", dbhost+":"+dbport)
+	// served from the local cache, only the missing ranges are fetched from MDS
+	cache := mds.NewCache(mds.CacheDir(), nil)
+	defer cache.Close()
+	return NewSimulatorFrom(cache, exName, pairs, start, end, initPortfolio)
+}
+
+// NewSimulatorFrom creates a simulator with the historical data of exName from src, e.g. a mds.FileSource
+func NewSimulatorFrom(src mds.Source, exName string, pairs []Pair, start, end time.Time, initPortfolio Portfolio) Simulator {
 	// get historical data
 	obts := make(map[Pair]OrderBookTS, len(pairs))
 	fmt.Println(exName)
-	mds, err := mds.ConnectService()
-	if err != nil {
-		panic("failed connecting to MDS" + err.Error())
-	}
+	var err error
 	for _, p := range pairs {
 		// obts[p], _ = mds.GetOrderBookTS(p, start, end, 20) // TODO: hard code 20 depth for now
-		obts[p], _ = mds.GetOrderBookTS2(exName, p, start, end) // TODO: hard code 20 depth for now
+		obts[p], err = src.GetOrderBookTS2(exName, p, start, end) // TODO: hard code 20 depth for now
+		if err != nil {
+			panic("failed loading orderbooks " + err.Error())
+		}
 		//		obts[p].ShowBrief()
 	}
 	txn := make(map[Pair]Transactions, len(pairs))
 	for _, p := range pairs {
-		txn[p], _ = mds.GetTransactions2(exName, p, start, end)
+		txn[p], err = src.GetTransactions2(exName, p, start, end)
+		if err != nil {
+			panic("failed loading transactions " + err.Error())
+		}
+	}
+	// funding of the perpetual positions, if the source has funding rates
+	var funding FundingRates
+	if fs, ok := src.(mds.FundingSource); ok && initPortfolio != nil {
+		for _, pos := range initPortfolio.Positions() {
+			if !pos.Perp() {
+				continue
+			}
+			rates, err := fs.GetFundingRates(exName, pos.Name(), start, end)
+			if err != nil {
+				panic("failed loading funding rates " + err.Error())
+			}
+			funding = append(funding, rates...)
+		}
+		funding.Sort()
+	}
+	// fee schedule from config, fall back to a flat 0.1% if not configured
+	fees, err := GetFeeSchedule(exName)
+	if err == ErrNoFeeSchedule {
+		fees = FeeSchedule{Default: FeeRate{Maker: 0.001, Taker: 0.001}}
+		logger.Warn().Str("exchange", exName).Msg("no fee schedule, charging 0.1% until SetFeeSchedule")
+	} else if err != nil {
+		panic("failed loading fee schedule " + err.Error())
 	}
 	// construct exSim
-	myOrders := make(map[Pair]([]simOrder))
+	myOrders := make(map[Pair]([]SimOrder))
 	for _, p := range pairs {
-		myOrders[p] = make([]simOrder, 0)
+		myOrders[p] = make([]SimOrder, 0)
 	}
 	return Simulator{
 		exName:      exName,
@@ -62,6 +106,9 @@ func NewSimulator(exName string, pairs []Pair, dbhost, dbport string, start, end
 		myOrders:    myOrders,
 		oid:         0,
 		myPortfolio: initPortfolio,
+		fillModel:   TradeThroughFill{},
+		fees:        fees,
+		funding:     funding,
 	}
 }
 
@@ -69,24 +116,70 @@ func NewSimulator(exName string, pairs []Pair, dbhost, dbport string, start, end
 func (sim *Simulator) Reset(start time.Time, initPortfolio Portfolio) {
 	// clear my orders
 	for p, _ := range sim.myOrders {
-		sim.myOrders[p] = make([]simOrder, 0)
+		sim.myOrders[p] = make([]SimOrder, 0)
 	}
 	sim.oid = 0
 	sim.myPortfolio = initPortfolio
 	sim.now = start
 	sim.myActions = make([]TradeActionT, 0)
 	sim.myTransactions = make([]Transaction, 0)
+	sim.settlements = nil
+	sim.unsettled = nil
+	// replay the same random fills and latencies for every run
+	if fm, ok := sim.fillModel.(*ProbFill); ok {
+		fm.Reseed()
+	}
+	sim.latency.reseed()
+}
+
+// Clone returns a simulator with its own copy of the historical data, reset to start with initPortfolio.
+// Clones can run concurrently, e.g. for a parameter sweep
+func (sim Simulator) Clone(start time.Time, initPortfolio Portfolio) Simulator {
+	c := sim
+	c.obts = make(map[Pair]OrderBookTS, len(sim.obts))
+	for p, obts := range sim.obts {
+		c.obts[p] = obts.Clone()
+	}
+	c.txn = make(map[Pair]Transactions, len(sim.txn))
+	for p, txn := range sim.txn {
+		c.txn[p] = append(Transactions{}, txn...)
+	}
+	c.myOrders = make(map[Pair]([]SimOrder), len(sim.myOrders))
+	for p := range sim.myOrders {
+		c.myOrders[p] = make([]SimOrder, 0)
+	}
+	if fm, ok := sim.fillModel.(*ProbFill); ok {
+		c.fillModel = NewProbFill(fm.Prob, fm.seed)
+	}
+	c.latency = sim.latency.clone()
+	c.Reset(start, initPortfolio)
+	return c
 }
 
 func (sim Simulator) Name() string {
 	return sim.exName
 }
 
+// Now returns the simulated time
+func (sim Simulator) Now() time.Time {
+	return sim.now
+}
+
 func (sim Simulator) GetOrderBook(pair Pair) OrderBook {
 	ob := sim.obts[pair].GetOrderBook(sim.now).OrderBook
 	return ob
 }
 
+// OrderBookTS returns the historical orderbooks of pair loaded in the simulator
+func (sim Simulator) OrderBookTS(pair Pair) OrderBookTS {
+	return sim.obts[pair]
+}
+
+// Transactions returns the historical transactions of pair loaded in the simulator
+func (sim Simulator) Transactions(pair Pair) Transactions {
+	return sim.txn[pair]
+}
+
 func (sim Simulator) GetTransactionHistory(pair Pair) Transactions {
 	return sim.txn[pair].Between(sim.now.Add(-10*time.Minute), sim.now) // exchanges typically give about 10mins of trade data
 }
@@ -95,67 +188,218 @@ func (sim *Simulator) SetTime(t time.Time) {
 	// update now
 	for p := range sim.myOrders {
 		for i, myOrder := range sim.myOrders[p] {
-			if myOrder.status == ALIVE {
-				// first see if the order can be filled against the immediate order book
-				obFill := sim.GetOrderBook(p).Match(Order{Amount: myOrder.amount, Price: myOrder.price})
-
-				txnFill := 0.0
-				if math.Abs(obFill.Amount-myOrder.amount) > 0.0 {
-					// if not then see if it can be filled against subsequent transactions
-					recentTxn := sim.txn[p].Between(sim.now, t)
-					txnFill = recentTxn.Fill(myOrder.price, myOrder.amount-obFill.Amount)
+			if myOrder.Status == ALIVE {
+				// the order can only be filled between reaching the exchange and its cancel taking effect
+				from := sim.now
+				if myOrder.LiveTime.After(from) {
+					from = myOrder.LiveTime
 				}
-
-				fillAmount := obFill.Amount + txnFill
-				fillPrice := (obFill.Price*obFill.Amount + myOrder.price*txnFill) / fillAmount
-
-				// determine if recentTxn crosses the order - updated for partial fills
-				if fillAmount != 0.0 {
-					if fillAmount == myOrder.amount {
-						sim.myOrders[p][i].status = FILLED
-					} else {
-						sim.myOrders[p][i].amount -= fillAmount
-					}
-					// add it to myTransactions
-					var maker TraderType
-					if fillAmount > 0 {
-						maker = Buyer
-						currentLockedBase := sim.myPortfolio.Balance(p.Base) - sim.myPortfolio.AvailableBalance(p.Base)
-						sim.myPortfolio.SetLockedBalance(p.Base, currentLockedBase-math.Abs(fillAmount)*fillPrice)
-					} else {
-						maker = Seller
-						currentLockedCoin := sim.myPortfolio.Balance(p.Coin) - sim.myPortfolio.AvailableBalance(p.Coin)
-						sim.myPortfolio.SetLockedBalance(p.Coin, currentLockedCoin-math.Abs(fillAmount))
+				to := t
+				if !myOrder.CancelTime.IsZero() && myOrder.CancelTime.Before(to) {
+					to = myOrder.CancelTime
+				}
+				if from.Before(to) {
+					ob := sim.obts[p].GetOrderBook(from).OrderBook
+					taker := 0.0
+					if !myOrder.resting {
+						// whatever crosses the book on arrival is filled as a taker, the rest rests as a maker
+						taker = math.Abs(ob.Match(Order{Amount: myOrder.Amount, Price: myOrder.Price}).Amount)
+						sim.myOrders[p][i].resting = true
 					}
-					sim.myPortfolio.AddBalance(p.Coin, fillAmount)
-					sim.myPortfolio.AddBalance(p.Base, -fillAmount*fillPrice)
-					newTxn := Transaction{
-						Pair:      p,
-						Price:     fillPrice,
-						Amount:    fillAmount,
-						TimeStamp: sim.now,
-						Maker:     maker,
-						TxnID:     fmt.Sprint(len(sim.myTransactions)),
+					fill := sim.fillModel.Fill(&sim.myOrders[p][i], ob, sim.obts[p].Between(from, to), sim.txn[p].Between(from, to))
+					// determine if recentTxn crosses the order - updated for partial fills
+					if fill.Amount != 0.0 {
+						sim.applyFill(p, i, fill, math.Min(taker, math.Abs(fill.Amount)))
 					}
-					sim.myTransactions = append(sim.myTransactions, newTxn)
-
+				}
+				if sim.myOrders[p][i].Status == ALIVE && !myOrder.CancelTime.IsZero() && !myOrder.CancelTime.After(t) {
+					sim.cancel(p, i)
 				}
 			}
 		}
 	}
+	// perpetual positions receive or pay funding at each funding timestamp passed
+	AccrueFunding(sim.myPortfolio, sim.funding.Between(sim.now, t))
+	if sim.index != nil {
+		settled, err := SettleExpired(sim.myPortfolio, t, sim.index)
+		sim.unsettled = recordUnsettled(sim.unsettled, settled, err)
+		sim.settlements = append(sim.settlements, settled...)
+	}
 	sim.last = sim.now
 	sim.now = t
 }
 
-type simOrder struct {
-	oid       string
-	price     float64
-	amount    float64
-	status    OrderState
-	timeStamp time.Time
+// SetFillModel sets the model deciding how resting orders are filled, TradeThroughFill by default
+func (sim *Simulator) SetFillModel(fm FillModel) {
+	sim.fillModel = fm
+}
+
+// SetLatency sets the one way latencies for order entry, acks and cancels, no delay by default
+func (sim *Simulator) SetLatency(l Latency) {
+	sim.latency = l
+}
+
+// SetFeeSchedule overrides the fee schedule loaded from the config
+func (sim *Simulator) SetFeeSchedule(fs FeeSchedule) {
+	sim.fees = fs
+}
+
+// SetFundingRates sets the funding rates accrued by the perpetual positions of the portfolio, e.g. from
+// MDS.GetFundingRates
+func (sim *Simulator) SetFundingRates(rates FundingRates) {
+	sim.funding = append(FundingRates{}, rates...)
+	sim.funding.Sort()
+}
+
+// SetIndexPricer sets the index prices that expired options and futures of the portfolio are settled against,
+// e.g. a mds.MDS
+func (sim *Simulator) SetIndexPricer(ip IndexPricer) {
+	sim.index = ip
+}
+
+// Settlements returns the expired positions settled since the start
+func (sim Simulator) Settlements() []ExpirySettlement {
+	return sim.settlements
+}
+
+// Unsettled returns the expired positions which could not be settled for lack of an index price, they stay in
+// the portfolio and are settled once their index price is found
+func (sim Simulator) Unsettled() SettlementErrors {
+	return sim.unsettled
+}
+
+// recordUnsettled drops the positions settled from unsettled and adds those SettleExpired could not settle,
+// logging each of them once
+func recordUnsettled(unsettled SettlementErrors, settled []ExpirySettlement, err error) SettlementErrors {
+	var left SettlementErrors
+	for _, u := range unsettled {
+		done := false
+		for _, s := range settled {
+			if s.Position.Name() == u.Position.Name() {
+				done = true
+				break
+			}
+		}
+		if !done {
+			left = append(left, u)
+		}
+	}
+	unsettled = left
+	errs, _ := err.(SettlementErrors)
+	for _, e := range errs {
+		seen := false
+		for _, u := range unsettled {
+			if u.Position.Name() == e.Position.Name() {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			logger.Warn().Str("instrument", e.Position.Name()).Msg(e.Error())
+			unsettled = append(unsettled, e)
+		}
+	}
+	return unsettled
+}
+
+// FillModel returns the fill model used by the simulator
+func (sim Simulator) FillModel() FillModel {
+	return sim.fillModel
+}
+
+// applyFill updates the i-th order of pair p, the portfolio and my transactions with a (partial) fill
+// of which takerAmount is filled as a taker, and charges the commission
+func (sim *Simulator) applyFill(p Pair, i int, fill Order, takerAmount float64) {
+	fillAmount := fill.Amount
+	fillPrice := fill.Price
+	myOrder := sim.myOrders[p][i]
+	if fillAmount == myOrder.Amount {
+		sim.myOrders[p][i].Status = FILLED
+	} else {
+		sim.myOrders[p][i].Amount -= fillAmount
+	}
+	sim.myOrders[p][i].Filled += fillAmount
+	sim.myOrders[p][i].filledValue += math.Abs(fillAmount) * fillPrice
+	// add it to myTransactions
+	var maker TraderType
+	if fillAmount > 0 {
+		maker = Buyer
+		currentLockedBase := sim.myPortfolio.Balance(p.Base) - sim.myPortfolio.AvailableBalance(p.Base)
+		sim.myPortfolio.SetLockedBalance(p.Base, currentLockedBase-math.Abs(fillAmount)*fillPrice)
+	} else {
+		maker = Seller
+		currentLockedCoin := sim.myPortfolio.Balance(p.Coin) - sim.myPortfolio.AvailableBalance(p.Coin)
+		sim.myPortfolio.SetLockedBalance(p.Coin, currentLockedCoin-math.Abs(fillAmount))
+	}
+	sim.myPortfolio.AddBalance(p.Coin, fillAmount)
+	sim.myPortfolio.AddBalance(p.Base, -fillAmount*fillPrice)
+	makerAmount := math.Abs(fillAmount) - takerAmount
+	commission, commissionAsset := sim.fees.Rate(p).Commission(p, fillPrice, util.Sign(fillAmount)*makerAmount, util.Sign(fillAmount)*takerAmount)
+	sim.myPortfolio.RemoveBalance(commissionAsset, commission)
+	newTxn := Transaction{
+		Pair:            p,
+		Price:           fillPrice,
+		Amount:          fillAmount,
+		TimeStamp:       sim.now,
+		Maker:           maker,
+		TxnID:           fmt.Sprint(len(sim.myTransactions)),
+		OrderID:         myOrder.OrderID,
+		Commission:      commission,
+		CommissionAsset: commissionAsset,
+	}
+	sim.myTransactions = append(sim.myTransactions, newTxn)
+}
+
+// SimOrder is an order resting in the simulator
+type SimOrder struct {
+	OrderID    string
+	Price      float64
+	Amount     float64 // amount left, positive for buy and negative for sell
+	Status     OrderState
+	TimeStamp  time.Time // time the order is sent
+	LiveTime   time.Time // time the order becomes live on the exchange
+	AckTime    time.Time // time we see the order in our open orders
+	CancelTime time.Time // time a pending cancel takes effect, zero if there is none
+	QueueAhead float64   // amount resting ahead of the order at its price level
+	Filled     float64   // amount filled, signed as Amount
+	resting    bool      // true once the order has been matched on arrival
+
+	filledValue float64 // sum of the filled amounts times their prices
+}
+
+// status reports the order as an exchange would at now: NEW until acknowledged, PARTIAL once partially filled,
+// with the average fill price as Price
+func (o SimOrder) status(now time.Time) OrderStatus {
+	os := OrderStatus{
+		OrderID:      o.OrderID,
+		PlacedTime:   o.TimeStamp,
+		Side:         AmountToSide(o.Amount),
+		FilledAmount: math.Abs(o.Filled),
+		LeftAmount:   math.Abs(o.Amount),
+		PlacedPrice:  o.Price,
+		Price:        o.Price,
+		State:        o.Status,
+	}
+	if o.Filled != 0 {
+		os.Price = o.filledValue / math.Abs(o.Filled)
+	}
+	switch {
+	case o.Status == FILLED:
+		os.LeftAmount = 0.0
+	case o.Status == ALIVE && o.AckTime.After(now):
+		os.State = NEW
+	case o.Status == ALIVE && o.Filled != 0:
+		os.State = PARTIAL
+	}
+	return os
 }
 
 func (sim *Simulator) PlaceLimitOrder(pair Pair, price_ float64, amount float64) (string, error) {
+	return sim.placeLimitOrder(pair, price_, amount, sim.now.Add(sample(sim.latency.Entry)))
+}
+
+// placeLimitOrder places an order reaching the exchange at live
+func (sim *Simulator) placeLimitOrder(pair Pair, price_ float64, amount float64, live time.Time) (string, error) {
 	price, _ := strconv.ParseFloat(pair.OrderPricePrec(price_), 64)
 	// record the action
 	act := TradeActionT{
@@ -164,14 +408,19 @@ func (sim *Simulator) PlaceLimitOrder(pair Pair, price_ float64, amount float64)
 	}
 	sim.myActions = append(sim.myActions, act)
 
-	// add a live order in to myOrders
+	// add a live order in to myOrders, it can only be filled once it reaches the exchange
 	oid := fmt.Sprint(sim.oid)
-	order := simOrder{
-		oid:       oid,
-		price:     price,
-		amount:    amount,
-		timeStamp: sim.now,
-		status:    ALIVE,
+	order := SimOrder{
+		OrderID:   oid,
+		Price:     price,
+		Amount:    amount,
+		TimeStamp: sim.now,
+		LiveTime:  live,
+		AckTime:   live.Add(sample(sim.latency.Ack)),
+		Status:    ALIVE,
+	}
+	if len(sim.obts[pair]) > 0 {
+		sim.fillModel.Place(&order, sim.obts[pair].GetOrderBook(live).OrderBook)
 	}
 	sim.myOrders[pair] = append(sim.myOrders[pair], order)
 	sim.oid++
@@ -187,6 +436,33 @@ func (sim *Simulator) PlaceLimitOrder(pair Pair, price_ float64, amount float64)
 	return oid, nil
 }
 
+// PlaceOrder places an order with a life and flags, checked with LimitParams.Check against the coin balance and
+// the orderbook it meets on arrival, which is the one it is matched against with latency.
+// Immediate-or-cancel and fill-or-kill orders are only matched on arrival, then cancelled
+func (sim *Simulator) PlaceOrder(pair Pair, p LimitParams) (string, error) {
+	live := sim.now.Add(sample(sim.latency.Entry))
+	var ob OrderBook
+	if len(sim.obts[pair]) > 0 {
+		ob = sim.obts[pair].GetOrderBook(live).OrderBook
+	}
+	amount, err := p.Check(ob, sim.myPortfolio.Balance(pair.Coin))
+	if err != nil {
+		return "", err
+	}
+	oid, err := sim.placeLimitOrder(pair, p.Price, amount, live)
+	if err != nil {
+		return oid, err
+	}
+	p.Amount = amount
+	sim.myActions[len(sim.myActions)-1].Action = LimitOrderAction(sim.exName, pair, p)
+	if p.OrderLife() == GoodTillCancelled {
+		return oid, err
+	}
+	o := &sim.myOrders[pair][len(sim.myOrders[pair])-1]
+	o.CancelTime = o.LiveTime.Add(time.Nanosecond)
+	return oid, nil
+}
+
 func (sim *Simulator) CancelOrder(pair Pair, oid string) error {
 	// record the action
 	act := TradeActionT{
@@ -195,17 +471,14 @@ func (sim *Simulator) CancelOrder(pair Pair, oid string) error {
 	}
 	sim.myActions = append(sim.myActions, act)
 
-	// mark the live order as cancelled
+	// mark the live order as cancelled once the cancel reaches the exchange, it can still be filled until then
+	cancelTime := sim.now.Add(sample(sim.latency.Cancel))
 	for i, _ := range sim.myOrders[pair] {
-		if sim.myOrders[pair][i].oid == oid {
-			sim.myOrders[pair][i].status = CANCELLED
-			// release locked balance
-			if sim.myOrders[pair][i].amount > 0 {
-				currentLockedBase := sim.myPortfolio.Balance(pair.Base) - sim.myPortfolio.AvailableBalance(pair.Base)
-				sim.myPortfolio.SetLockedBalance(pair.Base, currentLockedBase-sim.myOrders[pair][i].price*math.Abs(sim.myOrders[pair][i].amount))
-			} else {
-				currentLockedCoin := sim.myPortfolio.Balance(pair.Coin) - sim.myPortfolio.AvailableBalance(pair.Coin)
-				sim.myPortfolio.SetLockedBalance(pair.Coin, currentLockedCoin-math.Abs(sim.myOrders[pair][i].amount))
+		if sim.myOrders[pair][i].OrderID == oid && sim.myOrders[pair][i].Status == ALIVE {
+			if !cancelTime.After(sim.now) {
+				sim.cancel(pair, i)
+			} else if sim.myOrders[pair][i].CancelTime.IsZero() || cancelTime.Before(sim.myOrders[pair][i].CancelTime) {
+				sim.myOrders[pair][i].CancelTime = cancelTime
 			}
 		}
 		// TODO: might need to handel invlid input
@@ -213,8 +486,25 @@ func (sim *Simulator) CancelOrder(pair Pair, oid string) error {
 	return nil
 }
 
+// cancel marks the i-th order of pair as cancelled and releases its locked balance
+func (sim *Simulator) cancel(pair Pair, i int) {
+	sim.myOrders[pair][i].Status = CANCELLED
+	// release locked balance
+	if sim.myOrders[pair][i].Amount > 0 {
+		currentLockedBase := sim.myPortfolio.Balance(pair.Base) - sim.myPortfolio.AvailableBalance(pair.Base)
+		sim.myPortfolio.SetLockedBalance(pair.Base, currentLockedBase-sim.myOrders[pair][i].Price*math.Abs(sim.myOrders[pair][i].Amount))
+	} else {
+		currentLockedCoin := sim.myPortfolio.Balance(pair.Coin) - sim.myPortfolio.AvailableBalance(pair.Coin)
+		sim.myPortfolio.SetLockedBalance(pair.Coin, currentLockedCoin-math.Abs(sim.myOrders[pair][i].Amount))
+	}
+}
+
 func (ex *Simulator) CancelAllOrders(pair Pair) {
-	panic("not implemented")
+	for _, o := range ex.myOrders[pair] {
+		if o.Status == ALIVE {
+			ex.CancelOrder(pair, o.OrderID)
+		}
+	}
 }
 
 func (sim Simulator) GetTrades() Transactions {
@@ -239,18 +529,9 @@ func (sim Simulator) GetLastPrice(pair Pair) (float64, error) {
 func (sim Simulator) GetMyOrders(pair Pair) []OrderStatus {
 	var ostatus []OrderStatus
 	for _, o := range sim.myOrders[pair] {
-		if o.status == ALIVE {
-			os := OrderStatus{
-				OrderID:      o.oid,
-				PlacedTime:   o.timeStamp,
-				Side:         AmountToSide(o.amount),
-				FilledAmount: 0.0, // simulator cannot simulate partial fill for now
-				LeftAmount:   math.Abs(o.amount),
-				PlacedPrice:  o.price,
-				Price:        o.price, // filled price, not applicable here
-				State:        o.status,
-			}
-			ostatus = append(ostatus, os)
+		// orders are only seen once acknowledged by the exchange
+		if o.Status == ALIVE && !o.AckTime.After(sim.now) {
+			ostatus = append(ostatus, o.status(sim.now))
 		}
 	}
 	return ostatus
@@ -267,14 +548,25 @@ func (sim Simulator) GetPortfolio() Portfolio {
 	return sim.myPortfolio
 }
 
+// GetOrderStatus returns the status of an order placed on the simulator, filled and cancelled orders included
 func (sim Simulator) GetOrderStatus(orderID string, pair Pair) (OrderStatus, error) {
-	var ostatus OrderStatus
-	panic("not implemented")
-	return ostatus, nil
+	for _, o := range sim.myOrders[pair] {
+		if o.OrderID == orderID {
+			return o.status(sim.now), nil
+		}
+	}
+	return OrderStatus{}, errors.New("order " + orderID + " not found on " + pair.String())
 }
 
-func (ex Simulator) GetMyTrades(pair Pair, start, end time.Time) TradeLogS {
-	panic("tradelog")
+// GetMyTrades returns the simulated trades of pair between start and end, with commission
+func (sim Simulator) GetMyTrades(pair Pair, start, end time.Time) TradeLogS {
+	var txns Transactions
+	for _, txn := range sim.myTransactions {
+		if txn.Pair == pair && !txn.TimeStamp.Before(start) && !txn.TimeStamp.After(end) {
+			txns = append(txns, txn)
+		}
+	}
+	return TradeLogsFromTxn(txns)
 }
 
 // dummy function, simulator doesn't need to trace the orders for each strategy separately
@@ -285,10 +577,9 @@ func (sim Simulator) GetAccountOrders(pair Pair) []OrderStatus {
 	return sim.GetMyOrders(pair)
 }
 
-// TODO: Consider shift the fee to constructor and member variable
 func (sim Simulator) GetMakerFee(pair Pair) float64 {
-	return 0.001
+	return sim.fees.Rate(pair).Maker
 }
 func (sim Simulator) GetTakerFee(pair Pair) float64 {
-	return 0.001
+	return sim.fees.Rate(pair).Taker
 }
@@ -0,0 +1,101 @@
+package bean
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+)
+
+// FeeFile is the fee schedule config file under BeanexConfigPath(), e.g.
+//
+//	{
+//	  "BINANCE": {
+//	    "tier": "VIP1",
+//	    "default": {"maker": 0.001, "taker": 0.001},
+//	    "tiers": {"VIP1": {"maker": 0.0009, "taker": 0.001}, "MM1": {"maker": -0.0001, "taker": 0.0005}},
+//	    "pairs": {"BTCUSDT": {"maker": 0.0, "taker": 0.0}}
+//	  }
+//	}
+const FeeFile = "fees.json"
+
+// ErrNoFeeSchedule is returned by GetFeeSchedule when FeeFile does not exist or has no schedule for the exchange
+var ErrNoFeeSchedule = errors.New("no fee schedule configured")
+
+// FeeRate holds the commission rates of a pair, a negative maker rate is a rebate
+type FeeRate struct {
+	Maker float64 `json:"maker"`
+	Taker float64 `json:"taker"`
+}
+
+// FeeSchedule holds the commission rates of an exchange for each VIP tier, with optional per pair overrides
+type FeeSchedule struct {
+	Tier    string             `json:"tier"`    // the VIP tier of our account
+	Default FeeRate            `json:"default"` // applies when the tier is not in Tiers
+	Tiers   map[string]FeeRate `json:"tiers"`
+	Pairs   map[string]FeeRate `json:"pairs"` // keyed by Pair.String(), overrides the tier rates
+}
+
+// Rate returns the commission rates for a pair
+func (fs FeeSchedule) Rate(pair Pair) FeeRate {
+	if r, ok := fs.Pairs[pair.String()]; ok {
+		return r
+	}
+	if r, ok := fs.Tiers[fs.Tier]; ok {
+		return r
+	}
+	return fs.Default
+}
+
+// WithTier returns a copy of the schedule for an account in another VIP tier
+func (fs FeeSchedule) WithTier(tier string) FeeSchedule {
+	fs.Tier = tier
+	return fs
+}
+
+// LoadFeeSchedules reads the fee schedules of all exchanges from a json file
+func LoadFeeSchedules(filename string) (map[string]FeeSchedule, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var fss map[string]FeeSchedule
+	if err = json.Unmarshal(data, &fss); err != nil {
+		return nil, err
+	}
+	// exchange names are all uppercase
+	res := make(map[string]FeeSchedule, len(fss))
+	for exName, fs := range fss {
+		res[strings.ToUpper(exName)] = fs
+	}
+	return res, nil
+}
+
+// GetFeeSchedule returns the fee schedule of an exchange from FeeFile under BeanexConfigPath(),
+// ErrNoFeeSchedule if it is not configured and the error otherwise, e.g. of a malformed file
+func GetFeeSchedule(exName string) (FeeSchedule, error) {
+	fss, err := LoadFeeSchedules(BeanexConfigPath() + FeeFile)
+	if os.IsNotExist(err) {
+		return FeeSchedule{}, ErrNoFeeSchedule
+	}
+	if err != nil {
+		return FeeSchedule{}, err
+	}
+	fs, ok := fss[strings.ToUpper(exName)]
+	if !ok {
+		return FeeSchedule{}, ErrNoFeeSchedule
+	}
+	return fs, nil
+}
+
+// Commission returns the commission of a fill and the coin it is paid in.
+// As on most spot exchanges, buys pay commission in the coin bought and sells in the base received
+func (r FeeRate) Commission(pair Pair, price, makerAmount, takerAmount float64) (float64, Coin) {
+	fee := math.Abs(makerAmount)*r.Maker + math.Abs(takerAmount)*r.Taker
+	if makerAmount+takerAmount > 0 {
+		return fee, pair.Coin
+	}
+	return fee * price, pair.Base
+}
@@ -0,0 +1,87 @@
+package bean
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// FundingRate is the funding of a perpetual at a funding timestamp. When Rate is positive longs pay shorts
+// Rate times the notional of their position at IndexPrice, and the other way round when it is negative
+type FundingRate struct {
+	Instrument string // e.g. BTC-PERPETUAL, XBTUSD
+	TimeStamp  time.Time
+	Rate       float64 // per funding period, e.g. 0.0001 for 0.01%
+	IndexPrice float64
+}
+
+type FundingRates []FundingRate
+
+// Sort sorts the rates by time
+func (fr FundingRates) Sort() {
+	sort.Slice(fr, func(i, j int) bool { return fr[i].TimeStamp.Before(fr[j].TimeStamp) })
+}
+
+// Between returns the rates after from and up to to, assuming fr is sorted, so that consecutive intervals
+// never accrue the same funding twice
+func (fr FundingRates) Between(from, to time.Time) FundingRates {
+	i := sort.Search(len(fr), func(i int) bool { return fr[i].TimeStamp.After(from) })
+	j := sort.Search(len(fr), func(j int) bool { return fr[j].TimeStamp.After(to) })
+	if i >= j {
+		return nil
+	}
+	return fr[i:j]
+}
+
+// Funding returns the funding payment received by the position at a funding timestamp, in the settlement coin.
+// It is 0 unless the position is in the perpetual the rate is for
+func (p Position) Funding(rate FundingRate) float64 {
+	if !p.Perp() || p.qty == 0 || p.Name() != rate.Instrument {
+		return 0.0
+	}
+	return -rate.Rate * math.Copysign(p.Notional(rate.IndexPrice), p.qty)
+}
+
+// Accrued returns the funding payments received by the position over the rates, in the settlement coin
+func (fr FundingRates) Accrued(p Position) float64 {
+	sum := 0.0
+	for _, r := range fr {
+		sum += p.Funding(r)
+	}
+	return sum
+}
+
+// AccrueFunding credits the funding payments of the perpetual positions of the portfolio to the balances of
+// their settlement coins, and returns the payments by coin
+func AccrueFunding(port Portfolio, rates FundingRates) map[Coin]float64 {
+	paid := make(map[Coin]float64)
+	for _, pos := range port.Positions() {
+		if !pos.Perp() {
+			continue
+		}
+		if v := rates.Accrued(pos); v != 0 {
+			port.AddBalance(pos.SettleCoin(), v)
+			paid[pos.SettleCoin()] += v
+		}
+	}
+	return paid
+}
+
+// AddFunding adds the funding the perpetual positions receive over rates, e.g. the current rate until the next
+// funding timestamp, to the PV of the report. It is valued at the spot of the report, with settlePrices for quanto
+// contracts as in PositionsRisk
+func (rr *RiskReport) AddFunding(positions []Position, rates FundingRates, settlePrices map[Coin]float64) error {
+	for _, pos := range positions {
+		v := rates.Accrued(pos)
+		if v == 0 {
+			continue
+		}
+		settle, err := pos.settlePriceIn(rr.Spot, settlePrices)
+		if err != nil {
+			return err
+		}
+		rr.Funding += v * settle
+		rr.PV += v * settle
+	}
+	return nil
+}
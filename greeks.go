@@ -0,0 +1,212 @@
+package bean
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Greeks are the risks of a contract in coin (LHS) terms, as on Deribit:
+// Delta is premium adjusted, in coins per relative move of the forward (BS delta less the option price in coin);
+// Gamma is the change of BS delta per 1 unit (RHS coin) move of the forward;
+// Vega, Vanna and Volga are per 1 vol point; Theta is per calendar day
+type Greeks struct {
+	Delta, Gamma, Vega, Theta, Vanna, Volga float64
+}
+
+func (g Greeks) Add(g2 Greeks) Greeks {
+	return Greeks{g.Delta + g2.Delta, g.Gamma + g2.Gamma, g.Vega + g2.Vega, g.Theta + g2.Theta, g.Vanna + g2.Vanna, g.Volga + g2.Volga}
+}
+
+func (g Greeks) Scale(x float64) Greeks {
+	return Greeks{g.Delta * x, g.Gamma * x, g.Vega * x, g.Theta * x, g.Vanna * x, g.Volga * x}
+}
+
+// normDensity is the standard normal probability density
+func normDensity(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+// Greeks returns the analytic greeks of one contract, i.e. one coin of underlying for options.
+// Futures only have delta, which is NaN for quanto contracts, use GreeksSettle with the price of their settlement coin
+func (c Contract) Greeks(asof time.Time, spotPrice, futPrice, vol float64) Greeks {
+	settlePrice := spotPrice
+	if c.Settlement() == Quanto {
+		settlePrice = math.NaN()
+	}
+	return c.GreeksSettle(asof, spotPrice, futPrice, vol, settlePrice)
+}
+
+// GreeksSettle is Greeks with the price of the settlement coin in RHS coin, which is only used by quanto futures.
+// Their delta is in coins of the underlying like the others: a quanto contract gains its multiplier in the
+// settlement coin per unit move of the forward, i.e. the multiplier times settlePrice in RHS coin
+func (c Contract) GreeksSettle(asof time.Time, spotPrice, futPrice, vol, settlePrice float64) Greeks {
+	if !c.IsOption() {
+		if c.Index() {
+			return Greeks{Delta: 1}
+		}
+		switch c.Settlement() {
+		case Linear:
+			return Greeks{Delta: c.Multiplier()}
+		case Quanto:
+			return Greeks{Delta: c.Multiplier() * settlePrice}
+		}
+		return Greeks{Delta: c.Multiplier() / futPrice}
+	}
+	t := c.ExpiryDays(asof) / 365.0
+	if t <= 0 || vol <= 0 {
+		// expired, only the intrinsic value is left
+		var d float64
+		if c.callPut == Call && futPrice > c.strike {
+			d = c.strike / futPrice
+		} else if c.callPut == Put && futPrice < c.strike {
+			d = -c.strike / futPrice
+		}
+		return Greeks{Delta: d}
+	}
+	sqrtT := math.Sqrt(t)
+	d1 := (math.Log(futPrice/c.strike) + vol*vol/2*t) / (vol * sqrtT)
+	d2 := d1 - vol*sqrtT
+	nd1 := normDensity(d1)
+	// option price in coin
+	prc := forwardOptionPrice(c.ExpiryDays(asof), c.strike, futPrice, vol, c.callPut) / futPrice
+	delta := cumNormDist(d1)
+	if c.callPut == Put {
+		delta -= 1.0
+	}
+	vega := nd1 * sqrtT / 100
+	return Greeks{
+		Delta: delta - prc,
+		Gamma: nd1 / (futPrice * vol * sqrtT),
+		Vega:  vega,
+		Theta: -nd1 * vol / (2 * sqrtT) / 365,
+		Vanna: -nd1 * d2 / vol / 100,
+		Volga: vega * d1 * d2 / vol / 100,
+	}
+}
+
+// Greeks returns the greeks of the position, options quantities are in coins, futures in contracts
+func (p Position) Greeks(asof time.Time, spotPrice, futPrice, vol float64) Greeks {
+	return p.Contract.Greeks(asof, spotPrice, futPrice, vol).Scale(p.qty)
+}
+
+// GreeksSettle is Greeks with the price of the settlement coin, as Contract.GreeksSettle
+func (p Position) GreeksSettle(asof time.Time, spotPrice, futPrice, vol, settlePrice float64) Greeks {
+	return p.Contract.GreeksSettle(asof, spotPrice, futPrice, vol, settlePrice).Scale(p.qty)
+}
+
+// VolSurface gives the forwards and vols to value options with, it is implemented by vol.Surface
+type VolSurface interface {
+	Forward(expiry time.Time) float64
+	Vol(expiry time.Time, strike float64) float64
+}
+
+// RiskBucket is an expiry and strike, the strike is 0 for futures
+type RiskBucket struct {
+	Expiry time.Time
+	Strike float64
+}
+
+// RiskReport sums the PV and greeks of positions in total, by expiry and by expiry and strike
+type RiskReport struct {
+	Asof     time.Time
+	Spot     float64
+	PV       float64 // in RHS coin, as Position.PV, plus Funding
+	Funding  float64 // funding received by the perpetual positions, in RHS coin, see AddFunding
+	Total    Greeks
+	ByExpiry map[time.Time]Greeks
+	ByBucket map[RiskBucket]Greeks
+}
+
+// PortfolioRisk values the positions of the portfolio on the surface and aggregates their greeks
+func PortfolioRisk(p Portfolio, asof time.Time, spotPrice float64, surf VolSurface, settlePrices map[Coin]float64) (RiskReport, error) {
+	return PositionsRisk(p.Positions(), asof, spotPrice, surf, settlePrices)
+}
+
+// PositionsRisk values the positions on the surface and aggregates their greeks. settlePrices are the prices in RHS
+// coin of the settlement coins of quanto contracts, e.g. XBT for BitMEX ETHUSD, an error is returned if one is missing
+func PositionsRisk(positions []Position, asof time.Time, spotPrice float64, surf VolSurface, settlePrices map[Coin]float64) (RiskReport, error) {
+	rr := RiskReport{
+		Asof:     asof,
+		Spot:     spotPrice,
+		ByExpiry: make(map[time.Time]Greeks),
+		ByBucket: make(map[RiskBucket]Greeks),
+	}
+	for _, pos := range positions {
+		fwd := spotPrice
+		if !pos.Perp() && !pos.Index() {
+			fwd = surf.Forward(pos.Expiry())
+		}
+		vol := 0.0
+		if pos.IsOption() {
+			vol = surf.Vol(pos.Expiry(), pos.Strike())
+		}
+		settle, err := pos.settlePriceIn(spotPrice, settlePrices)
+		if err != nil {
+			return rr, err
+		}
+		g := pos.GreeksSettle(asof, spotPrice, fwd, vol, settle)
+		rr.PV += pos.PVSettle(asof, spotPrice, fwd, vol, settle)
+		rr.Total = rr.Total.Add(g)
+		expiry := pos.Expiry()
+		if pos.Perp() || pos.Index() {
+			// perpetuals roll daily, bucket them at the snapshot
+			expiry = asof
+		}
+		rr.ByExpiry[expiry] = rr.ByExpiry[expiry].Add(g)
+		b := RiskBucket{Expiry: expiry, Strike: pos.Strike()}
+		rr.ByBucket[b] = rr.ByBucket[b].Add(g)
+	}
+	return rr, nil
+}
+
+// settlePriceIn returns the price of the settlement coin in RHS coin, from settlePrices for quanto contracts
+func (p Position) settlePriceIn(spotPrice float64, settlePrices map[Coin]float64) (float64, error) {
+	settle := p.settlePrice(spotPrice)
+	if math.IsNaN(settle) {
+		price, ok := settlePrices[p.SettleCoin()]
+		if !ok {
+			return settle, fmt.Errorf("no price of %s to value %s", p.SettleCoin(), p.Name())
+		}
+		settle = price
+	}
+	return settle, nil
+}
+
+// Print shows the risk by expiry and strike, and the total
+func (rr RiskReport) Print() {
+	buckets := make([]RiskBucket, 0, len(rr.ByBucket))
+	for b := range rr.ByBucket {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if !buckets[i].Expiry.Equal(buckets[j].Expiry) {
+			return buckets[i].Expiry.Before(buckets[j].Expiry)
+		}
+		return buckets[i].Strike < buckets[j].Strike
+	})
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Expiry", "Strike", "Delta", "Gamma", "Vega", "Theta", "Vanna", "Volga"})
+	row := func(expiry, strike string, g Greeks) []string {
+		return []string{expiry, strike,
+			fmt.Sprintf("%.4f", g.Delta), fmt.Sprintf("%.6f", g.Gamma), fmt.Sprintf("%.4f", g.Vega),
+			fmt.Sprintf("%.4f", g.Theta), fmt.Sprintf("%.4f", g.Vanna), fmt.Sprintf("%.4f", g.Volga)}
+	}
+	for _, b := range buckets {
+		strike := ""
+		if b.Strike != 0 {
+			strike = fmt.Sprint(b.Strike)
+		}
+		table.Append(row(b.Expiry.Format(ContractDateFormat), strike, rr.ByBucket[b]))
+	}
+	pv := fmt.Sprintf("PV %.2f", rr.PV)
+	if rr.Funding != 0 {
+		pv += fmt.Sprintf(" (funding %.2f)", rr.Funding)
+	}
+	table.SetFooter(row("TOTAL", pv, rr.Total))
+	table.Render()
+}
@@ -0,0 +1,226 @@
+// Package live runs strategies against live exchanges
+package live
+
+import (
+	. "bean"
+	"bean/brew"
+	"bean/db/tds"
+	"bean/logger"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Recorder records the orders placed by a strategy, tds.RecordPlacedOrder by default
+type Recorder func(oids []brew.ExNameWithOID, acct, dealer, param, remark string) error
+
+// Snapshotter records the portfolios of the exchanges, settling their expired positions against pricer first,
+// tds.SettleAndRecordPortfolios by default
+type Snapshotter func(ports map[string]Portfolio, acct string, t time.Time, agg bool, pricer IndexPricer) error
+
+// Reconciliation is the difference between the orders a runner owns and the open orders of the account
+type Reconciliation struct {
+	Closed  []brew.ExNameWithOID // owned orders no longer open, i.e. filled or cancelled by the exchange
+	Unknown []brew.ExNameWithOID // open orders of the account the runner did not place, left alone
+}
+
+// Runner calls the Grind of a strategy every GetTick() on live exchanges, performs its actions, records
+// the placed orders to TDS and keeps track of the orders it owns, which it cancels when it stops
+type Runner struct {
+	strat  Strat
+	exs    map[string]Exchange
+	acct   string
+	Remark string        // recorded with the placed orders
+	Grace  time.Duration // time for a placed order to show in the account orders, one tick by default
+	record Recorder
+	owned  map[brew.ExNameWithOID]time.Time // placed time of the owned orders, keyed with a zero TimeStamp
+
+	// portfolio snapshots, none are taken if snapEvery is 0
+	snapEvery time.Duration
+	lastSnap  time.Time
+	pricer    IndexPricer
+	snapshot  Snapshotter
+}
+
+// NewRunner creates the exchanges of the strategy by name with NewExchange, orders are recorded under acct
+func NewRunner(strat Strat, acct string) (*Runner, error) {
+	exs := make(map[string]Exchange)
+	for _, exName := range strat.GetExchangeNames() {
+		ex, err := NewExchange(exName)
+		if err != nil {
+			return nil, err
+		}
+		exs[exName] = ex
+	}
+	return NewRunnerWith(strat, exs, acct), nil
+}
+
+// NewRunnerWith creates a runner on given exchanges, keyed by name
+func NewRunnerWith(strat Strat, exs map[string]Exchange, acct string) *Runner {
+	return &Runner{
+		strat:    strat,
+		exs:      exs,
+		acct:     acct,
+		Grace:    strat.GetTick(),
+		record:   tds.RecordPlacedOrder,
+		owned:    make(map[brew.ExNameWithOID]time.Time),
+		snapshot: tds.SettleAndRecordPortfolios,
+	}
+}
+
+// SetRecorder replaces tds.RecordPlacedOrder, e.g. to run without TDS
+func (r *Runner) SetRecorder(rec Recorder) {
+	r.record = rec
+}
+
+// SetSnapshot records the portfolios of the exchanges every period, settling their expired options and futures
+// against the index prices of pricer first
+func (r *Runner) SetSnapshot(every time.Duration, pricer IndexPricer) {
+	r.snapEvery = every
+	r.pricer = pricer
+}
+
+// SetSnapshotter replaces tds.SettleAndRecordPortfolios, e.g. to run without TDS
+func (r *Runner) SetSnapshotter(snap Snapshotter) {
+	r.snapshot = snap
+}
+
+// Owned returns the orders placed by the runner which are still open as far as it knows
+func (r *Runner) Owned() []brew.ExNameWithOID {
+	var oids []brew.ExNameWithOID
+	for o, placed := range r.owned {
+		o.TimeStamp = placed
+		oids = append(oids, o)
+	}
+	return oids
+}
+
+// key drops the time stamp so that orders can be looked up by exchange, pair and id
+func key(o brew.ExNameWithOID) brew.ExNameWithOID {
+	o.TimeStamp = time.Time{}
+	return o
+}
+
+// Run steps the strategy every tick until stop is closed or the process receives SIGTERM or SIGINT,
+// then cancels the orders it owns. A panic of the strategy is returned as an error, once the orders are cancelled
+func (r *Runner) Run(stop <-chan struct{}) (err error) {
+	tick := r.strat.GetTick()
+	if tick <= 0 {
+		return errors.New("strategy " + r.strat.Name() + " has no tick")
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigs)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	defer func() {
+		if v := recover(); v != nil {
+			logger.Error().Str("strat", r.strat.Name()).Msg(fmt.Sprint("runner stopping on panic: ", v))
+			err = fmt.Errorf("strategy %s panicked: %v", r.strat.Name(), v)
+			if serr := r.Shutdown(); serr != nil {
+				err = fmt.Errorf("%v, then failed cancelling: %v", err, serr)
+			}
+		}
+	}()
+	logger.Info().Str("strat", r.strat.Name()).Str("params", r.strat.FormatParams()).Msg("runner started")
+	for {
+		select {
+		case <-ticker.C:
+			r.Step()
+		case sig := <-sigs:
+			logger.Info().Str("signal", sig.String()).Msg("runner stopping")
+			return r.Shutdown()
+		case <-stop:
+			logger.Info().Msg("runner stopping")
+			return r.Shutdown()
+		}
+	}
+}
+
+// Step grinds the strategy once, performs its actions, records the placed orders and reconciles
+func (r *Runner) Step() Reconciliation {
+	actions := r.strat.Grind(r.exs)
+	cancelled, placed := brew.PerformActions(&r.exs, actions)
+	// placed first, as orders which do not rest, e.g. IOC, are placed and cancelled in the same batch
+	for _, o := range placed {
+		r.owned[key(o)] = o.TimeStamp
+	}
+	for _, o := range cancelled {
+		delete(r.owned, key(o))
+	}
+	if len(placed) > 0 && r.record != nil {
+		if err := r.record(placed, r.acct, r.strat.Name(), r.strat.FormatParams(), r.Remark); err != nil {
+			logger.Warn().Msg("failed recording placed orders: " + err.Error())
+		}
+	}
+	r.snapshotIfDue(time.Now())
+	return r.Reconcile()
+}
+
+// snapshotIfDue records the portfolios if the last snapshot is older than the snapshot period
+func (r *Runner) snapshotIfDue(now time.Time) {
+	if r.snapEvery <= 0 || r.snapshot == nil || now.Sub(r.lastSnap) < r.snapEvery {
+		return
+	}
+	r.lastSnap = now
+	ports := make(map[string]Portfolio, len(r.exs))
+	for exName, ex := range r.exs {
+		ports[exName] = ex.GetPortfolio()
+	}
+	if err := r.snapshot(ports, r.acct, now, false, r.pricer); err != nil {
+		logger.Warn().Msg("failed recording portfolios: " + err.Error())
+	}
+}
+
+// Reconcile compares the owned orders with the open orders of the account. Owned orders not open any more
+// are dropped, unless placed within Grace as the exchange may not show them yet
+func (r *Runner) Reconcile() Reconciliation {
+	var rec Reconciliation
+	now := time.Now()
+	for exName, ex := range r.exs {
+		for _, pair := range r.strat.GetPairs() {
+			open := make(map[brew.ExNameWithOID]bool)
+			for _, o := range ex.GetAccountOrders(pair) {
+				k := brew.ExNameWithOID{ExName: exName, Pair: pair, OrderID: o.OrderID}
+				open[k] = true
+				if _, ok := r.owned[k]; !ok {
+					k.TimeStamp = o.PlacedTime
+					rec.Unknown = append(rec.Unknown, k)
+				}
+			}
+			for k, placed := range r.owned {
+				if k.ExName != exName || k.Pair != pair || open[k] || now.Sub(placed) < r.Grace {
+					continue
+				}
+				closed := k
+				closed.TimeStamp = placed
+				rec.Closed = append(rec.Closed, closed)
+				delete(r.owned, k)
+			}
+		}
+	}
+	return rec
+}
+
+// Shutdown cancels the orders the runner owns, it returns the last error if any cancel failed
+func (r *Runner) Shutdown() error {
+	var err error
+	for k := range r.owned {
+		ex, ok := r.exs[k.ExName]
+		if !ok {
+			continue
+		}
+		if cerr := ex.CancelOrder(k.Pair, k.OrderID); cerr != nil {
+			logger.Warn().Str("exchange", k.ExName).Str("order", k.OrderID).Msg("failed cancelling: " + cerr.Error())
+			err = cerr
+			continue
+		}
+		delete(r.owned, k)
+	}
+	logger.Info().Int("left", len(r.owned)).Msg("runner stopped")
+	return err
+}
@@ -0,0 +1,200 @@
+package bean
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// market data files, so that datasets can be shared and backtests run without MDS.
+// Transactions are written by Transactions.ToCSV, orderbooks by OrderBookTS.ToCSV, one row per level.
+// Both can also be written as JSONL, one transaction or orderbook per line
+
+// orderBookLine is one orderbook in a JSONL file
+type orderBookLine struct {
+	Time     time.Time
+	ChangeId int64   `json:",omitempty"`
+	Bids     []Order `json:"bids"`
+	Asks     []Order `json:"asks"`
+}
+
+// ToCSV writes the orderbooks with one row per level, bids then asks for each snapshot
+func (obts OrderBookTS) ToCSV(filename string) {
+	csvFile, err := os.Create(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer csvFile.Close()
+	data := [][]string{{"Time", "ChangeId", "Side", "Price", "Amount"}}
+	for _, ob := range obts {
+		tm := ob.Time.Format(time.RFC3339Nano)
+		id := fmt.Sprint(ob.ChangeId)
+		for _, o := range ob.Bids() {
+			data = append(data, []string{tm, id, string(BUY), fmt.Sprint(o.Price), fmt.Sprint(o.Amount)})
+		}
+		for _, o := range ob.Asks() {
+			data = append(data, []string{tm, id, string(SELL), fmt.Sprint(o.Price), fmt.Sprint(o.Amount)})
+		}
+	}
+	csvWriter := csv.NewWriter(csvFile)
+	csvWriter.WriteAll(data)
+	csvWriter.Flush()
+}
+
+// ToJSONL writes one orderbook per line
+func (obts OrderBookTS) ToJSONL(filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, ob := range obts {
+		if err := enc.Encode(orderBookLine{Time: ob.Time, ChangeId: ob.ChangeId, Bids: ob.Bids(), Asks: ob.Asks()}); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// ToJSONL writes one transaction per line
+func (txn Transactions) ToJSONL(filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, t := range txn {
+		if err := enc.Encode(t); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// ReadOrderBookTS reads the orderbooks written by OrderBookTS.ToCSV (.csv) or OrderBookTS.ToJSONL (.jsonl), sorted by time
+func ReadOrderBookTS(filename string) (OrderBookTS, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var obts OrderBookTS
+	switch filepath.Ext(filename) {
+	case ".csv":
+		rows, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		var bids, asks []Order
+		var tm time.Time
+		var id int64
+		flush := func() {
+			if bids != nil || asks != nil {
+				obts = append(obts, OrderBookT{OrderBook: NewOrderBook(bids, asks), Time: tm, ChangeId: id})
+			}
+			bids, asks = nil, nil
+		}
+		for i, row := range rows {
+			if i == 0 {
+				continue // header
+			}
+			if len(row) != 5 {
+				return nil, fmt.Errorf("%s:%d: expected 5 columns, got %d", filename, i+1, len(row))
+			}
+			t, err1 := time.Parse(time.RFC3339Nano, row[0])
+			changeId, err2 := strconv.ParseInt(row[1], 10, 64)
+			price, err3 := strconv.ParseFloat(row[3], 64)
+			amount, err4 := strconv.ParseFloat(row[4], 64)
+			for _, err := range []error{err1, err2, err3, err4} {
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", filename, i+1, err)
+				}
+			}
+			if !t.Equal(tm) || changeId != id {
+				flush()
+				tm, id = t, changeId
+			}
+			switch Side(row[2]) {
+			case BUY:
+				bids = append(bids, Order{Price: price, Amount: amount})
+			case SELL:
+				asks = append(asks, Order{Price: price, Amount: amount})
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown side %s", filename, i+1, row[2])
+			}
+		}
+		flush()
+	case ".jsonl":
+		dec := json.NewDecoder(bufio.NewReader(f))
+		for {
+			var line orderBookLine
+			if err := dec.Decode(&line); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %v", filename, err)
+			}
+			obts = append(obts, OrderBookT{OrderBook: NewOrderBook(line.Bids, line.Asks), Time: line.Time, ChangeId: line.ChangeId})
+		}
+	default:
+		return nil, errors.New("unknown orderbook file format: " + filename)
+	}
+	return obts.Sort(), nil
+}
+
+// ReadTransactions reads the transactions of pair written by Transactions.ToCSV (.csv) or Transactions.ToJSONL (.jsonl), sorted by time
+func ReadTransactions(filename string, pair Pair) (Transactions, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var txn Transactions
+	switch filepath.Ext(filename) {
+	case ".csv":
+		rows, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			if i == 0 {
+				continue // header
+			}
+			if len(row) != 5 {
+				return nil, fmt.Errorf("%s:%d: expected 5 columns, got %d", filename, i+1, len(row))
+			}
+			t, err1 := time.Parse(time.RFC3339Nano, row[0])
+			price, err2 := strconv.ParseFloat(row[2], 64)
+			amount, err3 := strconv.ParseFloat(row[3], 64)
+			maker, err4 := strconv.Atoi(row[4])
+			for _, err := range []error{err1, err2, err3, err4} {
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", filename, i+1, err)
+				}
+			}
+			// the pair column is the concatenated symbol, the pair is given by the caller
+			txn = append(txn, Transaction{Pair: pair, Price: price, Amount: amount, TimeStamp: t, Maker: TraderType(maker)})
+		}
+	case ".jsonl":
+		dec := json.NewDecoder(bufio.NewReader(f))
+		for {
+			var t Transaction
+			if err := dec.Decode(&t); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %v", filename, err)
+			}
+			t.Pair = pair
+			txn = append(txn, t)
+		}
+	default:
+		return nil, errors.New("unknown transaction file format: " + filename)
+	}
+	return txn.Sort(), nil
+}
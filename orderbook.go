@@ -34,7 +34,7 @@ type Order struct {
 }
 
 // OrderBookCore defines the core functions needed in the OrderBook object
-// These are implemented in the OrderBook1 array implementation (OrderBookMap map implementation pending)
+// These are implemented in the OrderBook1 array implementation and the OrderBookTree tree implementation
 type OrderBookCore interface {
 	Bids() []Order        // Bids returns a list of live orders
 	Asks() []Order        // Asks returns a list of live orders
@@ -52,6 +52,7 @@ type OrderBookCore interface {
 type OrderState string
 
 const (
+	NEW       OrderState = "NEW" // sent but not yet acknowledged by the exchange
 	ALIVE     OrderState = "ALIVE"
 	FILLED    OrderState = "FILLED"
 	CANCELLED OrderState = "CANCELLED"
@@ -134,6 +135,14 @@ func (ob *OrderBook) Denoise(pair Pair) *OrderBook {
 	return &ob2
 }
 
+// Clone returns a deep copy of the orderbook
+func (ob OrderBook) Clone() OrderBook {
+	if ob.OrderBookCore == nil {
+		return EmptyOrderBook()
+	}
+	return NewOrderBook(append([]Order{}, ob.Bids()...), append([]Order{}, ob.Asks()...))
+}
+
 // sometimes we want to scale the orderbook by 1e8 to santoshi for better display
 func (ob OrderBook) Scale(scaler float64) OrderBook {
 	// scale price to santoshi
@@ -240,23 +249,39 @@ func (obts OrderBookTS) ShowBrief() {
 	}
 }
 
+// Clone returns a deep copy of the orderbook time series
+func (obts OrderBookTS) Clone() OrderBookTS {
+	res := make(OrderBookTS, len(obts))
+	for i, ob := range obts {
+		res[i] = OrderBookT{OrderBook: ob.Clone(), Time: ob.Time, ChangeId: ob.ChangeId}
+	}
+	return res
+}
+
 // Sort sorts a timesliced orderbook
 func (obts OrderBookTS) Sort() OrderBookTS {
 	sort.Slice(obts, func(i, j int) bool { return obts[i].Time.Before(obts[j].Time) })
 	return obts
 }
 
-// return the orderbook of time t (the closest in sample), assuming the obts is sorted
+// return the orderbook of time t (the latest one not after t, the first one if none), assuming the obts is sorted.
+// A snapshot taken at t is already in effect at t, so that a strategy called on it sees it on the simulator
 func (obts OrderBookTS) GetOrderBook(t time.Time) *OrderBookT {
-	ob := &obts[0]
-	for i := range obts {
-		if t.After(obts[i].Time) {
-			ob = &obts[i]
-		} else {
-			break
-		}
+	i := sort.Search(len(obts), func(i int) bool { return obts[i].Time.After(t) })
+	if i == 0 {
+		return &obts[0]
+	}
+	return &obts[i-1]
+}
+
+// Between returns the orderbooks in the time interval (from, to], assuming the obts is sorted
+func (obts OrderBookTS) Between(from, to time.Time) OrderBookTS {
+	i := sort.Search(len(obts), func(i int) bool { return obts[i].Time.After(from) })
+	j := sort.Search(len(obts), func(j int) bool { return obts[j].Time.After(to) })
+	if i >= j {
+		return nil
 	}
-	return ob
+	return obts[i:j:j]
 }
 
 // PriceIn returns the worst bid and worst ask that need to be hit in the orderbook in order to execute a requested size
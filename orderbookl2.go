@@ -0,0 +1,179 @@
+package bean
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrResyncNeeded is returned when a depth update does not follow on from the orderbook,
+// the orderbook has to be rebuilt from a new snapshot before further updates are applied
+var ErrResyncNeeded = errors.New("orderbook sequence gap, resync from a snapshot needed")
+
+// DepthUpdate sets the amount of a price level, an amount of 0 removes the level
+type DepthUpdate struct {
+	Side   Side
+	Price  float64
+	Amount float64
+}
+
+// DepthDiff is an exchange style incremental update, the level updates with sequence numbers FirstSeq to Seq.
+// For feeds giving the previous change id instead (e.g. Deribit), FirstSeq is the previous change id + 1
+type DepthDiff struct {
+	Time     time.Time
+	FirstSeq int64
+	Seq      int64
+	Updates  []DepthUpdate
+}
+
+// L2OrderBook applies incremental depth updates on top of a snapshot, the sequence number
+// of the last applied update is kept in ChangeId. It is not safe for concurrent use
+type L2OrderBook struct {
+	OrderBookT
+	synced bool
+}
+
+// NewL2OrderBook starts an orderbook from a snapshot, whose ChangeId is the sequence number it was taken at
+func NewL2OrderBook(snapshot OrderBookT) *L2OrderBook {
+	l2 := new(L2OrderBook)
+	l2.Resync(snapshot)
+	return l2
+}
+
+// Resync replaces the orderbook by a new snapshot, e.g. after ErrResyncNeeded
+func (l2 *L2OrderBook) Resync(snapshot OrderBookT) {
+	l2.OrderBookT = OrderBookT{OrderBook: snapshot.Clone(), Time: snapshot.Time, ChangeId: snapshot.ChangeId}
+	l2.synced = true
+}
+
+// Synced returns false after a sequence gap until the next Resync
+func (l2 *L2OrderBook) Synced() bool {
+	return l2.synced
+}
+
+// Apply applies a diff to the orderbook. Diffs already covered by the orderbook are ignored,
+// a diff starting after the next sequence number is a gap, and ErrResyncNeeded is returned until the next Resync
+func (l2 *L2OrderBook) Apply(diff DepthDiff) error {
+	if !l2.synced {
+		return ErrResyncNeeded
+	}
+	if diff.Seq <= l2.ChangeId {
+		// stale, already in the snapshot
+		return nil
+	}
+	if diff.FirstSeq > l2.ChangeId+1 {
+		l2.synced = false
+		return ErrResyncNeeded
+	}
+	l2.OrderBook.Update(diff.Updates)
+	l2.Time = diff.Time
+	l2.ChangeId = diff.Seq
+	return nil
+}
+
+// hasLevel returns true if there are orders at price
+func hasLevel(orders []Order, price float64) bool {
+	for _, o := range orders {
+		if o.Price == price {
+			return true
+		}
+	}
+	return false
+}
+
+// levelSetter is implemented by cores that can set a level without looking it up in Bids or Asks, e.g. OrderBookTree
+type levelSetter interface {
+	SetBid(Order) bool
+	SetAsk(Order) bool
+}
+
+// Update applies level updates to the orderbook
+func (ob OrderBook) Update(updates []DepthUpdate) {
+	setter, isSetter := ob.OrderBookCore.(levelSetter)
+	for _, u := range updates {
+		o := Order{Price: u.Price, Amount: u.Amount}
+		if isSetter {
+			if u.Side == BUY {
+				setter.SetBid(o)
+			} else {
+				setter.SetAsk(o)
+			}
+		} else if u.Side == BUY {
+			switch {
+			case u.Amount == 0:
+				ob.CancelBid(o)
+			case hasLevel(ob.Bids(), u.Price):
+				ob.EditBid(o)
+			default:
+				ob.InsertBid(o)
+			}
+		} else {
+			switch {
+			case u.Amount == 0:
+				ob.CancelAsk(o)
+			case hasLevel(ob.Asks(), u.Price):
+				ob.EditAsk(o)
+			default:
+				ob.InsertAsk(o)
+			}
+		}
+	}
+}
+
+// diffLevels returns the updates taking the levels from to the levels to
+func diffLevels(side Side, from, to []Order) []DepthUpdate {
+	var updates []DepthUpdate
+	amounts := make(map[float64]float64, len(from))
+	for _, o := range from {
+		amounts[o.Price] = o.Amount
+	}
+	for _, o := range to {
+		if amt, ok := amounts[o.Price]; !ok || amt != o.Amount {
+			updates = append(updates, DepthUpdate{Side: side, Price: o.Price, Amount: o.Amount})
+		}
+		delete(amounts, o.Price)
+	}
+	for _, o := range from {
+		if _, ok := amounts[o.Price]; ok {
+			updates = append(updates, DepthUpdate{Side: side, Price: o.Price, Amount: 0})
+		}
+	}
+	return updates
+}
+
+// Diff returns the level updates that take ob to ob2
+func (ob OrderBook) Diff(ob2 OrderBook) []DepthUpdate {
+	return append(diffLevels(BUY, ob.Bids(), ob2.Bids()), diffLevels(SELL, ob.Asks(), ob2.Asks())...)
+}
+
+// Diffs turns a series of snapshots into the first snapshot and the diffs to each of the following ones,
+// numbered on from the first snapshot's ChangeId, to store or replay deltas instead of full snapshots
+func (obts OrderBookTS) Diffs() (OrderBookT, []DepthDiff) {
+	if len(obts) == 0 {
+		return OrderBookT{OrderBook: EmptyOrderBook()}, nil
+	}
+	diffs := make([]DepthDiff, len(obts)-1)
+	seq := obts[0].ChangeId
+	for i := 1; i < len(obts); i++ {
+		// keep the snapshots' change ids where they increase
+		first := seq + 1
+		seq = first
+		if obts[i].ChangeId > seq {
+			seq = obts[i].ChangeId
+		}
+		diffs[i-1] = DepthDiff{Time: obts[i].Time, FirstSeq: first, Seq: seq, Updates: obts[i-1].Diff(obts[i].OrderBook)}
+	}
+	return obts[0], diffs
+}
+
+// ReplayDiffs rebuilds the series of snapshots from a snapshot and the diffs that follow it
+func ReplayDiffs(snapshot OrderBookT, diffs []DepthDiff) (OrderBookTS, error) {
+	l2 := NewL2OrderBook(snapshot)
+	obts := OrderBookTS{OrderBookT{OrderBook: l2.Clone(), Time: l2.Time, ChangeId: l2.ChangeId}}
+	for _, d := range diffs {
+		if err := l2.Apply(d); err != nil {
+			return obts, err
+		}
+		obts = append(obts, OrderBookT{OrderBook: l2.Clone(), Time: l2.Time, ChangeId: l2.ChangeId})
+	}
+	return obts, nil
+}
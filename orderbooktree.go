@@ -0,0 +1,327 @@
+package bean
+
+import (
+	"math"
+	"sync"
+)
+
+// OrderBookTree is an implementation of the OrderBookCore interface for books with frequent updates.
+// Each side is a persistent AVL tree keyed by price, so that insert, cancel and edit are O(log n),
+// the best bid and ask are kept up to date for O(1) access, and Snapshot shares the trees instead of copying them.
+// Orders at the same price are aggregated into one level
+type OrderBookTree struct {
+	bids priceTree
+	asks priceTree
+	m    sync.RWMutex
+}
+
+// priceTree is one side of the book, best is the highest price for bids and the lowest for asks
+type priceTree struct {
+	root *priceNode
+	desc bool
+	best Order
+}
+
+// priceNode is a node of a persistent AVL tree, nodes are never modified once built
+type priceNode struct {
+	order       Order
+	left, right *priceNode
+	height      int
+}
+
+// EmptyOrderBookTree returns an empty tree based orderbook
+func EmptyOrderBookTree() OrderBook {
+	return NewOrderBookTree(nil, nil)
+}
+
+// NewOrderBookTree returns a new tree based orderbook populated by bids and offers
+func NewOrderBookTree(bids, asks []Order) OrderBook {
+	ob := OrderBookTree{bids: priceTree{desc: true}, asks: priceTree{}}
+	for _, o := range bids {
+		ob.bids.root = insertLevel(ob.bids.root, o, true)
+	}
+	for _, o := range asks {
+		ob.asks.root = insertLevel(ob.asks.root, o, true)
+	}
+	ob.bids.updateBest()
+	ob.asks.updateBest()
+	return OrderBook{&ob}
+}
+
+// Snapshot returns an orderbook frozen at the current state, later updates do not change it.
+// The trees are shared rather than copied, so this is O(1)
+func (ob *OrderBookTree) Snapshot() OrderBook {
+	ob.m.RLock()
+	defer ob.m.RUnlock()
+	return OrderBook{&OrderBookTree{bids: ob.bids, asks: ob.asks}}
+}
+
+// Bids retrieves a list of bid orders from the orderbook, best first
+func (ob *OrderBookTree) Bids() []Order {
+	ob.m.RLock()
+	defer ob.m.RUnlock()
+	return ob.bids.orders()
+}
+
+// Asks retrieves a list of asks from the orderbook, best first
+func (ob *OrderBookTree) Asks() []Order {
+	ob.m.RLock()
+	defer ob.m.RUnlock()
+	return ob.asks.orders()
+}
+
+// InsertBid adds an order into the orderbook, adding to the level if there is one. Returns true if the top of book price has changed
+func (ob *OrderBookTree) InsertBid(order Order) bool {
+	ob.m.Lock()
+	defer ob.m.Unlock()
+	return ob.bids.insert(order)
+}
+
+// InsertAsk adds an order into the orderbook, adding to the level if there is one. Returns true if the top of book price has changed
+func (ob *OrderBookTree) InsertAsk(order Order) bool {
+	ob.m.Lock()
+	defer ob.m.Unlock()
+	return ob.asks.insert(order)
+}
+
+// CancelBid deletes the level at the order's price. Returns true if the top of book price has changed
+func (ob *OrderBookTree) CancelBid(order Order) bool {
+	ob.m.Lock()
+	defer ob.m.Unlock()
+	return ob.bids.cancel(order)
+}
+
+// CancelAsk deletes the level at the order's price. Returns true if the top of book price has changed
+func (ob *OrderBookTree) CancelAsk(order Order) bool {
+	ob.m.Lock()
+	defer ob.m.Unlock()
+	return ob.asks.cancel(order)
+}
+
+// EditBid replaces the amount of the level at the order's price. Returns true if the top of book has changed
+func (ob *OrderBookTree) EditBid(order Order) bool {
+	ob.m.Lock()
+	defer ob.m.Unlock()
+	return ob.bids.edit(order)
+}
+
+// EditAsk replaces the amount of the level at the order's price. Returns true if the top of book has changed
+func (ob *OrderBookTree) EditAsk(order Order) bool {
+	ob.m.Lock()
+	defer ob.m.Unlock()
+	return ob.asks.edit(order)
+}
+
+// SetBid sets the amount of the level at the order's price, an amount of 0 removes the level.
+// Returns true if the top of book has changed
+func (ob *OrderBookTree) SetBid(order Order) bool {
+	ob.m.Lock()
+	defer ob.m.Unlock()
+	return ob.bids.set(order)
+}
+
+// SetAsk sets the amount of the level at the order's price, an amount of 0 removes the level.
+// Returns true if the top of book has changed
+func (ob *OrderBookTree) SetAsk(order Order) bool {
+	ob.m.Lock()
+	defer ob.m.Unlock()
+	return ob.asks.set(order)
+}
+
+func (ob *OrderBookTree) BestBid() Order {
+	if ob == nil {
+		return Order{Price: math.NaN(), Amount: 0.0}
+	}
+	ob.m.RLock()
+	defer ob.m.RUnlock()
+	return ob.bids.best
+}
+
+func (ob *OrderBookTree) BestAsk() Order {
+	if ob == nil {
+		return Order{Price: math.NaN(), Amount: 0.0}
+	}
+	ob.m.RLock()
+	defer ob.m.RUnlock()
+	return ob.asks.best
+}
+
+func (t *priceTree) updateBest() {
+	n := t.root
+	if n == nil {
+		t.best = Order{Price: math.NaN(), Amount: 0.0}
+		return
+	}
+	for {
+		next := n.left
+		if t.desc {
+			next = n.right
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	t.best = n.order
+}
+
+func (t *priceTree) insert(order Order) bool {
+	t.root = insertLevel(t.root, order, true)
+	prev := t.best
+	t.updateBest()
+	return t.best.Price != prev.Price
+}
+
+func (t *priceTree) cancel(order Order) bool {
+	if findLevel(t.root, order.Price) == nil {
+		return false
+	}
+	t.root = removeLevel(t.root, order.Price)
+	prev := t.best
+	t.updateBest()
+	return t.best.Price != prev.Price
+}
+
+func (t *priceTree) edit(order Order) bool {
+	if findLevel(t.root, order.Price) == nil {
+		return false
+	}
+	t.root = insertLevel(t.root, order, false)
+	prev := t.best
+	t.updateBest()
+	return t.best != prev
+}
+
+func (t *priceTree) set(order Order) bool {
+	if order.Amount == 0 {
+		return t.cancel(order)
+	}
+	t.root = insertLevel(t.root, order, false)
+	prev := t.best
+	t.updateBest()
+	return t.best != prev
+}
+
+// orders lists the levels best first
+func (t *priceTree) orders() []Order {
+	orders := make([]Order, 0, size(t.root))
+	var walk func(n *priceNode)
+	walk = func(n *priceNode) {
+		if n == nil {
+			return
+		}
+		first, second := n.left, n.right
+		if t.desc {
+			first, second = n.right, n.left
+		}
+		walk(first)
+		orders = append(orders, n.order)
+		walk(second)
+	}
+	walk(t.root)
+	return orders
+}
+
+func size(n *priceNode) int {
+	if n == nil {
+		return 0
+	}
+	return 1 + size(n.left) + size(n.right)
+}
+
+func height(n *priceNode) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func newNode(order Order, left, right *priceNode) *priceNode {
+	h := height(left)
+	if hr := height(right); hr > h {
+		h = hr
+	}
+	return &priceNode{order: order, left: left, right: right, height: h + 1}
+}
+
+// balance builds a node from order and its subtrees, rotating to keep the tree balanced
+func balance(order Order, left, right *priceNode) *priceNode {
+	hl, hr := height(left), height(right)
+	if hl > hr+1 {
+		if height(left.left) >= height(left.right) {
+			return newNode(left.order, left.left, newNode(order, left.right, right))
+		}
+		return newNode(left.right.order, newNode(left.order, left.left, left.right.left), newNode(order, left.right.right, right))
+	}
+	if hr > hl+1 {
+		if height(right.right) >= height(right.left) {
+			return newNode(right.order, newNode(order, left, right.left), right.right)
+		}
+		return newNode(right.left.order, newNode(order, left, right.left.left), newNode(right.order, right.left.right, right.right))
+	}
+	return newNode(order, left, right)
+}
+
+// insertLevel returns a tree with the order inserted, added to or replacing an existing level at the same price
+func insertLevel(n *priceNode, order Order, add bool) *priceNode {
+	if n == nil {
+		return newNode(order, nil, nil)
+	}
+	switch {
+	case order.Price < n.order.Price:
+		return balance(n.order, insertLevel(n.left, order, add), n.right)
+	case order.Price > n.order.Price:
+		return balance(n.order, n.left, insertLevel(n.right, order, add))
+	default:
+		if add {
+			order.Amount += n.order.Amount
+		}
+		return newNode(order, n.left, n.right)
+	}
+}
+
+func removeMin(n *priceNode) *priceNode {
+	if n.left == nil {
+		return n.right
+	}
+	return balance(n.order, removeMin(n.left), n.right)
+}
+
+// removeLevel returns a tree without the level at price
+func removeLevel(n *priceNode, price float64) *priceNode {
+	if n == nil {
+		return nil
+	}
+	switch {
+	case price < n.order.Price:
+		return balance(n.order, removeLevel(n.left, price), n.right)
+	case price > n.order.Price:
+		return balance(n.order, n.left, removeLevel(n.right, price))
+	default:
+		if n.left == nil {
+			return n.right
+		}
+		if n.right == nil {
+			return n.left
+		}
+		m := n.right
+		for m.left != nil {
+			m = m.left
+		}
+		return balance(m.order, n.left, removeMin(n.right))
+	}
+}
+
+func findLevel(n *priceNode, price float64) *priceNode {
+	for n != nil {
+		switch {
+		case price < n.order.Price:
+			n = n.left
+		case price > n.order.Price:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return nil
+}
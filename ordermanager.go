@@ -0,0 +1,241 @@
+package bean
+
+import (
+	"bean/logger"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// OrderEvent is a transition of a tracked order, with the amount filled since the previous event if any
+type OrderEvent struct {
+	OrderID string
+	Pair    Pair
+	Side    Side
+	From    OrderState
+	To      OrderState
+	Filled  float64 // amount filled since the previous event, 0 if none
+	Price   float64 // average price of the amount filled since the previous event
+	Time    time.Time
+}
+
+func (e OrderEvent) String() string {
+	s := fmt.Sprintf("%s %s %s %s->%s", e.Time.Format(time.RFC3339), e.Pair, e.OrderID, e.From, e.To)
+	if e.Filled != 0 {
+		s += fmt.Sprintf(" %s %g@%g", e.Side, e.Filled, e.Price)
+	}
+	return s
+}
+
+// IsFill returns true if the order was (partially) filled since the previous event
+func (e OrderEvent) IsFill() bool {
+	return e.Filled > 0
+}
+
+// Terminal returns true for the states an order never leaves
+func (s OrderState) Terminal() bool {
+	return s == FILLED || s == CANCELLED || s == REJECTED
+}
+
+// rank orders the states of the order state machine NEW -> ALIVE -> PARTIAL -> FILLED/CANCELLED/REJECTED,
+// suspended orders keep their state
+func (s OrderState) rank() int {
+	switch s {
+	case NEW:
+		return 0
+	case ALIVE:
+		return 1
+	case PARTIAL:
+		return 2
+	case FILLED, CANCELLED, REJECTED:
+		return 3
+	}
+	return -1
+}
+
+type orderKey struct {
+	Pair    Pair
+	OrderID string
+}
+
+// OrderManager tracks orders placed on an exchange through their states by polling GetOrderStatus, and turns
+// what it sees into OrderEvents with incremental fills. Orders are pruned once they reach a terminal state, or
+// once their status could not be queried for Expire.
+// It is safe for concurrent use, and never holds its lock while calling the exchange
+type OrderManager struct {
+	ex      Exchange
+	mu      sync.Mutex
+	orders  map[orderKey]OrderStatus
+	seen    map[orderKey]time.Time // when the status of an order was last queried, or it was tracked
+	pending []OrderEvent           // rejections of Place, returned by the next Update
+	Now     func() time.Time       // time of the events, time.Now by default, e.g. the simulator time in backtests
+	Expire  time.Duration          // how long an order whose status cannot be queried is kept, 0 for ever
+}
+
+// DefaultOrderExpire is how long an OrderManager keeps orders whose status cannot be queried
+const DefaultOrderExpire = 10 * time.Minute
+
+func NewOrderManager(ex Exchange) *OrderManager {
+	return &OrderManager{
+		ex:     ex,
+		orders: make(map[orderKey]OrderStatus),
+		seen:   make(map[orderKey]time.Time),
+		Now:    time.Now,
+		Expire: DefaultOrderExpire,
+	}
+}
+
+// Place places a limit order on the exchange and tracks it. An order the exchange refuses is reported REJECTED
+// by the next Update, with the id returned by the exchange if any
+func (om *OrderManager) Place(pair Pair, price, amount float64) (string, error) {
+	oid, err := om.ex.PlaceLimitOrder(pair, price, amount)
+	if err != nil {
+		om.mu.Lock()
+		om.pending = append(om.pending, OrderEvent{OrderID: oid, Pair: pair, Side: AmountToSide(amount), From: NEW,
+			To: REJECTED, Time: om.Now()})
+		om.mu.Unlock()
+		return oid, err
+	}
+	om.Track(pair, oid, price, amount)
+	return oid, nil
+}
+
+// Track tracks an order placed elsewhere, e.g. by brew.PerformActions, as NEW
+func (om *OrderManager) Track(pair Pair, oid string, price, amount float64) {
+	k := orderKey{pair, oid}
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	if _, ok := om.orders[k]; ok {
+		return
+	}
+	om.seen[k] = om.Now()
+	om.orders[k] = OrderStatus{
+		OrderID:     oid,
+		PlacedTime:  om.Now(),
+		Side:        AmountToSide(amount),
+		LeftAmount:  math.Abs(amount),
+		PlacedPrice: price,
+		Price:       price,
+		State:       NEW,
+	}
+}
+
+// Cancel cancels a tracked order, it is reported CANCELLED once the exchange says so
+func (om *OrderManager) Cancel(pair Pair, oid string) error {
+	return om.ex.CancelOrder(pair, oid)
+}
+
+// Get returns the last known status of a tracked order
+func (om *OrderManager) Get(pair Pair, oid string) (OrderStatus, bool) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	o, ok := om.orders[orderKey{pair, oid}]
+	return o, ok
+}
+
+// Orders returns the last known status of the tracked orders of pair
+func (om *OrderManager) Orders(pair Pair) []OrderStatus {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	var orders []OrderStatus
+	for k, o := range om.orders {
+		if k.Pair == pair {
+			orders = append(orders, o)
+		}
+	}
+	return orders
+}
+
+// Update polls the status of the tracked orders and returns their transitions and fills since the last update,
+// after the rejections of Place. Orders whose status cannot be queried are kept as they are, as an exchange may
+// not show a new order yet, until Expire. They are then dropped, reported REJECTED if they were never seen
+func (om *OrderManager) Update() []OrderEvent {
+	om.mu.Lock()
+	keys := make([]orderKey, 0, len(om.orders))
+	for k := range om.orders {
+		keys = append(keys, k)
+	}
+	om.mu.Unlock()
+
+	// query outside the lock, so that placing and tracking orders does not wait for the exchange
+	statuses := make(map[orderKey]OrderStatus, len(keys))
+	var failed []orderKey
+	for _, k := range keys {
+		st, err := om.ex.GetOrderStatus(k.OrderID, k.Pair)
+		if err != nil {
+			logger.Warn().Str("exchange", om.ex.Name()).Str("order", k.OrderID).Msg("failed getting order status: " + err.Error())
+			failed = append(failed, k)
+			continue
+		}
+		statuses[k] = st
+	}
+
+	now := om.Now()
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	events := om.pending
+	om.pending = nil
+	for k, st := range statuses {
+		o, ok := om.orders[k]
+		if !ok {
+			continue
+		}
+		om.seen[k] = now
+		next, ev, ok := transition(o, st)
+		if ok {
+			ev.OrderID, ev.Pair, ev.Time = k.OrderID, k.Pair, now
+			events = append(events, ev)
+		}
+		if next.State.Terminal() {
+			om.remove(k)
+		} else {
+			om.orders[k] = next
+		}
+	}
+	for _, k := range failed {
+		o, ok := om.orders[k]
+		if !ok || om.Expire <= 0 || now.Sub(om.seen[k]) < om.Expire {
+			continue
+		}
+		logger.Warn().Str("exchange", om.ex.Name()).Str("order", k.OrderID).Msg("dropping order whose status cannot be queried")
+		if o.State == NEW {
+			events = append(events, OrderEvent{OrderID: k.OrderID, Pair: k.Pair, Side: o.Side, From: NEW, To: REJECTED, Time: now})
+		}
+		om.remove(k)
+	}
+	return events
+}
+
+func (om *OrderManager) remove(k orderKey) {
+	delete(om.orders, k)
+	delete(om.seen, k)
+}
+
+// transition moves an order to the status reported by the exchange. Stale statuses never move an order back
+// and fills are only counted once, as the increase of the filled amount
+func transition(o, st OrderStatus) (OrderStatus, OrderEvent, bool) {
+	to := st.State
+	if to == ALIVE && st.FilledAmount > 0 {
+		to = PARTIAL
+	}
+	if to.rank() < o.State.rank() {
+		to = o.State
+	}
+	ev := OrderEvent{Side: o.Side, From: o.State, To: to}
+	next := o
+	next.State = to
+	if filled := st.FilledAmount - o.FilledAmount; filled > 1e-12 {
+		ev.Filled = filled
+		ev.Price = (st.Price*st.FilledAmount - o.Price*o.FilledAmount) / filled
+		next.FilledAmount = st.FilledAmount
+		next.Price = st.Price
+		next.Commission = st.Commission
+		next.CommissionAsset = st.CommissionAsset
+	}
+	changed := ev.From != ev.To || ev.Filled > 0
+	if changed {
+		next.LeftAmount = st.LeftAmount
+	}
+	return next, ev, changed
+}
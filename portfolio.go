@@ -25,6 +25,7 @@ type Portfolio interface {
 	Coins() Coins
 	AddPosition(Position)
 	SetPositions([]Position)
+	RemovePosition(*Contract)
 	Positions() []Position
 	ShowBrief()
 }
@@ -206,6 +207,17 @@ func (p *portfolio) SetPositions(ps []Position) {
 	}
 }
 
+// RemovePosition removes the positions in contract c
+func (p *portfolio) RemovePosition(c *Contract) {
+	ps := make([]Position, 0, len(p.positions))
+	for _, pos := range p.positions {
+		if !pos.Contract.Equal(c) {
+			ps = append(ps, pos)
+		}
+	}
+	p.positions = ps
+}
+
 /*
 // Log - log to logger, note that we do not log locked balance since it's only for exchange
 func (p portfolio) Log(msg string) {
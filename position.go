@@ -1,6 +1,9 @@
 package bean
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 type Position struct {
 	*Contract
@@ -41,11 +44,157 @@ func NewPosition(c *Contract, qty, price float64) Position {
 
 // Calculate the price of a contract given market parameters. Price is in RHS coin value spot
 // Discounting assumes zero interest rate on LHS coin (normally BTC) which is deribit standard. Note USD rates float and are generally negative.
+// Quanto futures settle in a third coin and are NaN, use PVSettle with the price of the settlement coin
 func (p Position) PV(asof time.Time, spotPrice, futPrice, vol float64) float64 {
+	return p.PVSettle(asof, spotPrice, futPrice, vol, p.settlePrice(spotPrice))
+}
+
+// PVSettle is PV with the price of the settlement coin in RHS coin, settlePrice is only used by futures
+func (p Position) PVSettle(asof time.Time, spotPrice, futPrice, vol, settlePrice float64) float64 {
 	if p.IsOption() {
 		/*		return p.Con.OptPrice(asof, spotPrice, futPrice, vol) * p.Qty*/
 		return p.OptPrice(asof, spotPrice, futPrice, vol)*p.qty - p.price*spotPrice*p.qty
 	} else {
-		return (1.0/p.price - 1.0/futPrice) * spotPrice * p.qty * 10.0
+		return p.SettlePnL(futPrice) * settlePrice
+	}
+}
+
+// MarkValue is the value of the position when option premiums are paid in cash, as on Deribit and in
+// ContractSimulator: options are worth their price, without the entry premium PV nets off, and futures their PnL
+// from the entry price as in PV
+func (p Position) MarkValue(asof time.Time, spotPrice, futPrice, vol float64) float64 {
+	if p.IsOption() {
+		return p.OptPrice(asof, spotPrice, futPrice, vol) * p.qty
+	}
+	return p.PV(asof, spotPrice, futPrice, vol)
+}
+
+// settlePrice returns the price of the settlement coin in RHS coin, NaN for quanto contracts
+func (p Position) settlePrice(spotPrice float64) float64 {
+	switch p.Settlement() {
+	case Linear:
+		return 1.0
+	case Quanto:
+		return math.NaN()
+	}
+	return spotPrice
+}
+
+// SettlePnL returns the PnL of a futures position from its entry price to futPrice, in the settlement coin
+func (p Position) SettlePnL(futPrice float64) float64 {
+	m := p.Multiplier() * p.qty
+	switch p.Settlement() {
+	case Linear, Quanto:
+		return (futPrice - p.price) * m
+	}
+	return (1.0/p.price - 1.0/futPrice) * m
+}
+
+// Notional returns the absolute size of a futures position at futPrice, in the settlement coin
+func (p Position) Notional(futPrice float64) float64 {
+	m := p.Multiplier() * math.Abs(p.qty)
+	switch p.Settlement() {
+	case Linear, Quanto:
+		return m * futPrice
+	}
+	return m / futPrice
+}
+
+// InitialMargin returns the margin needed to open the position, in the settlement coin.
+// Futures use the rates of the spec. Long options are paid up front and need none, short options follow
+// Deribit: max(0.15 - OTM amount / underlying, 0.1) + mark price, per coin of underlying
+func (p Position) InitialMargin(asof time.Time, spotPrice, futPrice, vol float64) float64 {
+	im, _ := p.MarginAtMark(futPrice, p.markPrice(asof, spotPrice, futPrice, vol))
+	return im
+}
+
+// MaintenanceMargin returns the margin below which the position is liquidated, in the settlement coin.
+// Short options follow Deribit: 0.075 + mark price, per coin of underlying
+func (p Position) MaintenanceMargin(asof time.Time, spotPrice, futPrice, vol float64) float64 {
+	_, mm := p.MarginAtMark(futPrice, p.markPrice(asof, spotPrice, futPrice, vol))
+	return mm
+}
+
+// markPrice returns the option price in coin, 0 for futures
+func (p Position) markPrice(asof time.Time, spotPrice, futPrice, vol float64) float64 {
+	if !p.IsOption() {
+		return 0.0
+	}
+	return p.OptPrice(asof, spotPrice, futPrice, vol) / spotPrice
+}
+
+// MarginAtMark returns the initial and maintenance margins of the position, as InitialMargin and
+// MaintenanceMargin, given the option mark price in coin instead of a vol, e.g. the mid of its order book
+func (p Position) MarginAtMark(futPrice, markPrice float64) (initial, maintenance float64) {
+	if !p.IsOption() {
+		n := p.Notional(futPrice)
+		return p.Spec().InitialMargin * n, p.Spec().MaintenanceMargin * n
+	}
+	if p.qty >= 0 {
+		return 0.0, 0.0
+	}
+	otm := math.Max(p.Strike()-futPrice, 0.0)
+	if p.CallPut() == Put {
+		otm = math.Max(futPrice-p.Strike(), 0.0)
+	}
+	return (math.Max(0.15-otm/futPrice, 0.1) + markPrice) * -p.qty, (0.075 + markPrice) * -p.qty
+}
+
+// Trade returns the position after trading qty at price and the PnL realised in the settlement coin.
+// The entry price of futures is averaged in 1/price for inverse contracts and in price otherwise, and the PnL
+// of the reduced quantity is realised. Options average their premium and realise nothing, their premium
+// being paid in cash
+func (p Position) Trade(qty, price float64) (Position, float64) {
+	if p.qty == 0 {
+		return NewPosition(p.Contract, qty, price), 0.0
+	}
+	if p.qty*qty > 0 {
+		total := p.qty + qty
+		avg := (p.qty*p.price + qty*price) / total
+		if !p.IsOption() && p.Settlement() == Inverse {
+			avg = total / (p.qty/p.price + qty/price)
+		}
+		return NewPosition(p.Contract, total, avg), 0.0
+	}
+	closed := math.Copysign(math.Min(math.Abs(p.qty), math.Abs(qty)), p.qty)
+	realised := 0.0
+	if !p.IsOption() {
+		realised = NewPosition(p.Contract, closed, p.price).SettlePnL(price)
+	}
+	left := p.qty + qty
+	switch {
+	case left == 0:
+		return NewPosition(p.Contract, 0, 0), realised
+	case left*p.qty > 0:
+		return NewPosition(p.Contract, left, p.price), realised
+	}
+	// flipped, the rest is opened at price
+	return NewPosition(p.Contract, left, price), realised
+}
+
+// LiquidationPrice returns the futures price at which the equity of an isolated futures position, collateral
+// plus SettlePnL, falls to its maintenance margin. collateral is in the settlement coin.
+// It is 0 for longs and +Inf for shorts that cannot be liquidated, and NaN for options or a flat position
+func (p Position) LiquidationPrice(collateral float64) float64 {
+	if p.IsOption() || p.qty == 0 {
+		return math.NaN()
+	}
+	m := p.Multiplier() * p.qty
+	mmr := p.Spec().MaintenanceMargin
+	var liq float64
+	switch p.Settlement() {
+	case Linear, Quanto:
+		// collateral + (F - price) m = mmr |m| F
+		liq = (m*p.price - collateral) / (m - mmr*math.Abs(m))
+	default:
+		// collateral + (1/price - 1/F) m = mmr |m| / F
+		liq = (m + mmr*math.Abs(m)) / (collateral + m/p.price)
+	}
+	if liq > 0 && !math.IsInf(liq, 0) {
+		return liq
+	}
+	if p.qty > 0 {
+		return 0.0
 	}
+	return math.Inf(1)
 }
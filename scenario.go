@@ -0,0 +1,127 @@
+package bean
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Scenario is a market move to revalue positions under
+type Scenario struct {
+	SpotShock float64 // relative move of spot and forwards, e.g. -0.2 for -20%
+	VolShock  float64 // parallel vol move, e.g. 0.1 for +10 vols
+	SkewShock float64 // vol move per unit of log moneyness ln(K/F), e.g. -0.1 lifts puts and lowers calls
+	Days      float64 // calendar days passed
+}
+
+func (s Scenario) String() string {
+	return fmt.Sprintf("spot %+.0f%% vol %+.0f skew %+.0f %.0fd", s.SpotShock*100, s.VolShock*100, s.SkewShock*100, s.Days)
+}
+
+// shockedSurface applies a scenario on top of a surface. Vols move with the forward (sticky moneyness)
+type shockedSurface struct {
+	surf VolSurface
+	s    Scenario
+}
+
+func (ss shockedSurface) Forward(expiry time.Time) float64 {
+	return ss.surf.Forward(expiry) * (1 + ss.s.SpotShock)
+}
+
+func (ss shockedSurface) Vol(expiry time.Time, strike float64) float64 {
+	k := strike / (1 + ss.s.SpotShock)
+	v := ss.surf.Vol(expiry, k) + ss.s.VolShock + ss.s.SkewShock*math.Log(k/ss.surf.Forward(expiry))
+	return math.Max(v, 0.0)
+}
+
+// Revalue returns the PV of the positions under the scenario, as Position.PV, options expired by the scenario at their
+// intrinsic value
+func Revalue(positions []Position, asof time.Time, spotPrice float64, surf VolSurface, s Scenario) float64 {
+	shocked := shockedSurface{surf, s}
+	at := asof.Add(time.Duration(s.Days * 24 * float64(time.Hour)))
+	spot := spotPrice * (1 + s.SpotShock)
+	pv := 0.0
+	for _, pos := range positions {
+		fwd := spot
+		if !pos.Perp() && !pos.Index() {
+			fwd = shocked.Forward(pos.Expiry())
+		}
+		if pos.IsOption() && !at.Before(pos.Expiry()) {
+			// expired options are worth their exercise value net of the entry premium as in PV, the pricer has no time left
+			pv += (pos.IntrinsicPrice(spot, fwd) - pos.Price()*spot) * pos.Qty()
+			continue
+		}
+		vol := 0.0
+		if pos.IsOption() {
+			vol = shocked.Vol(pos.Expiry(), pos.Strike())
+		}
+		pv += pos.PV(at, spot, fwd, vol)
+	}
+	return pv
+}
+
+// ScenarioGrid is a matrix of spot and vol shocks, under the same skew shock and time decay
+type ScenarioGrid struct {
+	SpotShocks []float64
+	VolShocks  []float64
+	SkewShock  float64
+	Days       float64
+}
+
+// ScenarioResult holds the PnL against the current PV for each spot shock (row) and vol shock (column)
+type ScenarioResult struct {
+	Grid      ScenarioGrid
+	BasePV    float64
+	PnL       [][]float64
+	Worst     Scenario
+	WorstLoss float64 // PnL of the worst scenario
+}
+
+// RunScenarios revalues the positions over the grid
+func RunScenarios(positions []Position, asof time.Time, spotPrice float64, surf VolSurface, grid ScenarioGrid) ScenarioResult {
+	res := ScenarioResult{
+		Grid:      grid,
+		BasePV:    Revalue(positions, asof, spotPrice, surf, Scenario{}),
+		PnL:       make([][]float64, len(grid.SpotShocks)),
+		WorstLoss: math.Inf(1),
+	}
+	for i, ds := range grid.SpotShocks {
+		res.PnL[i] = make([]float64, len(grid.VolShocks))
+		for j, dv := range grid.VolShocks {
+			s := Scenario{SpotShock: ds, VolShock: dv, SkewShock: grid.SkewShock, Days: grid.Days}
+			res.PnL[i][j] = Revalue(positions, asof, spotPrice, surf, s) - res.BasePV
+			if res.PnL[i][j] < res.WorstLoss {
+				res.Worst, res.WorstLoss = s, res.PnL[i][j]
+			}
+		}
+	}
+	return res
+}
+
+// PortfolioScenarios revalues the positions of the portfolio over the grid
+func PortfolioScenarios(p Portfolio, asof time.Time, spotPrice float64, surf VolSurface, grid ScenarioGrid) ScenarioResult {
+	return RunScenarios(p.Positions(), asof, spotPrice, surf, grid)
+}
+
+// Print shows the PnL matrix, spot shocks down and vol shocks across, and the worst case
+func (res ScenarioResult) Print() {
+	table := tablewriter.NewWriter(os.Stdout)
+	header := []string{"SPOT \\ VOL"}
+	for _, dv := range res.Grid.VolShocks {
+		header = append(header, fmt.Sprintf("%+.0f", dv*100))
+	}
+	table.SetHeader(header)
+	for i, ds := range res.Grid.SpotShocks {
+		row := []string{fmt.Sprintf("%+.0f%%", ds*100)}
+		for _, pnl := range res.PnL[i] {
+			row = append(row, fmt.Sprintf("%.2f", pnl))
+		}
+		table.Append(row)
+	}
+	table.Render()
+	fmt.Printf("skew %+.0f, %.0f days, base PV %.2f\n", res.Grid.SkewShock*100, res.Grid.Days, res.BasePV)
+	fmt.Printf("worst case: %s PnL %.2f\n", res.Worst, res.WorstLoss)
+}
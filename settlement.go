@@ -0,0 +1,110 @@
+package bean
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// IndexPricer gives the index price of an underlying on an exchange at a time, it is implemented by mds.MDS
+type IndexPricer interface {
+	GetIndexPrice(exName string, underlying Pair, t time.Time) (float64, error)
+}
+
+// IndexPriceFunc is an IndexPricer from a function, e.g. over index prices loaded for a backtest
+type IndexPriceFunc func(exName string, underlying Pair, t time.Time) (float64, error)
+
+func (f IndexPriceFunc) GetIndexPrice(exName string, underlying Pair, t time.Time) (float64, error) {
+	return f(exName, underlying, t)
+}
+
+// ExpirySettlement is the settlement of an expired position
+type ExpirySettlement struct {
+	Position   Position
+	Time       time.Time // the expiry, 08:00 UTC on Deribit
+	IndexPrice float64
+	Coin       Coin    // the settlement coin
+	Amount     float64 // credited to the settlement coin, negative if debited
+}
+
+func (s ExpirySettlement) String() string {
+	return fmt.Sprintf("%s %s qty %g settled at %g: %+g %s", s.Time.Format(time.RFC3339), s.Position.Name(),
+		s.Position.Qty(), s.IndexPrice, s.Amount, s.Coin)
+}
+
+// Expired returns true if the position is in an option or a future past its expiry
+func (p Position) Expired(asof time.Time) bool {
+	return !p.Perp() && !p.Index() && !asof.Before(p.Expiry())
+}
+
+// SettlementAmount returns what the position is settled for at the index price, in the settlement coin.
+// Futures realise their PnL from the entry price, as SettlePnL. Options pay their intrinsic value, the premium
+// having been paid in cash when traded. On inverse contracts the intrinsic value is paid in coin at the index price
+func (p Position) SettlementAmount(indexPrice float64) float64 {
+	if !p.IsOption() {
+		return p.SettlePnL(indexPrice)
+	}
+	intrinsic := math.Max(indexPrice-p.Strike(), 0.0)
+	if p.CallPut() == Put {
+		intrinsic = math.Max(p.Strike()-indexPrice, 0.0)
+	}
+	if p.Settlement() == Inverse {
+		intrinsic /= indexPrice
+	}
+	return intrinsic * p.qty
+}
+
+// SettlementError is an expired position left unsettled as its index price could not be found
+type SettlementError struct {
+	Position Position
+	Err      error
+}
+
+func (e SettlementError) Error() string {
+	return fmt.Sprintf("no index price to settle %s: %v", e.Position.Name(), e.Err)
+}
+
+// SettlementErrors are the expired positions SettleExpired could not settle
+type SettlementErrors []SettlementError
+
+func (es SettlementErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// SettleExpired settles the positions of the portfolio expired at asof against the index price at their expiry,
+// credits or debits their settlement coins, and removes them from the portfolio. Positions whose index price
+// cannot be found are left in the portfolio for a later call, the others are still settled, and the positions
+// left are returned as SettlementErrors with the settlements done
+func SettleExpired(port Portfolio, asof time.Time, pricer IndexPricer) ([]ExpirySettlement, error) {
+	var settled []ExpirySettlement
+	var errs SettlementErrors
+	for _, pos := range port.Positions() {
+		if !pos.Expired(asof) {
+			continue
+		}
+		index, err := pricer.GetIndexPrice(pos.Exchange(), pos.Underlying(), pos.Expiry())
+		if err != nil {
+			errs = append(errs, SettlementError{Position: pos, Err: err})
+			continue
+		}
+		s := ExpirySettlement{
+			Position:   pos,
+			Time:       pos.Expiry(),
+			IndexPrice: index,
+			Coin:       pos.SettleCoin(),
+			Amount:     pos.SettlementAmount(index),
+		}
+		port.AddBalance(s.Coin, s.Amount)
+		port.RemovePosition(pos.Contract)
+		settled = append(settled, s)
+	}
+	if len(errs) > 0 {
+		return settled, errs
+	}
+	return settled, nil
+}
@@ -1,19 +1,9 @@
 package bean
 
 import (
-	"fmt"
-	"math"
 	"time"
 )
 
-type Operation int
-
-const ( // iota is reset to 0
-	PlaceLimitOrder Operation = 0
-	CancelOpenOrder Operation = 1
-	Wait            Operation = 2
-)
-
 // exchange is a struct for holding common member variables and base functions
 type BaseStrat struct {
 	Tick time.Duration
@@ -31,67 +21,6 @@ func (s BaseStrat) FormatParams() string {
 	return ""
 }
 
-type TradeAction struct {
-	ExName string
-	Op     Operation
-	Pair   Pair
-	Params map[string]interface{}
-}
-
-func (t TradeAction) Show() string {
-	switch t.Op {
-	case PlaceLimitOrder:
-		if t.Params["amount"].(float64) > 0 {
-			return "`b[" + t.Pair.String() + "]:" + t.ExName[0:3] + " " + t.Pair.FormatPrice(t.Params["price"].(float64)) + " " + fmt.Sprint(math.Round(t.Params["amount"].(float64)*100)/100) + "`\n"
-		} else {
-			return "`s[" + t.Pair.String() + "]:" + t.ExName[0:3] + " " + t.Pair.FormatPrice(t.Params["price"].(float64)) + " " + fmt.Sprint(math.Round(t.Params["amount"].(float64)*100)/100) + "`\n"
-		}
-	case CancelOpenOrder:
-		return fmt.Sprint(t.ExName[0:2], " Cancel order ", t.Pair, t.Params["orderid"])
-	case Wait:
-		return fmt.Sprint("Wait for ", t.Params["time"], " seconds")
-	default:
-		return fmt.Sprint(t)
-	}
-}
-
-type TradeActionT struct {
-	Time   time.Time
-	Action TradeAction
-}
-
-func CancelOrderAction(exName string, pair Pair, oid string) TradeAction {
-	params := make(map[string]interface{})
-	params["orderid"] = oid
-	return TradeAction{
-		ExName: exName,
-		Op:     CancelOpenOrder,
-		Pair:   pair,
-		Params: params,
-	}
-}
-
-func PlaceLimitOrderAction(exName string, pair Pair, price, amount float64) TradeAction {
-	params := make(map[string]interface{})
-	params["price"] = price
-	params["amount"] = amount
-	return TradeAction{
-		ExName: exName,
-		Op:     PlaceLimitOrder,
-		Pair:   pair,
-		Params: params,
-	}
-}
-
-func WaitAction(nSec int) TradeAction {
-	params := make(map[string]interface{})
-	params["time"] = nSec
-	return TradeAction{
-		Op:     Wait,
-		Params: params,
-	}
-}
-
 type Strat interface {
 	GetExchangeNames() []string                  // get exchange names used
 	GetPairs() []Pair                            // get relevant pairs
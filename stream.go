@@ -0,0 +1,287 @@
+package bean
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BookUpdate is an orderbook update of a stream. A snapshot is sent first and again after every reconnect,
+// the consumer then resyncs, e.g. with L2OrderBook.Resync, and applies the diffs that follow
+type BookUpdate struct {
+	Pair     Pair
+	Snapshot bool
+	Book     OrderBookT // the snapshot, if Snapshot
+	Diff     DepthDiff  // the diff from the previous update, if not Snapshot
+}
+
+// StreamStatus is a change of the connection of a stream
+type StreamStatus struct {
+	Time      time.Time
+	Pair      Pair  // the pair whose subscription changed, zero if the whole connection did
+	Connected bool  // false when the stream lost its connection, true once reconnected and resubscribed
+	Err       error // why the connection was lost
+}
+
+// Stream delivers the market data and own order updates of the pairs it was subscribed to. The producer waits
+// for the consumer to read every orderbook update and order event. Trades and Status are lossy instead: once
+// their buffer is full the oldest update is dropped, so that a consumer not reading them does not stall the
+// others. The producer closes the channels once the stream is closed
+type Stream struct {
+	Books  chan BookUpdate
+	Trades chan Transaction
+	Orders chan OrderEvent // state changes and fills of our orders
+	Status chan StreamStatus
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewStream creates a stream with channels of given buffer, for StreamingExchange implementations
+func NewStream(buffer int) *Stream {
+	return &Stream{
+		Books:  make(chan BookUpdate, buffer),
+		Trades: make(chan Transaction, buffer),
+		Orders: make(chan OrderEvent, buffer),
+		Status: make(chan StreamStatus, buffer),
+		done:   make(chan struct{}),
+	}
+}
+
+// Close stops the stream, the producer then closes the channels
+func (s *Stream) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Done is closed when the stream is closed
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// SendBook sends an orderbook update unless the stream is closed, it returns false once the stream is closed
+func (s *Stream) SendBook(u BookUpdate) bool {
+	select {
+	case s.Books <- u:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// SendTrade sends a trade unless the stream is closed, dropping the oldest trade if the buffer is full
+func (s *Stream) SendTrade(txn Transaction) bool {
+	for {
+		select {
+		case <-s.done:
+			return false
+		case s.Trades <- txn:
+			return true
+		default:
+			select {
+			case <-s.Trades:
+			default:
+			}
+		}
+	}
+}
+
+func (s *Stream) SendOrder(ev OrderEvent) bool {
+	select {
+	case s.Orders <- ev:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// SendStatus sends a status change unless the stream is closed, dropping the oldest one if the buffer is full
+func (s *Stream) SendStatus(st StreamStatus) bool {
+	for {
+		select {
+		case <-s.done:
+			return false
+		case s.Status <- st:
+			return true
+		default:
+			select {
+			case <-s.Status:
+			default:
+			}
+		}
+	}
+}
+
+// CloseChannels is called by the producer once it stopped sending
+func (s *Stream) CloseChannels() {
+	close(s.Books)
+	close(s.Trades)
+	close(s.Orders)
+	close(s.Status)
+}
+
+// StreamingExchange is implemented by exchanges pushing their market data, e.g. over websockets. The
+// implementation reconnects and resubscribes on its own, reporting it on Status and resending orderbook snapshots
+type StreamingExchange interface {
+	Exchange
+	Subscribe(pairs []Pair) (*Stream, error)
+}
+
+// ErrSubscribed is returned when subscribing to a PollingExchange with a stream still open
+var ErrSubscribed = errors.New("exchange already has an open stream")
+
+// PollingExchange turns a polling Exchange into a StreamingExchange: every Interval it polls the orderbooks,
+// recent trades and account orders of the subscribed pairs and streams what changed. An empty orderbook, which
+// exchanges return when the query fails, is taken as a lost connection. Own orders are tracked with an
+// OrderManager, those placed through PlaceLimitOrder from the start and others once seen in the account orders
+type PollingExchange struct {
+	Exchange
+	Interval time.Duration
+	Buffer   int // of the stream channels
+
+	mu       sync.Mutex // guards streamed
+	om       *OrderManager
+	streamed bool
+}
+
+func NewPollingExchange(ex Exchange, interval time.Duration) *PollingExchange {
+	return &PollingExchange{
+		Exchange: ex,
+		Interval: interval,
+		Buffer:   100,
+		om:       NewOrderManager(ex),
+	}
+}
+
+// PlaceLimitOrder places the order and tracks it, so that it is streamed even if filled before the next poll
+func (p *PollingExchange) PlaceLimitOrder(pair Pair, price float64, amount float64) (string, error) {
+	oid, err := p.Exchange.PlaceLimitOrder(pair, price, amount)
+	if err != nil {
+		return oid, err
+	}
+	p.om.Track(pair, oid, price, amount)
+	return oid, nil
+}
+
+// Subscribe starts polling pairs until the stream is closed, only one stream can be open at a time
+func (p *PollingExchange) Subscribe(pairs []Pair) (*Stream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.streamed {
+		return nil, ErrSubscribed
+	}
+	p.streamed = true
+	s := NewStream(p.Buffer)
+	go p.poll(s, pairs)
+	return s, nil
+}
+
+// pairPoll is what was last streamed of a pair
+type pairPoll struct {
+	book      OrderBookT
+	connected bool
+	lastTrade time.Time
+	seen      map[string]bool // trade ids at lastTrade
+}
+
+func (p *PollingExchange) poll(s *Stream, pairs []Pair) {
+	defer func() {
+		p.mu.Lock()
+		p.streamed = false
+		p.mu.Unlock()
+		s.CloseChannels()
+	}()
+	polls := make(map[Pair]*pairPoll, len(pairs))
+	for _, pair := range pairs {
+		polls[pair] = &pairPoll{lastTrade: time.Now(), seen: make(map[string]bool)}
+	}
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		for _, pair := range pairs {
+			if !p.pollPair(s, pair, polls[pair]) {
+				return
+			}
+		}
+		if !p.pollOrders(s, pairs) {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// pollPair streams the orderbook and new trades of pair, it returns false once the stream is closed
+func (p *PollingExchange) pollPair(s *Stream, pair Pair, pp *pairPoll) bool {
+	now := time.Now()
+	ob := p.GetOrderBook(pair)
+	if ob.OrderBookCore == nil || ob.Empty() {
+		if pp.connected {
+			pp.connected = false
+			status := StreamStatus{Time: now, Pair: pair, Err: errors.New("empty orderbook for " + pair.String())}
+			return s.SendStatus(status)
+		}
+		return true
+	}
+	if !pp.connected {
+		// (re)subscribed, start over from a snapshot
+		pp.connected = true
+		pp.book = OrderBookT{OrderBook: ob.Clone(), Time: now, ChangeId: pp.book.ChangeId + 1}
+		if !s.SendStatus(StreamStatus{Time: now, Pair: pair, Connected: true}) ||
+			!s.SendBook(BookUpdate{Pair: pair, Snapshot: true, Book: pp.book}) {
+			return false
+		}
+	} else if updates := pp.book.Diff(ob); len(updates) > 0 {
+		seq := pp.book.ChangeId + 1
+		pp.book = OrderBookT{OrderBook: ob.Clone(), Time: now, ChangeId: seq}
+		diff := DepthDiff{Time: now, FirstSeq: seq, Seq: seq, Updates: updates}
+		if !s.SendBook(BookUpdate{Pair: pair, Diff: diff}) {
+			return false
+		}
+	}
+
+	// exchanges list their trades newest or oldest first, stream them in time order
+	txns := append(Transactions{}, p.GetTransactionHistory(pair)...)
+	sort.SliceStable(txns, func(i, j int) bool {
+		if !txns[i].TimeStamp.Equal(txns[j].TimeStamp) {
+			return txns[i].TimeStamp.Before(txns[j].TimeStamp)
+		}
+		return txns[i].TxnID < txns[j].TxnID
+	})
+	for _, txn := range txns {
+		if txn.TimeStamp.Before(pp.lastTrade) || txn.TimeStamp.Equal(pp.lastTrade) && pp.seen[txn.TxnID] {
+			continue
+		}
+		if txn.TimeStamp.After(pp.lastTrade) {
+			pp.lastTrade = txn.TimeStamp
+			pp.seen = make(map[string]bool)
+		}
+		pp.seen[txn.TxnID] = true
+		if !s.SendTrade(txn) {
+			return false
+		}
+	}
+	return true
+}
+
+// pollOrders tracks the account orders of pairs and streams their changes
+func (p *PollingExchange) pollOrders(s *Stream, pairs []Pair) bool {
+	for _, pair := range pairs {
+		for _, o := range p.GetAccountOrders(pair) {
+			amount := o.LeftAmount + o.FilledAmount
+			if o.Side == SELL {
+				amount = -amount
+			}
+			p.om.Track(pair, o.OrderID, o.PlacedPrice, amount)
+		}
+	}
+	events := p.om.Update()
+	for _, ev := range events {
+		if !s.SendOrder(ev) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/brew"
+	"bean/db/mds"
+	"github.com/stretchr/testify/assert"
+)
+
+// buyOnTwoExchanges buys BTC with USDT on Binance, then ETH with BTC on Huobi
+type buyOnTwoExchanges struct {
+	bean.BaseStrat
+	ticks int
+}
+
+var (
+	btcusdt = bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	ethbtc  = bean.Pair{Coin: bean.ETH, Base: bean.BTC}
+)
+
+func (s *buyOnTwoExchanges) GetExchangeNames() []string {
+	return []string{bean.NameBinance, bean.NameHuobi}
+}
+func (s *buyOnTwoExchanges) GetPairs() []bean.Pair { return []bean.Pair{btcusdt, ethbtc} }
+
+func (s *buyOnTwoExchanges) Grind(exs map[string]bean.Exchange) []bean.TradeAction {
+	s.ticks++
+	switch s.ticks {
+	case 1:
+		return []bean.TradeAction{bean.PlaceLimitOrderAction(bean.NameBinance, btcusdt, 101, 1)}
+	case 2:
+		return []bean.TradeAction{bean.PlaceLimitOrderAction(bean.NameHuobi, ethbtc, 0.021, 10)}
+	}
+	return nil
+}
+
+func TestMultiExchangeAccounting(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "accounting")
+	defer os.RemoveAll(dir)
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	src := mds.NewFileSource(dir)
+	for _, exName := range []string{bean.NameBinance, bean.NameHuobi} {
+		obts := bean.OrderBookTS{{Time: start, OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}})}}
+		txn := bean.Transactions{
+			{Pair: btcusdt, Price: 100, Amount: 1, TimeStamp: start, Maker: bean.Buyer},
+			{Pair: btcusdt, Price: 110, Amount: 1, TimeStamp: start.Add(15 * time.Minute), Maker: bean.Seller},
+		}
+		assert.Nil(t, src.Save(exName, btcusdt, obts, txn))
+		obts = bean.OrderBookTS{{Time: start, OrderBook: bean.NewOrderBook([]bean.Order{{Price: 0.019, Amount: 50}}, []bean.Order{{Price: 0.021, Amount: 50}})}}
+		txn = bean.Transactions{
+			{Pair: ethbtc, Price: 0.02, Amount: 1, TimeStamp: start, Maker: bean.Buyer},
+			{Pair: ethbtc, Price: 0.025, Amount: 1, TimeStamp: start.Add(15 * time.Minute), Maker: bean.Seller},
+		}
+		assert.Nil(t, src.Save(exName, ethbtc, obts, txn))
+	}
+
+	strat := &buyOnTwoExchanges{BaseStrat: bean.BaseStrat{Tick: 20 * time.Minute}}
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.USDT: 1000})
+	res := brew.NewBackTestFrom(src).Simulate(strat, start, start.Add(time.Hour), port)
+	assert.Len(t, res.ExTxn[bean.NameBinance], 1)
+	assert.Len(t, res.ExTxn[bean.NameHuobi], 1)
+
+	// ETH has no USDT market, it is crossed through BTC
+	rates := res.RatesBook(bean.USDT)
+	assert.InDelta(t, 0.025*110, bean.LookupRate(bean.Pair{Coin: bean.ETH, Base: bean.USDT}, start.Add(time.Hour), rates), 1e-9)
+
+	// one entry per exchange and pair, in exchange name order
+	pnls := res.PairPnL(bean.USDT)
+	assert.Len(t, pnls, 4)
+	assert.Equal(t, bean.NameBinance, pnls[0].ExName)
+	assert.Equal(t, btcusdt, pnls[0].Pair)
+	assert.Equal(t, 0, pnls[1].NumTrades)
+	assert.Equal(t, bean.NameHuobi, pnls[3].ExName)
+	assert.Equal(t, ethbtc, pnls[3].Pair)
+	assert.Equal(t, 10.0, pnls[3].Position)
+	assert.InDelta(t, 10*0.025*110-0.21*110-pnls[3].Fee, pnls[3].PnL, 1e-9)
+
+	// the pair PnLs add up to the PnL of the aggregate portfolio, all the prices being final by the last trade
+	total := 0.0
+	for _, p := range pnls {
+		total += p.PnL
+	}
+	perf := res.Performance(bean.USDT)
+	assert.InDelta(t, total, perf[len(perf)-1].PV-perf[0].PV, 1e-9)
+	assert.InDelta(t, 2*1000.0, perf[0].PV, 1e-9)
+	assert.NotPanics(t, func() {
+		assert.InDelta(t, total, res.QuickEval().NetPnL(), 1e-9)
+	})
+}
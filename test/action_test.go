@@ -0,0 +1,158 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/brew"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTradeActionJSON(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	actions := []bean.TradeAction{
+		bean.PlaceLimitOrderAction(bean.NameBinance, pair, 8000, 0.5),
+		bean.LimitOrderAction(bean.NameBinance, pair, bean.LimitParams{Price: 8100, Amount: -1, Life: bean.FillOrKill, ReduceOnly: true}),
+		bean.CancelOrderAction(bean.NameBinance, pair, "42"),
+		bean.CancelAllOrdersAction(bean.NameBinance, pair),
+		bean.AmendOrderAction(bean.NameBinance, pair, "43", 8050, 0.25),
+		bean.WaitAction(2),
+	}
+	data, err := json.Marshal(actions)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"op":"LIMIT"`)
+	assert.Contains(t, string(data), `"life":"FOK"`)
+
+	var replayed []bean.TradeAction
+	assert.Nil(t, json.Unmarshal(data, &replayed))
+	assert.Equal(t, actions, replayed)
+	assert.Equal(t, 2*time.Second, replayed[5].Params.(bean.WaitParams).Duration)
+
+	bad := bean.TradeAction{ExName: bean.NameBinance, Op: bean.Wait, Params: bean.CancelParams{OrderID: "1"}}
+	assert.NotNil(t, bad.Validate())
+	_, err = json.Marshal(bad)
+	assert.NotNil(t, err)
+	assert.NotNil(t, json.Unmarshal([]byte(`{"op":"MARKET","params":{}}`), &replayed[0]))
+}
+
+func TestLimitParamsCheck(t *testing.T) {
+	ob := bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 1}}, []bean.Order{{Price: 101, Amount: 1}})
+
+	_, err := bean.LimitParams{Price: 101, Amount: 0.5, PostOnly: true}.Check(ob, 0)
+	assert.Equal(t, bean.ErrPostOnlyWouldTake, err)
+	amt, err := bean.LimitParams{Price: 100, Amount: 0.5, PostOnly: true}.Check(ob, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, amt)
+
+	_, err = bean.LimitParams{Price: 101, Amount: 2, Life: bean.FillOrKill}.Check(ob, 0)
+	assert.Equal(t, bean.ErrFillOrKill, err)
+	_, err = bean.LimitParams{Price: 101, Amount: 1, Life: bean.FillOrKill}.Check(ob, 0)
+	assert.Nil(t, err)
+
+	amt, err = bean.LimitParams{Price: 99, Amount: -2, ReduceOnly: true}.Check(ob, 0.3)
+	assert.Nil(t, err)
+	assert.Equal(t, -0.3, amt)
+	_, err = bean.LimitParams{Price: 99, Amount: 2, ReduceOnly: true}.Check(ob, 0.3)
+	assert.Equal(t, bean.ErrNotReducing, err)
+}
+
+// actionSim is a simulator whose offer thins out a second after start
+func actionSim(t *testing.T, dir string, start time.Time) exchange.Simulator {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	obts := bean.OrderBookTS{
+		{Time: start, OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}})},
+		{Time: start.Add(time.Second), OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 1}, {Price: 102, Amount: 5}})},
+	}
+	src := mds.NewFileSource(dir)
+	assert.Nil(t, src.Save(bean.NameBinance, pair, obts, nil))
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 2, bean.USDT: 10000})
+	sim := exchange.NewSimulatorFrom(src, bean.NameBinance, []bean.Pair{pair}, start, start.Add(time.Hour), port)
+	sim.SetFeeSchedule(bean.FeeSchedule{})
+	return sim
+}
+
+func TestPerformActions(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "action")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	limit := func(p bean.LimitParams) []bean.TradeAction {
+		return []bean.TradeAction{bean.LimitOrderAction(bean.NameBinance, pair, p)}
+	}
+	// perform runs the actions and returns the fills once the simulator moved on by 2 seconds
+	perform := func(sim *exchange.Simulator, actions []bean.TradeAction) (cancelled, placed []brew.ExNameWithOID, fills bean.Transactions) {
+		exs := map[string]bean.Exchange{bean.NameBinance: sim}
+		cancelled, placed = brew.PerformActions(&exs, actions)
+		sim.SetTime(sim.Now().Add(2 * time.Second))
+		return cancelled, placed, sim.GetTrades()
+	}
+
+	// immediate or cancel fills what it can on arrival and the rest is cancelled
+	sim := actionSim(t, dir, start)
+	_, placed, fills := perform(&sim, limit(bean.LimitParams{Price: 101, Amount: 8, Life: bean.InstantOrCancelled}))
+	assert.Len(t, placed, 1)
+	assert.Len(t, fills, 1)
+	assert.Equal(t, 5.0, fills[0].Amount)
+	assert.Empty(t, sim.GetMyOrders(pair))
+
+	// fill or kill is not placed unless fully filled
+	sim = actionSim(t, dir, start)
+	_, placed, fills = perform(&sim, limit(bean.LimitParams{Price: 101, Amount: 8, Life: bean.FillOrKill}))
+	assert.Empty(t, placed)
+	assert.Empty(t, fills)
+	sim = actionSim(t, dir, start)
+	_, _, fills = perform(&sim, limit(bean.LimitParams{Price: 101, Amount: 5, Life: bean.FillOrKill}))
+	assert.Len(t, fills, 1)
+	assert.Equal(t, 5.0, fills[0].Amount)
+
+	// with latency it is checked against the book it arrives at, which only has 1 left at 101
+	sim = actionSim(t, dir, start)
+	sim.SetLatency(exchange.Latency{Entry: exchange.FixedLatency(time.Second)})
+	_, placed, fills = perform(&sim, limit(bean.LimitParams{Price: 101, Amount: 3, Life: bean.FillOrKill}))
+	assert.Empty(t, placed)
+	assert.Empty(t, fills)
+
+	// post only does not take liquidity
+	sim = actionSim(t, dir, start)
+	_, placed, _ = perform(&sim, limit(bean.LimitParams{Price: 101, Amount: 1, PostOnly: true}))
+	assert.Empty(t, placed)
+	_, placed, fills = perform(&sim, limit(bean.LimitParams{Price: 100, Amount: 1, PostOnly: true}))
+	assert.Len(t, placed, 1)
+	assert.Empty(t, fills)
+	assert.Len(t, sim.GetMyOrders(pair), 1)
+
+	// reduce only is cut to the 2 BTC held, and not placed if it adds to them
+	sim = actionSim(t, dir, start)
+	_, placed, _ = perform(&sim, limit(bean.LimitParams{Price: 99, Amount: 1, ReduceOnly: true}))
+	assert.Empty(t, placed)
+	_, _, fills = perform(&sim, limit(bean.LimitParams{Price: 99, Amount: -5, ReduceOnly: true}))
+	assert.Len(t, fills, 1)
+	assert.Equal(t, -2.0, fills[0].Amount)
+
+	// cancel all cancels every open order of the pair
+	sim = actionSim(t, dir, start)
+	perform(&sim, []bean.TradeAction{bean.PlaceLimitOrderAction(bean.NameBinance, pair, 98, 1), bean.PlaceLimitOrderAction(bean.NameBinance, pair, 97, 1)})
+	assert.Len(t, sim.GetMyOrders(pair), 2)
+	cancelled, _, _ := perform(&sim, []bean.TradeAction{bean.CancelAllOrdersAction(bean.NameBinance, pair)})
+	assert.Len(t, cancelled, 2)
+	assert.Empty(t, sim.GetMyOrders(pair))
+
+	// amend cancels and replaces on the simulator
+	sim = actionSim(t, dir, start)
+	_, placed, _ = perform(&sim, []bean.TradeAction{bean.PlaceLimitOrderAction(bean.NameBinance, pair, 97, 1)})
+	oid := placed[0].OrderID
+	cancelled, placed, _ = perform(&sim, []bean.TradeAction{bean.AmendOrderAction(bean.NameBinance, pair, oid, 98, 2)})
+	assert.Equal(t, oid, cancelled[0].OrderID)
+	assert.Len(t, placed, 1)
+	orders := sim.GetMyOrders(pair)
+	assert.Len(t, orders, 1)
+	assert.Equal(t, placed[0].OrderID, orders[0].OrderID)
+	assert.Equal(t, 98.0, orders[0].PlacedPrice)
+	assert.Equal(t, 2.0, orders[0].LeftAmount)
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"github.com/stretchr/testify/assert"
+)
+
+// txnChunk has the columns the cache stores transactions in
+type txnChunk struct {
+	Time            []int64
+	Price           []float64
+	Amount          []float64
+	Maker           []bean.TraderType
+	TxnID           []string
+	Commission      []float64
+	CommissionAsset []bean.Coin
+}
+
+// writeTxnChunk writes the cache chunk holding txn for the window [from, to)
+func writeTxnChunk(t *testing.T, dir string, from, to time.Time, txn bean.Transactions) {
+	var chunk txnChunk
+	for _, tx := range txn {
+		chunk.Time = append(chunk.Time, tx.TimeStamp.UnixNano())
+		chunk.Price = append(chunk.Price, tx.Price)
+		chunk.Amount = append(chunk.Amount, tx.Amount)
+		chunk.Maker = append(chunk.Maker, tx.Maker)
+		chunk.TxnID = append(chunk.TxnID, tx.TxnID)
+		chunk.Commission = append(chunk.Commission, tx.Commission)
+		chunk.CommissionAsset = append(chunk.CommissionAsset, tx.CommissionAsset)
+	}
+	assert.Nil(t, os.MkdirAll(dir, 0755))
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%d-%d.gob.gz", from.UnixNano(), to.UnixNano())))
+	assert.Nil(t, err)
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	assert.Nil(t, gob.NewEncoder(zw).Encode(chunk))
+	assert.Nil(t, zw.Close())
+}
+
+func TestCacheChunks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bean")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	var txn bean.Transactions
+	for i := 0; i < 12; i++ {
+		txn = append(txn, bean.Transaction{Pair: pair, Price: 100 + float64(i), Amount: 1, TimeStamp: start.Add(time.Duration(i*10) * time.Minute), Maker: bean.Buyer, TxnID: fmt.Sprint(i)})
+	}
+	path := filepath.Join(dir, bean.NameBinance, "BTC_USDT", "transaction")
+	writeTxnChunk(t, path, start, start.Add(time.Hour), txn[:6])
+	writeTxnChunk(t, path, start.Add(time.Hour), start.Add(2*time.Hour), txn[6:])
+
+	ids := func(txn bean.Transactions) []string {
+		var ids []string
+		for _, t := range txn {
+			ids = append(ids, t.TxnID)
+		}
+		return ids
+	}
+	// a request held in the cache is read across its chunks without going to MDS
+	cache := mds.NewCache(dir, nil)
+	got, err := cache.GetTransactions2(bean.NameBinance, pair, start.Add(30*time.Minute), start.Add(90*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3", "4", "5", "6", "7", "8", "9"}, ids(got))
+	for _, tx := range got {
+		assert.Equal(t, pair, tx.Pair)
+	}
+	got, err = cache.GetTransactions2(bean.NameBinance, pair, start, start.Add(2*time.Hour-time.Nanosecond))
+	assert.Nil(t, err)
+	assert.Equal(t, ids(txn), ids(got))
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/brew"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+// bookSource serves one orderbook snapshot per instrument and no trades
+type bookSource map[string]bean.OrderBookT
+
+func (src bookSource) GetContractOrderBookTS(con *bean.Contract, start, end time.Time, depth int, sample time.Duration) (bean.OrderBookTS, error) {
+	return bean.OrderBookTS{src[con.Name()]}, nil
+}
+
+func (src bookSource) GetContractTXNs(exName string, instr string, start, end time.Time) (bean.ContractTXNs, error) {
+	return nil, nil
+}
+
+func TestContractSimulator(t *testing.T) {
+	t0 := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	fut, opt := "BTC-27DEC19", "BTC-27DEC19-8000-C"
+	src := bookSource{
+		fut: {Time: t0, OrderBook: bean.NewOrderBook([]bean.Order{{Price: 7990, Amount: 1000}}, []bean.Order{{Price: 8010, Amount: 1000}})},
+		opt: {Time: t0, OrderBook: bean.NewOrderBook([]bean.Order{{Price: 0.04, Amount: 10}}, []bean.Order{{Price: 0.05, Amount: 10}})},
+	}
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1})
+	sim := exchange.NewContractSimulatorFrom(src, bean.NameDeribit, []string{fut, opt}, t0, t0.Add(time.Hour), time.Minute, port)
+	sim.SetFeeSchedule(bean.FeeSchedule{Default: bean.FeeRate{Maker: 0.0003, Taker: 0.0003}})
+
+	_, err := sim.PlaceLimitOrder(fut, 8010, 100)
+	assert.Nil(t, err)
+	_, err = sim.PlaceLimitOrder(opt, 0.04, -1)
+	assert.Nil(t, err)
+	sim.SetTime(t0.Add(time.Minute))
+
+	pos := sim.GetPosition(fut)
+	assert.Equal(t, 100.0, pos.Qty())
+	assert.Equal(t, 8010.0, pos.Price())
+	assert.Equal(t, -1.0, sim.GetPosition(opt).Qty())
+	futFee := 0.0003 * 100 * 10 / 8010
+	assert.InDelta(t, 1+0.04-futFee-0.0003, port.Balance(bean.BTC), 1e-12)
+	assert.Len(t, sim.GetTrades(), 2)
+
+	// equity marks the future and the option at mid
+	equity := port.Balance(bean.BTC) + (1/8010.0-1/8000.0)*1000 - 0.045
+	assert.InDelta(t, equity, sim.Equity(bean.BTC), 1e-12)
+	im, _ := sim.Margins(bean.BTC)
+	assert.InDelta(t, 0.01*1000/8000.0+0.15+0.045, im, 1e-12)
+
+	// selling 10 more calls needs more than the equity
+	_, err = sim.PlaceLimitOrder(opt, 0.04, -10)
+	assert.Equal(t, exchange.ErrInsufficientMargin, err)
+	assert.Empty(t, sim.GetMyOrders(opt))
+
+	// closing the future realises its PnL
+	_, err = sim.PlaceLimitOrder(fut, 7990, -100)
+	assert.Nil(t, err)
+	sim.SetTime(t0.Add(2 * time.Minute))
+	assert.Equal(t, 0.0, sim.GetPosition(fut).Qty())
+	assert.InDelta(t, 1+0.04-futFee-0.0003+(1/8010.0-1/7990.0)*1000-0.0003*1000/7990, port.Balance(bean.BTC), 1e-12)
+}
+
+// sellOnce sells the pair once at the bid
+type sellOnce struct {
+	bean.BaseStrat
+	pair bean.Pair
+	sold bool
+}
+
+func (s *sellOnce) GetExchangeNames() []string { return []string{bean.NameDeribit} }
+func (s *sellOnce) GetPairs() []bean.Pair      { return []bean.Pair{s.pair} }
+
+func (s *sellOnce) Grind(exs map[string]bean.Exchange) []bean.TradeAction {
+	if s.sold {
+		return nil
+	}
+	s.sold = true
+	bid := exs[bean.NameDeribit].GetOrderBook(s.pair).BestBid().Price
+	return []bean.TradeAction{bean.PlaceLimitOrderAction(bean.NameDeribit, s.pair, bid, -1)}
+}
+
+func TestContractSimulatorStrat(t *testing.T) {
+	t0 := time.Date(2019, 12, 27, 7, 0, 0, 0, time.UTC)
+	opt := "BTC-27DEC19-8000-C"
+	src := bookSource{
+		opt: {Time: t0, OrderBook: bean.NewOrderBook([]bean.Order{{Price: 0.04, Amount: 10}}, []bean.Order{{Price: 0.05, Amount: 10}})},
+	}
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1})
+	sim := exchange.NewContractSimulatorFrom(src, bean.NameDeribit, []string{opt}, t0, t0.Add(2*time.Hour), time.Minute, port)
+	sim.SetFeeSchedule(bean.FeeSchedule{})
+	sim.SetIndexPricer(bean.IndexPriceFunc(func(exName string, underlying bean.Pair, at time.Time) (float64, error) {
+		return 0, errors.New("no index")
+	}))
+
+	// the strategy trades the option as its underlying pair
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USD}
+	strat := &sellOnce{BaseStrat: bean.BaseStrat{Tick: 30 * time.Minute}, pair: pair}
+	trades := brew.NewBackTestFrom(nil).SimulateContracts(strat, &sim, map[bean.Pair]string{pair: opt}, t0, t0.Add(time.Hour))
+	assert.Len(t, trades, 1)
+	assert.Equal(t, -1.0, sim.GetPosition(opt).Qty())
+
+	// the premium is in the balance, the position PV is net of it and its mark value is not
+	assert.InDelta(t, 1.04, port.Balance(bean.BTC), 1e-12)
+	pos := sim.GetPosition(opt)
+	asof := t0.Add(30 * time.Minute)
+	assert.InDelta(t, -pos.OptPrice(asof, 8000, 8000, 0.5)+0.04*8000, pos.PV(asof, 8000, 8000, 0.5), 1e-9)
+	assert.InDelta(t, -pos.OptPrice(asof, 8000, 8000, 0.5), pos.MarkValue(asof, 8000, 8000, 0.5), 1e-12)
+
+	// past the expiry the option is left unsettled without an index price, rather than stopping the backtest
+	assert.Empty(t, sim.Unsettled())
+	sim.SetTime(t0.Add(2 * time.Hour))
+	assert.Len(t, sim.Unsettled(), 1)
+	assert.Equal(t, -1.0, sim.GetPosition(opt).Qty())
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+// bookEx quotes a fixed orderbook with a taker fee
+type bookEx struct {
+	bean.Exchange
+	ob  bean.OrderBook
+	fee float64
+}
+
+func (ex *bookEx) GetOrderBook(pair bean.Pair) bean.OrderBook { return ex.ob }
+func (ex *bookEx) GetTakerFee(pair bean.Pair) float64         { return ex.fee }
+
+func TestConsolidatedBook(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	exs := map[string]bean.Exchange{
+		bean.NameBinance: &bookEx{
+			ob:  bean.NewOrderBook([]bean.Order{{Price: 100, Amount: 1}, {Price: 99, Amount: 2}}, []bean.Order{{Price: 101, Amount: 1}, {Price: 102, Amount: 2}}),
+			fee: 0.001,
+		},
+		bean.NameHuobi: &bookEx{
+			ob:  bean.NewOrderBook([]bean.Order{{Price: 100.05, Amount: 1}}, []bean.Order{{Price: 100.95, Amount: 1}}),
+			fee: 0.002,
+		},
+		bean.NameGate: &bookEx{ob: bean.EmptyOrderBook()},
+	}
+	cb := bean.ConsolidateOrderBooks(exs, pair)
+	assert.Len(t, cb.Bids, 3)
+	assert.Len(t, cb.Asks, 3)
+
+	// the better quote on Huobi is worse after its higher fee
+	assert.Equal(t, bean.NameBinance, cb.BestBid().Venue)
+	assert.InDelta(t, 99.9, cb.BestBid().Price, 1e-9)
+	assert.Equal(t, 100.0, cb.BestBid().RawPrice)
+	assert.Equal(t, bean.NameBinance, cb.BestAsk().Venue)
+	assert.InDelta(t, 101.101, cb.BestAsk().Price, 1e-9)
+
+	bid, ask, bidSize, askSize := cb.PriceIn(1.5)
+	assert.InDelta(t, 100.05*0.998, bid, 1e-9)
+	assert.InDelta(t, 100.95*1.002, ask, 1e-9)
+	assert.Equal(t, 2.0, bidSize)
+	assert.Equal(t, 2.0, askSize)
+
+	// more than available across the venues gives the worst level and the total
+	bid, bidSize = cb.BidIn(10)
+	assert.InDelta(t, 99*0.999, bid, 1e-9)
+	assert.Equal(t, 4.0, bidSize)
+
+	levels := cb.SellIn(2.5)
+	assert.Len(t, levels, 3)
+	assert.Equal(t, map[string]float64{bean.NameBinance: 1.5, bean.NameHuobi: 1}, bean.ByVenue(levels))
+	price, amount := bean.AveragePrice(levels)
+	assert.Equal(t, 2.5, amount)
+	assert.InDelta(t, (99.9+100.05*0.998+0.5*99*0.999)/2.5, price, 1e-9)
+}
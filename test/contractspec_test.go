@@ -0,0 +1,72 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContractSpecs(t *testing.T) {
+	c, err := bean.ContractFromName("BTC-27DEC19-10000-C")
+	assert.Nil(t, err)
+	assert.Equal(t, bean.NameDeribit, c.Exchange())
+	assert.Equal(t, bean.Inverse, c.Settlement())
+	assert.Equal(t, 0.0015, c.RoundPrice(0.00149))
+
+	c, err = bean.ContractFromName("XBTZ19")
+	assert.Nil(t, err)
+	assert.Equal(t, bean.NameBitMex, c.Exchange())
+	assert.Equal(t, bean.Pair{Coin: bean.BTC, Base: bean.USD}, c.Underlying())
+	assert.Equal(t, time.Date(2019, 12, 27, 12, 0, 0, 0, time.UTC), c.Expiry())
+	assert.Equal(t, "XBTZ19", c.Name())
+
+	c, err = bean.ContractFromName("BTCUSDT")
+	assert.Nil(t, err)
+	assert.True(t, c.Perp())
+	assert.Equal(t, bean.Linear, c.Settlement())
+	assert.Equal(t, bean.USDT, c.SettleCoin())
+
+	c, err = bean.ContractFromExchangeName(bean.NameBinance, "BTCUSDT_191227")
+	assert.Nil(t, err)
+	assert.Equal(t, "BTCUSDT_191227", c.Name())
+	assert.False(t, c.Equal(bean.FutContract(bean.Pair{Coin: bean.BTC, Base: bean.USD}, c.Expiry())))
+
+	// a new underlying only needs a spec
+	_, err = bean.ContractFromName("SOL-PERPETUAL")
+	assert.NotNil(t, err)
+	bean.RegisterContractSpec(bean.ContractSpec{Exchange: bean.NameDeribit, Symbol: "SOL", Perp: "SOL-PERPETUAL",
+		Underlying: bean.Pair{Coin: "SOL", Base: bean.USD}, Settlement: bean.Inverse, SettleCoin: "SOL",
+		Multiplier: 10, FutureTick: 0.01, OptionTick: 0.0005, Naming: bean.DeribitNaming})
+	c, err = bean.ContractFromName("SOL-25SEP20-30-P")
+	assert.Nil(t, err)
+	assert.Equal(t, 30.0, c.Strike())
+	assert.Equal(t, bean.Coin("SOL"), c.Underlying().Coin)
+
+	// names valid on several exchanges need the exchange
+	for _, exName := range []string{"BYBIT", "OKEX"} {
+		bean.RegisterContractSpec(bean.ContractSpec{Exchange: exName, Symbol: "SOLUSDT", Perp: "SOLUSDT",
+			Underlying: bean.Pair{Coin: "SOL", Base: bean.USDT}, Settlement: bean.Linear, SettleCoin: bean.USDT,
+			Multiplier: 1, FutureTick: 0.01, Naming: bean.BinanceNaming})
+	}
+	_, err = bean.ContractFromName("SOLUSDT")
+	assert.NotNil(t, err)
+	c, err = bean.ContractFromExchangeName("OKEX", "SOLUSDT")
+	assert.Nil(t, err)
+	assert.Equal(t, "OKEX", c.Exchange())
+
+	asof := time.Date(2020, 9, 23, 10, 0, 0, 0, time.UTC)
+	c, err = bean.ContractFromPartialNameAt("ETH-MAR-200-P", asof)
+	assert.Nil(t, err)
+	assert.Equal(t, "ETH", string(c.Underlying().Coin))
+	assert.Equal(t, time.Date(2021, 3, 26, 8, 0, 0, 0, time.UTC), c.Expiry())
+	c, err = bean.ContractFromPartialNameAt("FRI", asof)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 9, 25, 8, 0, 0, 0, time.UTC), c.Expiry())
+	_, err = bean.ContractFromPartialNameAt("C", asof)
+	assert.NotNil(t, err)
+	c, err = bean.ContractFromPartialName("PERP")
+	assert.Nil(t, err)
+	assert.True(t, c.Perp())
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/brew"
+	"bean/db/mds"
+	"github.com/stretchr/testify/assert"
+)
+
+// bidOnFirstBook bids once on the first orderbook and counts the events it sees
+type bidOnFirstBook struct {
+	bean.BaseStrat
+	pair   bean.Pair
+	events map[brew.EventType]int
+	books  []float64 // best bid of each book event
+	seen   []float64 // best bid on the simulator on each book event
+}
+
+func (s *bidOnFirstBook) GetExchangeNames() []string                            { return []string{bean.NameBinance} }
+func (s *bidOnFirstBook) GetPairs() []bean.Pair                                 { return []bean.Pair{s.pair} }
+func (s *bidOnFirstBook) Grind(exs map[string]bean.Exchange) []bean.TradeAction { return nil }
+
+func (s *bidOnFirstBook) OnEvent(ev brew.Event, exs map[string]bean.Exchange, sched brew.Scheduler) []bean.TradeAction {
+	s.events[ev.Type]++
+	if ev.Type != brew.BookEvent {
+		return nil
+	}
+	s.books = append(s.books, ev.Book.BestBid().Price)
+	s.seen = append(s.seen, exs[bean.NameBinance].GetOrderBook(s.pair).BestBid().Price)
+	if len(s.books) > 1 {
+		return nil
+	}
+	return []bean.TradeAction{bean.PlaceLimitOrderAction(bean.NameBinance, s.pair, 100, 1)}
+}
+
+func TestSimulateEvents(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "event")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	obts := bean.OrderBookTS{
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}}), Time: start.Add(time.Second)},
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 98, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}}), Time: start.Add(time.Minute)},
+	}
+	txn := bean.Transactions{
+		{Pair: pair, Price: 99.5, Amount: 0.4, TimeStamp: start.Add(30 * time.Second), Maker: bean.Buyer},
+		{Pair: pair, Price: 99.5, Amount: 0.4, TimeStamp: start.Add(90 * time.Second), Maker: bean.Buyer},
+	}
+	src := mds.NewFileSource(dir)
+	assert.Nil(t, src.Save(bean.NameBinance, pair, obts, txn))
+
+	strat := &bidOnFirstBook{pair: pair, events: make(map[brew.EventType]int)}
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1, bean.USDT: 10000})
+	res := brew.NewBackTestFrom(src).SimulateEvents(strat, start, start.Add(time.Hour), port)
+
+	assert.Equal(t, 2, strat.events[brew.BookEvent])
+	assert.Equal(t, 2, strat.events[brew.TradeEvent])
+	assert.Equal(t, []float64{99, 98}, strat.books)
+	// the simulator shows the book of the event being handled
+	assert.Equal(t, strat.books, strat.seen)
+	// the bid placed on the first book is traded through by both trades after it
+	assert.Len(t, res.Txn, 2)
+	for _, fill := range res.Txn {
+		assert.Equal(t, 100.0, fill.Price)
+		assert.Equal(t, 0.4, fill.Amount)
+	}
+}
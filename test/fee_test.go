@@ -0,0 +1,71 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeeSchedule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bean")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, bean.FeeFile)
+	config := `{"binance": {"tier": "MM1", "default": {"maker": 0.001, "taker": 0.001},
+		"tiers": {"MM1": {"maker": -0.0001, "taker": 0.0005}},
+		"pairs": {"BTCUSDT": {"maker": 0.0, "taker": 0.0}}}}`
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(config), 0644))
+
+	fss, err := bean.LoadFeeSchedules(filename)
+	assert.Nil(t, err)
+	fs := fss[bean.NameBinance]
+	ethbtc := bean.Pair{Coin: bean.ETH, Base: bean.BTC}
+	assert.Equal(t, bean.FeeRate{Maker: -0.0001, Taker: 0.0005}, fs.Rate(ethbtc))
+	assert.Equal(t, bean.FeeRate{Maker: 0.0, Taker: 0.0}, fs.Rate(bean.Pair{Coin: bean.BTC, Base: bean.USDT}))
+	assert.Equal(t, bean.FeeRate{Maker: 0.001, Taker: 0.001}, fs.WithTier("VIP0").Rate(ethbtc))
+
+	// buying 10 ETH, 4 as taker, pays commission in ETH, less the maker rebate
+	fee, asset := fs.Rate(ethbtc).Commission(ethbtc, 0.02, 6, 4)
+	assert.InDelta(t, 4*0.0005-6*0.0001, fee, 1e-12)
+	assert.Equal(t, bean.ETH, asset)
+	// selling pays in BTC
+	fee, asset = fs.Rate(ethbtc).Commission(ethbtc, 0.02, 0, -10)
+	assert.InDelta(t, 10*0.02*0.0005, fee, 1e-12)
+	assert.Equal(t, bean.BTC, asset)
+}
+
+func TestFeeScheduleConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bean")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Setenv(bean.BEANEX, os.Getenv(bean.BEANEX))
+	os.Setenv(bean.BEANEX, dir)
+
+	// only a missing file or exchange fall back to the default rates
+	_, err = bean.GetFeeSchedule(bean.NameBinance)
+	assert.Equal(t, bean.ErrNoFeeSchedule, err)
+	assert.Nil(t, os.MkdirAll(bean.BeanexConfigPath(), 0755))
+	filename := bean.BeanexConfigPath() + bean.FeeFile
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"huobi": {"default": {"maker": 0.002, "taker": 0.002}}}`), 0644))
+	_, err = bean.GetFeeSchedule(bean.NameBinance)
+	assert.Equal(t, bean.ErrNoFeeSchedule, err)
+	fs, err := bean.GetFeeSchedule(bean.NameHuobi)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.002, fs.Default.Maker)
+
+	// a malformed file is an error, and the simulator does not run on made up fees
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"binance": {"default": {"maker": "0.001"}}}`), 0644))
+	_, err = bean.GetFeeSchedule(bean.NameBinance)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, bean.ErrNoFeeSchedule, err)
+	assert.Panics(t, func() {
+		exchange.NewSimulatorFrom(mds.NewFileSource(dir), bean.NameBinance, nil, time.Now(), time.Now(), bean.NewPortfolio())
+	})
+}
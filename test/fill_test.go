@@ -0,0 +1,129 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueFill(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	ob := bean.NewOrderBook([]bean.Order{{Price: 100, Amount: 5}, {Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}})
+
+	var fm exchange.FillModel = exchange.QueueFill{}
+	o := exchange.SimOrder{Price: 100, Amount: 2}
+	fm.Place(&o, ob)
+	assert.Equal(t, 5.0, o.QueueAhead)
+
+	// 4 sold at our level, not enough to get through the queue
+	txns := bean.Transactions{{Pair: pair, Price: 100, Amount: 4, TimeStamp: now.Add(time.Second), Maker: bean.Buyer}}
+	fill := fm.Fill(&o, ob, nil, txns)
+	assert.Equal(t, 0.0, fill.Amount)
+	assert.Equal(t, 1.0, o.QueueAhead)
+
+	// 2 more sold at our level, one goes to the queue ahead and one to us
+	txns = bean.Transactions{{Pair: pair, Price: 100, Amount: 2, TimeStamp: now.Add(2 * time.Second), Maker: bean.Buyer}}
+	fill = fm.Fill(&o, ob, nil, txns)
+	assert.Equal(t, 1.0, fill.Amount)
+	assert.Equal(t, 100.0, fill.Price)
+
+	// the trade-through model would have filled us on the first trade
+	o2 := exchange.SimOrder{Price: 100, Amount: 2}
+	fill = exchange.TradeThroughFill{}.Fill(&o2, ob, nil, bean.Transactions{{Pair: pair, Price: 99.5, Amount: 4, TimeStamp: now, Maker: bean.Buyer}})
+	assert.Equal(t, 2.0, fill.Amount)
+}
+
+func TestStrictFill(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	// the offer is exactly at our bid
+	ob := bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 100, Amount: 5}})
+
+	o := exchange.SimOrder{Price: 100, Amount: 2}
+	assert.Equal(t, 2.0, exchange.TradeThroughFill{}.Fill(&o, ob, nil, nil).Amount)
+	assert.Equal(t, 0.0, exchange.StrictFill{}.Fill(&o, ob, nil, nil).Amount)
+
+	// the book has to cross our price
+	ob = bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 99.5, Amount: 5}})
+	fill := exchange.StrictFill{}.Fill(&o, ob, nil, nil)
+	assert.Equal(t, 2.0, fill.Amount)
+	assert.Equal(t, 99.5, fill.Price)
+
+	// trades at our price do not fill either model, trades through it fill both
+	ob = bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}})
+	at := bean.Transactions{{Pair: pair, Price: 100, Amount: 3, TimeStamp: now, Maker: bean.Buyer}}
+	assert.Equal(t, 0.0, exchange.StrictFill{}.Fill(&o, ob, nil, at).Amount)
+	assert.Equal(t, 0.0, exchange.TradeThroughFill{}.Fill(&o, ob, nil, at).Amount)
+	through := bean.Transactions{{Pair: pair, Price: 99.5, Amount: 3, TimeStamp: now, Maker: bean.Buyer}}
+	assert.Equal(t, 2.0, exchange.StrictFill{}.Fill(&o, ob, nil, through).Amount)
+	assert.Equal(t, 2.0, exchange.TradeThroughFill{}.Fill(&o, ob, nil, through).Amount)
+}
+
+func TestProbFill(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	ob := bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}})
+	// 50 trades of 1 sold at our bid
+	var txns bean.Transactions
+	for i := 0; i < 50; i++ {
+		txns = append(txns, bean.Transaction{Pair: pair, Price: 100, Amount: 1, TimeStamp: now.Add(time.Duration(i) * time.Second), Maker: bean.Buyer})
+	}
+	fill := func(fm exchange.FillModel) float64 {
+		o := exchange.SimOrder{Price: 100, Amount: 50}
+		return fm.Fill(&o, ob, nil, txns).Amount
+	}
+
+	// the same seed gives the same fills, and reseeding replays them
+	fm := exchange.NewProbFill(0.5, 42)
+	first := fill(fm)
+	assert.True(t, first > 0 && first < 50)
+	assert.Equal(t, first, fill(exchange.NewProbFill(0.5, 42)))
+	second := fill(fm)
+	fm.Reseed()
+	assert.Equal(t, first, fill(fm))
+	assert.Equal(t, second, fill(fm))
+
+	// from pessimistic to optimistic
+	assert.Equal(t, 0.0, fill(exchange.StrictFill{}))
+	assert.Equal(t, 0.0, fill(exchange.NewProbFill(0, 42)))
+	assert.Equal(t, 50.0, fill(exchange.NewProbFill(1, 42)))
+}
+
+func TestProbFillSimulator(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fill")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	obts := bean.OrderBookTS{{Time: start, OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}})}}
+	var txns bean.Transactions
+	for i := 1; i <= 50; i++ {
+		txns = append(txns, bean.Transaction{Pair: pair, Price: 100, Amount: 0.1, TimeStamp: start.Add(time.Duration(i) * time.Second), Maker: bean.Buyer})
+	}
+	src := mds.NewFileSource(dir)
+	assert.Nil(t, src.Save(bean.NameBinance, pair, obts, txns))
+
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.USDT: 1000})
+	sim := exchange.NewSimulatorFrom(src, bean.NameBinance, []bean.Pair{pair}, start, start.Add(time.Hour), port.Clone())
+	sim.SetFillModel(exchange.NewProbFill(0.5, 7))
+	run := func(sim *exchange.Simulator) bean.Transactions {
+		sim.PlaceLimitOrder(pair, 100, 5)
+		for i := 1; i <= 6; i++ {
+			sim.SetTime(start.Add(time.Duration(i*10) * time.Second))
+		}
+		return sim.GetTrades()
+	}
+	clone := sim.Clone(start, port.Clone())
+	fills := run(&sim)
+	assert.NotEmpty(t, fills)
+	// a clone and a reset simulator replay the same fills
+	assert.Equal(t, fills, run(&clone))
+	sim.Reset(start, port.Clone())
+	assert.Equal(t, fills, run(&sim))
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFundingAccrual(t *testing.T) {
+	t0 := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	rates := bean.FundingRates{
+		{Instrument: "BTC-PERPETUAL", TimeStamp: t0.Add(16 * time.Hour), Rate: -0.0002, IndexPrice: 10000},
+		{Instrument: "BTC-PERPETUAL", TimeStamp: t0.Add(8 * time.Hour), Rate: 0.0001, IndexPrice: 8000},
+		{Instrument: "XBTUSD", TimeStamp: t0.Add(8 * time.Hour), Rate: 0.01, IndexPrice: 8000},
+	}
+	rates.Sort()
+	assert.Len(t, rates.Between(t0, t0.Add(8*time.Hour)), 2)
+	assert.Len(t, rates.Between(t0.Add(8*time.Hour), t0.Add(24*time.Hour)), 1)
+
+	perp, _ := bean.ContractFromName("BTC-PERPETUAL")
+	long := bean.NewPosition(perp, 800, 8000)
+	// longs pay 0.01% of 800 * 10 USD at 8000, then receive 0.02% at 10000
+	assert.InDelta(t, -0.0001*1+0.0002*0.8, rates.Accrued(long), 1e-12)
+	fut, _ := bean.ContractFromName("BTC-27DEC19")
+	assert.Equal(t, 0.0, rates.Accrued(bean.NewPosition(fut, 800, 8000)))
+
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1})
+	port.AddPosition(bean.NewPosition(perp, -800, 8000))
+	paid := bean.AccrueFunding(port, rates.Between(t0, t0.Add(8*time.Hour)))
+	assert.InDelta(t, 0.0001, paid[bean.BTC], 1e-12)
+	assert.InDelta(t, 1.0001, port.Balance(bean.BTC), 1e-12)
+}
+
+// fundingSource is a file source with funding rates
+type fundingSource struct {
+	mds.FileSource
+	rates bean.FundingRates
+}
+
+func (src fundingSource) GetFundingRates(exName string, instr string, start, end time.Time) (bean.FundingRates, error) {
+	var rates bean.FundingRates
+	for _, r := range src.rates {
+		if r.Instrument == instr && !r.TimeStamp.Before(start) && !r.TimeStamp.After(end) {
+			rates = append(rates, r)
+		}
+	}
+	return rates, nil
+}
+
+func TestFundingSimulatorAndRisk(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "funding")
+	defer os.RemoveAll(dir)
+	t0 := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	rates := bean.FundingRates{
+		{Instrument: "BTC-PERPETUAL", TimeStamp: t0.Add(8 * time.Hour), Rate: 0.0001, IndexPrice: 8000},
+		{Instrument: "BTC-PERPETUAL", TimeStamp: t0.Add(48 * time.Hour), Rate: 0.0001, IndexPrice: 8000},
+	}
+	perp, _ := bean.ContractFromName("BTC-PERPETUAL")
+	short := bean.NewPosition(perp, -800, 8000)
+
+	// the simulator accrues the funding rates of its source
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1})
+	port.AddPosition(short)
+	src := fundingSource{mds.NewFileSource(dir), rates}
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USD}
+	sim := exchange.NewSimulatorFrom(src, bean.NameDeribit, []bean.Pair{pair}, t0, t0.Add(24*time.Hour), port)
+	sim.SetTime(t0.Add(9 * time.Hour))
+	assert.InDelta(t, 1.0001, port.Balance(bean.BTC), 1e-12)
+
+	// funding up to the next timestamp adds to the PV of the risk report, in RHS coin
+	rr, err := bean.PositionsRisk([]bean.Position{short}, t0, 8000, flatSurface{8000, 0.5}, nil)
+	assert.Nil(t, err)
+	pv := rr.PV
+	assert.Nil(t, rr.AddFunding([]bean.Position{short}, rates.Between(t0, t0.Add(8*time.Hour)), nil))
+	assert.InDelta(t, 0.0001*8000, rr.Funding, 1e-9)
+	assert.InDelta(t, pv+0.0001*8000, rr.PV, 1e-9)
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+// flatSurface is a vol surface with one forward and one vol
+type flatSurface struct {
+	fwd, vol float64
+}
+
+func (s flatSurface) Forward(expiry time.Time) float64             { return s.fwd }
+func (s flatSurface) Vol(expiry time.Time, strike float64) float64 { return s.vol }
+
+func TestGreeks(t *testing.T) {
+	asof := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	expiry := asof.AddDate(0, 2, 0)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USD}
+	spot, fwd, vol := 8000.0, 8100.0, 0.8
+	// coin price, as on Deribit
+	price := func(c *bean.Contract, asof time.Time, fwd, vol float64) float64 {
+		return c.OptPrice(asof, spot, fwd, vol) / spot
+	}
+	for _, cp := range []bean.CallOrPut{bean.Call, bean.Put} {
+		c := bean.OptContract(pair, expiry, 9000, cp)
+		g := c.Greeks(asof, spot, fwd, vol)
+		h := 1e-3
+		// premium adjusted delta is the change in coin price for a relative move of the forward
+		delta := fwd * (price(c, asof, fwd+h, vol) - price(c, asof, fwd-h, vol)) / (2 * h)
+		assert.InDelta(t, delta, g.Delta, 1e-6)
+		vega := (price(c, asof, fwd, vol+h) - price(c, asof, fwd, vol-h)) / (2 * h) / 100
+		assert.InDelta(t, vega, g.Vega, 1e-6)
+		theta := price(c, asof.Add(24*time.Hour), fwd, vol) - price(c, asof, fwd, vol)
+		assert.InDelta(t, theta, g.Theta, 1e-5)
+		gAbove := c.Greeks(asof, spot, fwd+h, vol)
+		assert.InDelta(t, (gAbove.Delta+price(c, asof, fwd+h, vol)-g.Delta-price(c, asof, fwd, vol))/h, g.Gamma, 1e-7)
+		gVol := c.Greeks(asof, spot, fwd, vol+h)
+		assert.InDelta(t, (gVol.Vega-g.Vega)/h/100, g.Volga, 1e-5)
+		// vanna is the change of BS delta per vol point
+		gVolDown := c.Greeks(asof, spot, fwd, vol-h)
+		bsDelta := func(g bean.Greeks, vol float64) float64 { return g.Delta + price(c, asof, fwd, vol) }
+		assert.InDelta(t, (bsDelta(gVol, vol+h)-bsDelta(gVolDown, vol-h))/(2*h)/100, g.Vanna, 1e-7)
+	}
+
+	// a straddle is about delta neutral, risk is bucketed by expiry and strike
+	call := bean.NewPosition(bean.OptContract(pair, expiry, 8100, bean.Call), 1, 0.1)
+	put := bean.NewPosition(bean.OptContract(pair, expiry, 8100, bean.Put), 1, 0.1)
+	fut := bean.NewPosition(bean.FutContract(pair, expiry), -100, 8000)
+	rr, err := bean.PositionsRisk([]bean.Position{call, put, fut}, asof, spot, flatSurface{fwd, vol}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rr.ByBucket))
+	assert.Equal(t, 1, len(rr.ByExpiry))
+	straddle := rr.ByBucket[bean.RiskBucket{Expiry: expiry, Strike: 8100}]
+	assert.InDelta(t, 2*call.Greeks(asof, spot, fwd, vol).Vega, straddle.Vega, 1e-12)
+	assert.InDelta(t, straddle.Delta-100*10/fwd, rr.Total.Delta, 1e-12)
+}
+
+func TestQuantoRisk(t *testing.T) {
+	asof := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	c, _ := bean.ContractFromName("ETHUSD")
+	pos := bean.NewPosition(c, 1000, 180)
+	surf := flatSurface{200, 0.8}
+
+	// quanto positions need the price of their settlement coin
+	_, err := bean.PositionsRisk([]bean.Position{pos}, asof, 200, surf, nil)
+	assert.NotNil(t, err)
+
+	// XBT at 9000 USD, the delta is in ETH like the others
+	rr, err := bean.PositionsRisk([]bean.Position{pos}, asof, 200, surf, map[bean.Coin]float64{bean.XBT: 9000})
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.02*9000, rr.PV, 1e-9)
+	assert.InDelta(t, c.Multiplier()*9000*1000, rr.Total.Delta, 1e-12)
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyDist(t *testing.T) {
+	samples := func(l exchange.LatencyDist, n int) []time.Duration {
+		s := make([]time.Duration, n)
+		for i := range s {
+			s[i] = l.Sample()
+		}
+		return s
+	}
+
+	assert.Equal(t, 5*time.Millisecond, exchange.FixedLatency(5*time.Millisecond).Sample())
+
+	uni := exchange.NewUniformLatency(10*time.Millisecond, 20*time.Millisecond, 7)
+	first := samples(uni, 100)
+	for _, d := range first {
+		assert.True(t, d >= 10*time.Millisecond && d < 20*time.Millisecond)
+	}
+	assert.NotEqual(t, first, samples(uni, 100))
+	uni.Reseed()
+	assert.Equal(t, first, samples(uni, 100))
+	assert.Equal(t, time.Millisecond, exchange.NewUniformLatency(time.Millisecond, time.Millisecond, 7).Sample())
+
+	// normal latencies are never negative
+	norm := exchange.NewNormalLatency(time.Millisecond, 10*time.Millisecond, 7)
+	first = samples(norm, 100)
+	zeros := 0
+	for _, d := range first {
+		assert.True(t, d >= 0)
+		if d == 0 {
+			zeros++
+		}
+	}
+	assert.True(t, zeros > 0)
+	norm.Reseed()
+	assert.Equal(t, first, samples(norm, 100))
+}
+
+func TestSimulatorResetLatency(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "latency")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	obts := bean.OrderBookTS{
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}}), Time: start},
+	}
+	src := mds.NewFileSource(dir)
+	assert.Nil(t, src.Save(bean.NameBinance, pair, obts, nil))
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1, bean.USDT: 10000})
+	sim := exchange.NewSimulatorFrom(src, bean.NameBinance, []bean.Pair{pair}, start, start.Add(time.Hour), port.Clone())
+	sim.SetLatency(exchange.Latency{Entry: exchange.NewUniformLatency(0, time.Second, 7)})
+
+	// the times the orders of a run take to show
+	run := func() []time.Duration {
+		var delays []time.Duration
+		for i := 0; i < 5; i++ {
+			placed := sim.Now()
+			_, err := sim.PlaceLimitOrder(pair, 90, 0.1)
+			assert.Nil(t, err)
+			for len(sim.GetMyOrders(pair)) == i {
+				sim.SetTime(sim.Now().Add(time.Millisecond))
+			}
+			delays = append(delays, sim.Now().Sub(placed))
+		}
+		return delays
+	}
+	first := run()
+	sim.Reset(start, port.Clone())
+	assert.Equal(t, first, run())
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPositionSettlement(t *testing.T) {
+	asof := time.Date(2019, 11, 1, 8, 0, 0, 0, time.UTC)
+
+	// Deribit BTC, inverse 10 USD contracts
+	c, _ := bean.ContractFromName("BTC-PERPETUAL")
+	p := bean.NewPosition(c, 100, 8000)
+	assert.InDelta(t, (1/8000.0-1/9000.0)*9000*100*10, p.PV(asof, 9000, 9000, 0), 1e-9)
+	assert.InDelta(t, 100*10/8000.0*0.01, p.InitialMargin(asof, 8000, 8000, 0), 1e-12)
+	liq := p.LiquidationPrice(0.05)
+	assert.InDelta(t, p.MaintenanceMargin(asof, liq, liq, 0), 0.05+p.SettlePnL(liq), 1e-12)
+	assert.True(t, liq < 8000)
+	// a fully collateralised short cannot be liquidated
+	assert.True(t, math.IsInf(bean.NewPosition(c, -100, 8000).LiquidationPrice(1), 1))
+
+	// Binance, linear in USDT
+	c, _ = bean.ContractFromName("BTCUSDT")
+	p = bean.NewPosition(c, -2, 8000)
+	assert.InDelta(t, -2000.0, p.PV(asof, 9000, 9000, 0), 1e-9)
+	assert.InDelta(t, 2*9000*0.01, p.InitialMargin(asof, 9000, 9000, 0), 1e-9)
+	liq = p.LiquidationPrice(1600)
+	assert.InDelta(t, (8000+800)/1.004, liq, 1e-9)
+	assert.Equal(t, 0.0, bean.NewPosition(c, 1, 8000).LiquidationPrice(9000))
+
+	// BitMEX ETH, quanto in XBT
+	c, _ = bean.ContractFromName("ETHUSD")
+	p = bean.NewPosition(c, 1000, 180)
+	assert.InDelta(t, 0.02, p.SettlePnL(200), 1e-12)
+	assert.True(t, math.IsNaN(p.PV(asof, 200, 200, 0)))
+	assert.InDelta(t, 0.02*9000, p.PVSettle(asof, 200, 200, 0, 9000), 1e-9)
+
+	// short options follow Deribit margins
+	c, _ = bean.ContractFromName("BTC-27DEC19-10000-C")
+	p = bean.NewPosition(c, -1, 0.01)
+	mark := c.OptPrice(asof, 8000, 8000, 0.6) / 8000
+	assert.InDelta(t, math.Max(0.15-2000/8000.0, 0.1)+mark, p.InitialMargin(asof, 8000, 8000, 0.6), 1e-12)
+	assert.InDelta(t, 0.075+mark, p.MaintenanceMargin(asof, 8000, 8000, 0.6), 1e-12)
+	assert.Equal(t, 0.0, bean.NewPosition(c, 1, 0.01).InitialMargin(asof, 8000, 8000, 0.6))
+}
+
+func TestOptionMarkValue(t *testing.T) {
+	asof := time.Date(2019, 11, 1, 8, 0, 0, 0, time.UTC)
+	c, _ := bean.ContractFromName("BTC-27DEC19-10000-C")
+	price := c.OptPrice(asof, 8000, 8000, 0.6)
+	for _, qty := range []float64{2, -2} {
+		// bought or sold at 0.01 BTC, PV is net of the premium and the mark value excludes it
+		p := bean.NewPosition(c, qty, 0.01)
+		assert.InDelta(t, price*qty-0.01*8000*qty, p.PV(asof, 8000, 8000, 0.6), 1e-9)
+		assert.InDelta(t, price*qty, p.MarkValue(asof, 8000, 8000, 0.6), 1e-9)
+		assert.InDelta(t, 0.01*8000*qty, p.MarkValue(asof, 8000, 8000, 0.6)-p.PV(asof, 8000, 8000, 0.6), 1e-9)
+	}
+	// futures are worth the same either way
+	c, _ = bean.ContractFromName("BTC-PERPETUAL")
+	p := bean.NewPosition(c, 100, 8000)
+	assert.Equal(t, p.PV(asof, 9000, 9000, 0), p.MarkValue(asof, 9000, 9000, 0))
+}
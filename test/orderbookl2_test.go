@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestL2OrderBook(t *testing.T) {
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	snapshot := bean.OrderBookT{
+		OrderBook: bean.NewOrderBook([]bean.Order{{Price: 100, Amount: 1}, {Price: 99, Amount: 2}}, []bean.Order{{Price: 101, Amount: 3}}),
+		Time:      now,
+		ChangeId:  10,
+	}
+	l2 := bean.NewL2OrderBook(snapshot)
+
+	// stale diffs are ignored
+	assert.Nil(t, l2.Apply(bean.DepthDiff{FirstSeq: 9, Seq: 10, Updates: []bean.DepthUpdate{{Side: bean.BUY, Price: 100, Amount: 5}}}))
+	assert.Equal(t, 1.0, l2.BestBid().Amount)
+
+	diff := bean.DepthDiff{Time: now.Add(time.Second), FirstSeq: 11, Seq: 12, Updates: []bean.DepthUpdate{
+		{Side: bean.BUY, Price: 100, Amount: 0},
+		{Side: bean.BUY, Price: 99, Amount: 4},
+		{Side: bean.SELL, Price: 100.5, Amount: 1},
+	}}
+	assert.Nil(t, l2.Apply(diff))
+	assert.Equal(t, bean.Order{Price: 99, Amount: 4}, l2.BestBid())
+	assert.Equal(t, bean.Order{Price: 100.5, Amount: 1}, l2.BestAsk())
+	assert.Equal(t, int64(12), l2.ChangeId)
+	// the snapshot is untouched
+	assert.Equal(t, bean.Order{Price: 100, Amount: 1}, snapshot.BestBid())
+
+	// a gap needs a resync
+	assert.Equal(t, bean.ErrResyncNeeded, l2.Apply(bean.DepthDiff{FirstSeq: 14, Seq: 14}))
+	assert.False(t, l2.Synced())
+	assert.Equal(t, bean.ErrResyncNeeded, l2.Apply(bean.DepthDiff{FirstSeq: 13, Seq: 13}))
+	l2.Resync(snapshot)
+	assert.True(t, l2.Synced())
+
+	// diffs between snapshots replay to the same snapshots
+	obts := bean.OrderBookTS{snapshot, {OrderBook: l2.Clone(), Time: now.Add(time.Second)}}
+	obts[1].Update(diff.Updates)
+	first, diffs := obts.Diffs()
+	replayed, err := bean.ReplayDiffs(first, diffs)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(replayed))
+	assert.Equal(t, obts[1].Bids(), replayed[1].Bids())
+	assert.Equal(t, obts[1].Asks(), replayed[1].Asks())
+	assert.Equal(t, 0, len(replayed[1].Diff(obts[1].OrderBook)))
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"math/rand"
+	"testing"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderBookTree(t *testing.T) {
+	ob1 := bean.EmptyOrderBook()
+	ob2 := bean.EmptyOrderBookTree()
+	rng := rand.New(rand.NewSource(1))
+	var snap bean.OrderBook
+	var snapBids []bean.Order
+	for i := 0; i < 2000; i++ {
+		// random level updates, applied the same way to both books
+		side := bean.BUY
+		price := float64(900 + rng.Intn(100))
+		if rng.Intn(2) == 0 {
+			side = bean.SELL
+			price += 101
+		}
+		amount := float64(rng.Intn(5))
+		u := []bean.DepthUpdate{{Side: side, Price: price, Amount: amount}}
+		ob1.Update(u)
+		ob2.Update(u)
+		if i == 1000 {
+			snap = ob2.OrderBookCore.(*bean.OrderBookTree).Snapshot()
+			snapBids = ob1.Clone().Bids()
+		}
+	}
+	assert.Equal(t, ob1.Bids(), ob2.Bids())
+	assert.Equal(t, ob1.Asks(), ob2.Asks())
+	assert.Equal(t, ob1.BestBid(), ob2.BestBid())
+	assert.Equal(t, ob1.BestAsk(), ob2.BestAsk())
+	// the snapshot is not changed by later updates
+	assert.Equal(t, snapBids, snap.Bids())
+}
+
+func benchmarkUpdates(b *testing.B, ob bean.OrderBook) {
+	rng := rand.New(rand.NewSource(1))
+	updates := make([]bean.DepthUpdate, 10000)
+	for i := range updates {
+		updates[i] = bean.DepthUpdate{Side: bean.BUY, Price: float64(rng.Intn(1000)), Amount: float64(rng.Intn(5))}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob.Update(updates[i%len(updates) : i%len(updates)+1])
+		ob.BestBid()
+	}
+}
+
+func BenchmarkOrderBook1Update(b *testing.B) {
+	benchmarkUpdates(b, bean.EmptyOrderBook())
+}
+
+func BenchmarkOrderBookTreeUpdate(b *testing.B) {
+	benchmarkUpdates(b, bean.EmptyOrderBookTree())
+}
+
+func benchmarkInsertCancel(b *testing.B, ob bean.OrderBook) {
+	for i := 0; i < 1000; i++ {
+		ob.InsertBid(bean.Order{Price: float64(i), Amount: 1})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o := bean.Order{Price: float64(i%1000) + 0.5, Amount: 1}
+		ob.InsertBid(o)
+		ob.CancelBid(o)
+	}
+}
+
+func BenchmarkOrderBook1InsertCancel(b *testing.B) {
+	benchmarkInsertCancel(b, bean.EmptyOrderBook())
+}
+
+func BenchmarkOrderBookTreeInsertCancel(b *testing.B) {
+	benchmarkInsertCancel(b, bean.EmptyOrderBookTree())
+}
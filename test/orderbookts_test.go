@@ -0,0 +1,28 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderBookTSGetOrderBook(t *testing.T) {
+	t0 := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	obts := bean.OrderBookTS{
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 1}}, nil), Time: t0},
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 98, Amount: 1}}, nil), Time: t0.Add(time.Minute)},
+	}
+	bid := func(t time.Time) float64 { return obts.GetOrderBook(t).BestBid().Price }
+	assert.Equal(t, 99.0, bid(t0.Add(-time.Second)))
+	assert.Equal(t, 99.0, bid(t0))
+	assert.Equal(t, 99.0, bid(t0.Add(time.Minute-time.Nanosecond)))
+	// a snapshot is in effect from its own time on
+	assert.Equal(t, 98.0, bid(t0.Add(time.Minute)))
+	assert.Equal(t, 98.0, bid(t0.Add(time.Hour)))
+
+	assert.Len(t, obts.Between(t0, t0.Add(time.Minute)), 1)
+	assert.Len(t, obts.Between(t0.Add(-time.Second), t0.Add(time.Minute)), 2)
+	assert.Empty(t, obts.Between(t0.Add(time.Minute), t0.Add(time.Hour)))
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+// statusEx reports whatever status is set for an order, and refuses to place any
+type statusEx struct {
+	bean.Exchange
+	status map[string]bean.OrderStatus
+}
+
+func (ex *statusEx) Name() string { return bean.NameBinance }
+func (ex *statusEx) GetOrderStatus(oid string, pair bean.Pair) (bean.OrderStatus, error) {
+	st, ok := ex.status[oid]
+	if !ok {
+		return st, errors.New("unknown order " + oid)
+	}
+	return st, nil
+}
+func (ex *statusEx) PlaceLimitOrder(pair bean.Pair, price, amount float64) (string, error) {
+	return "", errors.New("insufficient balance")
+}
+
+func TestOrderManagerFills(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	ex := &statusEx{status: make(map[string]bean.OrderStatus)}
+	om := bean.NewOrderManager(ex)
+	om.Track(pair, "1", 100, -2)
+
+	ex.status["1"] = bean.OrderStatus{OrderID: "1", State: bean.ALIVE, LeftAmount: 2, Price: 100}
+	ev := om.Update()
+	assert.Len(t, ev, 1)
+	assert.Equal(t, bean.NEW, ev[0].From)
+	assert.Equal(t, bean.ALIVE, ev[0].To)
+	assert.False(t, ev[0].IsFill())
+	assert.Empty(t, om.Update())
+
+	ex.status["1"] = bean.OrderStatus{OrderID: "1", State: bean.ALIVE, FilledAmount: 0.5, LeftAmount: 1.5, Price: 100}
+	ev = om.Update()
+	assert.Len(t, ev, 1)
+	assert.Equal(t, bean.PARTIAL, ev[0].To)
+	assert.Equal(t, bean.SELL, ev[0].Side)
+	assert.InDelta(t, 0.5, ev[0].Filled, 1e-9)
+
+	// a stale status does not move the order back nor fill it twice
+	ex.status["1"] = bean.OrderStatus{OrderID: "1", State: bean.ALIVE, LeftAmount: 2, Price: 100}
+	assert.Empty(t, om.Update())
+
+	// the rest is filled at 103, the average being 102.25
+	ex.status["1"] = bean.OrderStatus{OrderID: "1", State: bean.FILLED, FilledAmount: 2, Price: 102.25}
+	ev = om.Update()
+	assert.Len(t, ev, 1)
+	assert.Equal(t, bean.PARTIAL, ev[0].From)
+	assert.Equal(t, bean.FILLED, ev[0].To)
+	assert.InDelta(t, 1.5, ev[0].Filled, 1e-9)
+	assert.InDelta(t, 103, ev[0].Price, 1e-9)
+
+	// terminal orders are pruned
+	_, ok := om.Get(pair, "1")
+	assert.False(t, ok)
+	assert.Empty(t, om.Update())
+}
+
+func TestOrderManagerRejectAndExpire(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	ex := &statusEx{status: make(map[string]bean.OrderStatus)}
+	om := bean.NewOrderManager(ex)
+	now := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	om.Now = func() time.Time { return now }
+
+	// a refused order is reported by the next update
+	_, err := om.Place(pair, 100, 1)
+	assert.NotNil(t, err)
+	ev := om.Update()
+	assert.Len(t, ev, 1)
+	assert.Equal(t, bean.REJECTED, ev[0].To)
+	assert.Equal(t, bean.BUY, ev[0].Side)
+	assert.Empty(t, om.Update())
+
+	// orders never seen are rejected once expired, seen ones are dropped quietly
+	t0 := now
+	om.Track(pair, "1", 100, 1)
+	now = t0.Add(time.Second)
+	om.Track(pair, "2", 101, -1)
+	ex.status["2"] = bean.OrderStatus{OrderID: "2", State: bean.ALIVE, LeftAmount: 1, Price: 101}
+	assert.Len(t, om.Update(), 1)
+	delete(ex.status, "2")
+	now = t0.Add(bean.DefaultOrderExpire - time.Second)
+	assert.Empty(t, om.Update())
+	assert.Len(t, om.Orders(pair), 2)
+	now = now.Add(time.Second)
+	ev = om.Update()
+	assert.Len(t, ev, 1)
+	assert.Equal(t, "1", ev[0].OrderID)
+	assert.Equal(t, bean.REJECTED, ev[0].To)
+	assert.Len(t, om.Orders(pair), 1)
+	now = now.Add(time.Second)
+	assert.Empty(t, om.Update())
+	assert.Empty(t, om.Orders(pair))
+}
+
+func TestOrderManagerSimulator(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "om")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	obts := bean.OrderBookTS{
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}}), Time: start},
+	}
+	txn := bean.Transactions{{Pair: pair, Price: 99.5, Amount: 0.4, TimeStamp: start.Add(90 * time.Second), Maker: bean.Buyer}}
+	src := mds.NewFileSource(dir)
+	assert.Nil(t, src.Save(bean.NameBinance, pair, obts, txn))
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1, bean.USDT: 10000})
+	sim := exchange.NewSimulatorFrom(src, bean.NameBinance, []bean.Pair{pair}, start, start.Add(time.Hour), port)
+	sim.SetLatency(exchange.Latency{Entry: exchange.FixedLatency(time.Second)})
+	om := bean.NewOrderManager(&sim)
+	om.Now = func() time.Time { return sim.Now() }
+
+	oid, err := om.Place(pair, 100, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, om.Update())
+
+	sim.SetTime(start.Add(2 * time.Second))
+	ev := om.Update()
+	assert.Len(t, ev, 1)
+	assert.Equal(t, bean.ALIVE, ev[0].To)
+
+	sim.SetTime(start.Add(2 * time.Minute))
+	ev = om.Update()
+	assert.Len(t, ev, 1)
+	assert.Equal(t, bean.PARTIAL, ev[0].To)
+	assert.True(t, ev[0].IsFill())
+	assert.Equal(t, 100.0, ev[0].Price)
+	assert.Equal(t, start.Add(2*time.Minute), ev[0].Time)
+
+	assert.Nil(t, om.Cancel(pair, oid))
+	ev = om.Update()
+	assert.Len(t, ev, 1)
+	assert.Equal(t, bean.CANCELLED, ev[0].To)
+	assert.False(t, ev[0].IsFill())
+	assert.Empty(t, om.Orders(pair))
+
+	// the fill is logged against the order
+	trades := sim.GetMyTrades(pair, start, start.Add(time.Hour))
+	assert.Len(t, trades, 1)
+	assert.Equal(t, oid, trades[0].OrderID)
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+// quoteEx is an exchange quoting a fixed ticker, with an empty orderbook, which accepts every order
+type quoteEx struct {
+	bean.Exchange
+	ticker bean.Ticker
+	port   bean.Portfolio
+	open   []bean.OrderStatus
+	placed int
+}
+
+func (ex *quoteEx) Name() string                                  { return bean.NameBinance }
+func (ex *quoteEx) GetTicker(pair bean.Pair) (bean.Ticker, error) { return ex.ticker, nil }
+func (ex *quoteEx) GetPortfolio() bean.Portfolio                  { return ex.port }
+func (ex *quoteEx) GetOrderBook(pair bean.Pair) bean.OrderBook    { return bean.EmptyOrderBook() }
+func (ex *quoteEx) GetMyOrders(pair bean.Pair) []bean.OrderStatus { return ex.open }
+func (ex *quoteEx) PlaceLimitOrder(pair bean.Pair, price, amount float64) (string, error) {
+	ex.placed++
+	return "1", nil
+}
+
+func TestRiskGate(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	ex := &quoteEx{
+		ticker: bean.Ticker{BestBid: 9990, BestAsk: 10010},
+		port:   bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1, bean.USDT: 10000}),
+	}
+	gate := exchange.NewRiskGate(ex, exchange.RiskLimits{
+		MaxNotional:     5000,
+		MaxPosition:     map[bean.Coin]float64{bean.BTC: 1.3},
+		MaxDeviation:    0.05,
+		MaxOrdersPerSec: 2,
+	})
+	rejected := func(err, want error) {
+		var re *exchange.RiskError
+		assert.True(t, errors.As(err, &re))
+		assert.True(t, errors.Is(err, want), err)
+	}
+
+	_, err := gate.PlaceLimitOrder(pair, 10000, 0.6)
+	rejected(err, exchange.ErrMaxNotional)
+	_, err = gate.PlaceLimitOrder(pair, 10000, 0.4)
+	rejected(err, exchange.ErrMaxPosition)
+	_, err = gate.PlaceLimitOrder(pair, 9000, -0.1)
+	rejected(err, exchange.ErrPriceCollar)
+	assert.Equal(t, 0, ex.placed)
+
+	_, err = gate.PlaceLimitOrder(pair, 9900, 0.1)
+	assert.Nil(t, err)
+	_, err = gate.PlaceLimitOrder(pair, 10100, -0.1)
+	assert.Nil(t, err)
+	_, err = gate.PlaceLimitOrder(pair, 10100, -0.1)
+	rejected(err, exchange.ErrRateExceeded)
+	assert.Equal(t, 2, ex.placed)
+
+	// open orders count towards the position on their side
+	ex.open = []bean.OrderStatus{{OrderID: "1", Side: bean.BUY, LeftAmount: 0.25}}
+	rejected(gate.Check(pair, 10000, 0.1), exchange.ErrMaxPosition)
+	assert.Nil(t, gate.Check(pair, 10000, -0.1))
+	ex.open = nil
+
+	gate.Kill()
+	assert.True(t, errors.Is(gate.Check(pair, 10000, 0.1), exchange.ErrKillSwitch))
+	gate.Resume()
+	exchange.KillAll()
+	assert.True(t, errors.Is(gate.Check(pair, 10000, 0.1), exchange.ErrKillSwitch))
+	exchange.ResumeAll()
+	assert.Nil(t, gate.Check(pair, 10000, 0.1))
+}
+
+func TestRiskGateSimulator(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "risk")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	obts := bean.OrderBookTS{
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}}), Time: start},
+	}
+	src := mds.NewFileSource(dir)
+	assert.Nil(t, src.Save(bean.NameBinance, pair, obts, nil))
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1, bean.USDT: 10000})
+	sim := exchange.NewSimulatorFrom(src, bean.NameBinance, []bean.Pair{pair}, start, start.Add(time.Hour), port)
+	sim.SetTime(start.Add(time.Second))
+
+	// the simulator has no ticker, the collar is around the mid of its orderbook
+	gate := exchange.NewRiskGate(&sim, exchange.RiskLimits{MaxDeviation: 0.05})
+	_, err := gate.PlaceLimitOrder(pair, 94, 0.1)
+	assert.True(t, errors.Is(err, exchange.ErrPriceCollar))
+	_, err = gate.PlaceLimitOrder(pair, 98, 0.1)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/brew"
+	"bean/db/mds"
+	"bean/exchange"
+	"bean/live"
+	"github.com/stretchr/testify/assert"
+)
+
+// quoteOnce quotes both sides on the first tick and then does nothing
+type quoteOnce struct {
+	bean.BaseStrat
+	pair   bean.Pair
+	quoted bool
+}
+
+func (s *quoteOnce) GetExchangeNames() []string { return []string{bean.NameBinance} }
+func (s *quoteOnce) GetPairs() []bean.Pair      { return []bean.Pair{s.pair} }
+
+func (s *quoteOnce) Grind(exs map[string]bean.Exchange) []bean.TradeAction {
+	if s.quoted {
+		return nil
+	}
+	s.quoted = true
+	return []bean.TradeAction{
+		bean.PlaceLimitOrderAction(bean.NameBinance, s.pair, 7900, 0.1),
+		bean.PlaceLimitOrderAction(bean.NameBinance, s.pair, 8100, -0.1),
+	}
+}
+
+func TestRunner(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "runner")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1, bean.USDT: 10000})
+	sim := exchange.NewSimulatorFrom(mds.NewFileSource(dir), bean.NameBinance, []bean.Pair{pair}, start, start.Add(time.Hour), port)
+	strat := &quoteOnce{BaseStrat: bean.BaseStrat{Tick: time.Second}, pair: pair}
+
+	r := live.NewRunnerWith(strat, map[string]bean.Exchange{bean.NameBinance: &sim}, "test")
+	var recorded []brew.ExNameWithOID
+	r.SetRecorder(func(oids []brew.ExNameWithOID, acct, dealer, param, remark string) error {
+		recorded = append(recorded, oids...)
+		return nil
+	})
+	var snapped map[string]bean.Portfolio
+	r.SetSnapshot(time.Hour, nil)
+	r.SetSnapshotter(func(ports map[string]bean.Portfolio, acct string, at time.Time, agg bool, pricer bean.IndexPricer) error {
+		snapped = ports
+		return nil
+	})
+	rec := r.Step()
+	assert.Len(t, snapped, 1)
+	assert.Equal(t, 1.0, snapped[bean.NameBinance].Balance(bean.BTC))
+	assert.Len(t, recorded, 2)
+	assert.Len(t, r.Owned(), 2)
+	assert.Empty(t, rec.Closed)
+	assert.Empty(t, rec.Unknown)
+
+	// an order placed outside the runner is reported but not owned
+	_, err := sim.PlaceLimitOrder(pair, 7800, 0.1)
+	assert.Nil(t, err)
+	rec = r.Step()
+	assert.Len(t, rec.Unknown, 1)
+
+	// an owned order cancelled outside the runner is dropped once past the grace period
+	r.Grace = 0
+	sim.CancelOrder(pair, r.Owned()[0].OrderID)
+	rec = r.Step()
+	assert.Len(t, rec.Closed, 1)
+	assert.Len(t, r.Owned(), 1)
+
+	// shutting down cancels the owned order only
+	assert.Nil(t, r.Shutdown())
+	assert.Empty(t, r.Owned())
+	assert.Len(t, sim.GetAccountOrders(pair), 1)
+}
+
+// iocThenPanic places an order good till cancelled and an IOC one on the first tick, and panics on the next
+type iocThenPanic struct {
+	bean.BaseStrat
+	pair   bean.Pair
+	ground bool
+}
+
+func (s *iocThenPanic) GetExchangeNames() []string { return []string{bean.NameBinance} }
+func (s *iocThenPanic) GetPairs() []bean.Pair      { return []bean.Pair{s.pair} }
+
+func (s *iocThenPanic) Grind(exs map[string]bean.Exchange) []bean.TradeAction {
+	if s.ground {
+		panic("grind failed")
+	}
+	s.ground = true
+	return []bean.TradeAction{
+		bean.PlaceLimitOrderAction(bean.NameBinance, s.pair, 7900, 0.1),
+		bean.LimitOrderAction(bean.NameBinance, s.pair, bean.LimitParams{Price: 7800, Amount: 0.1, Life: bean.InstantOrCancelled}),
+	}
+}
+
+// emulated hides the native order placement of the simulator, so that order lives are emulated
+type emulated struct {
+	bean.Exchange
+}
+
+func TestRunnerIOCAndPanic(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "runner")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1, bean.USDT: 10000})
+	sim := exchange.NewSimulatorFrom(mds.NewFileSource(dir), bean.NameBinance, []bean.Pair{pair}, start, start.Add(time.Hour), port)
+	strat := &iocThenPanic{BaseStrat: bean.BaseStrat{Tick: time.Millisecond}, pair: pair}
+	r := live.NewRunnerWith(strat, map[string]bean.Exchange{bean.NameBinance: emulated{&sim}}, "test")
+	r.SetRecorder(nil)
+
+	// the IOC order is placed and cancelled in the same batch, and not owned
+	r.Step()
+	assert.Len(t, r.Owned(), 1)
+	assert.Len(t, sim.GetAccountOrders(pair), 1)
+
+	// the panic stops the runner, which still cancels its orders
+	err := r.Run(make(chan struct{}))
+	assert.NotNil(t, err)
+	assert.Empty(t, r.Owned())
+	assert.Empty(t, sim.GetAccountOrders(pair))
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScenarios(t *testing.T) {
+	asof := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	expiry := asof.AddDate(0, 0, 7)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USD}
+	spot := 8000.0
+	surf := flatSurface{fwd: 8000, vol: 0.8}
+	// short straddle
+	positions := []bean.Position{
+		bean.NewPosition(bean.OptContract(pair, expiry, 8000, bean.Call), -1, 0.05),
+		bean.NewPosition(bean.OptContract(pair, expiry, 8000, bean.Put), -1, 0.05),
+	}
+	grid := bean.ScenarioGrid{SpotShocks: []float64{-0.2, 0, 0.2}, VolShocks: []float64{-0.1, 0, 0.1}}
+	res := bean.RunScenarios(positions, asof, spot, surf, grid)
+	assert.Equal(t, 3, len(res.PnL))
+	assert.InDelta(t, 0.0, res.PnL[1][1], 1e-9)
+	// short vol and gamma loses on big moves and vol up
+	assert.True(t, res.PnL[0][1] < 0 && res.PnL[2][1] < 0)
+	assert.True(t, res.PnL[1][2] < 0 && res.PnL[1][0] > 0)
+	assert.Equal(t, 0.1, res.Worst.VolShock)
+	assert.NotEqual(t, 0.0, res.Worst.SpotShock)
+	assert.Equal(t, math.Min(res.PnL[0][2], res.PnL[2][2]), res.WorstLoss)
+
+	// time decay earns the short straddle its theta
+	decay := bean.Revalue(positions, asof, spot, surf, bean.Scenario{Days: 1}) - res.BasePV
+	assert.True(t, decay > 0)
+
+	// past expiry the ATM straddle keeps its premium and the shocked one pays its intrinsic value out of it
+	pv := bean.Revalue(positions, asof, spot, surf, bean.Scenario{Days: 7})
+	assert.InDelta(t, 2*0.05*spot, pv, 1e-9)
+	pv = bean.Revalue(positions, asof, spot, surf, bean.Scenario{Days: 10, SpotShock: 0.25})
+	assert.False(t, math.IsNaN(pv))
+	assert.InDelta(t, -2000.0+2*0.05*spot*1.25, pv, 1e-9)
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettleExpired(t *testing.T) {
+	expiry := time.Date(2019, 12, 27, 8, 0, 0, 0, time.UTC)
+	index := bean.IndexPriceFunc(func(exName string, underlying bean.Pair, at time.Time) (float64, error) {
+		if !at.Equal(expiry) {
+			return 0, errors.New("no index")
+		}
+		return 8000, nil
+	})
+	names := []string{"BTC-27DEC19", "BTC-27DEC19-7000-C", "BTC-27DEC19-7000-P", "BTC-PERPETUAL", "BTC-27MAR20"}
+	posns, err := bean.PositionsFromNames(names, []float64{100, 2, -1, 10, 10}, []float64{7500, 0.1, 0.01, 7000, 7000})
+	assert.Nil(t, err)
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1})
+	port.SetPositions(posns)
+
+	settled, err := bean.SettleExpired(port, expiry.Add(-time.Minute), index)
+	assert.Nil(t, err)
+	assert.Empty(t, settled)
+
+	settled, err = bean.SettleExpired(port, expiry, index)
+	assert.Nil(t, err)
+	assert.Len(t, settled, 3)
+	fut := (1/7500.0 - 1/8000.0) * 100 * 10
+	call := 2 * 1000 / 8000.0
+	assert.InDelta(t, fut, settled[0].Amount, 1e-12)
+	assert.InDelta(t, call, settled[1].Amount, 1e-12)
+	assert.Equal(t, 0.0, settled[2].Amount)
+	assert.InDelta(t, 1+fut+call, port.Balance(bean.BTC), 1e-12)
+	assert.Len(t, port.Positions(), 2)
+	assert.True(t, port.Positions()[0].Perp())
+}
+
+func TestSettleExpiredMissingIndex(t *testing.T) {
+	expiry := time.Date(2019, 12, 27, 8, 0, 0, 0, time.UTC)
+	index := bean.IndexPriceFunc(func(exName string, underlying bean.Pair, at time.Time) (float64, error) {
+		if underlying.Coin == bean.ETH {
+			return 0, errors.New("no index")
+		}
+		return 8000, nil
+	})
+	posns, err := bean.PositionsFromNames([]string{"ETH-27DEC19", "BTC-27DEC19"}, []float64{10, 100}, []float64{130, 7500})
+	assert.Nil(t, err)
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1})
+	port.SetPositions(posns)
+
+	// the position without an index price is left, the others are still settled
+	settled, err := bean.SettleExpired(port, expiry, index)
+	assert.Len(t, settled, 1)
+	assert.Equal(t, "BTC-27DEC19", settled[0].Position.Name())
+	var errs bean.SettlementErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "ETH-27DEC19", errs[0].Position.Name())
+	assert.Len(t, port.Positions(), 1)
+}
+
+func TestSimulatorUnsettled(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "settle")
+	defer os.RemoveAll(dir)
+	expiry := time.Date(2019, 12, 27, 8, 0, 0, 0, time.UTC)
+	posns, err := bean.PositionsFromNames([]string{"BTC-27DEC19"}, []float64{100}, []float64{7500})
+	assert.Nil(t, err)
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 1})
+	port.SetPositions(posns)
+	start := expiry.Add(-time.Hour)
+	sim := exchange.NewSimulatorFrom(mds.NewFileSource(dir), bean.NameDeribit, nil, start, expiry.Add(time.Hour), port)
+
+	// a missing index price leaves the position in the portfolio rather than stopping the backtest
+	found := false
+	sim.SetIndexPricer(bean.IndexPriceFunc(func(exName string, underlying bean.Pair, at time.Time) (float64, error) {
+		if !found {
+			return 0, errors.New("no index")
+		}
+		return 8000, nil
+	}))
+	sim.SetTime(expiry.Add(time.Minute))
+	assert.Len(t, sim.Unsettled(), 1)
+	assert.Len(t, sim.GetPortfolio().Positions(), 1)
+
+	found = true
+	sim.SetTime(expiry.Add(2 * time.Minute))
+	assert.Empty(t, sim.Unsettled())
+	assert.Len(t, sim.Settlements(), 1)
+	assert.Empty(t, sim.GetPortfolio().Positions())
+}
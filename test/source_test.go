@@ -0,0 +1,145 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/db/mds"
+	"bean/exchange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bean")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	obts := bean.OrderBookTS{
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 100, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}}), Time: start},
+		{OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 100.5, Amount: 2}}), Time: start.Add(time.Minute)},
+	}
+	txn := bean.Transactions{{Pair: pair, Price: 99.5, Amount: 3, TimeStamp: start.Add(90 * time.Second), Maker: bean.Buyer}}
+	src := mds.NewFileSource(filepath.Join(dir, "data"))
+	assert.Nil(t, src.Save(bean.NameBinance, pair, obts, txn))
+
+	got, err := src.GetOrderBookTS2(bean.NameBinance, pair, start, start.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(got))
+	assert.Equal(t, 100.5, got[1].BestAsk().Price)
+	got, _ = src.GetOrderBookTS2(bean.NameBinance, pair, start.Add(time.Second), start.Add(time.Hour))
+	assert.Equal(t, 1, len(got))
+
+	// the cache serves a window it has seen without going back to the source
+	cache := mds.NewCache(filepath.Join(dir, "cache"), src)
+	gotTxn, err := cache.GetTransactions2(bean.NameBinance, pair, start, start.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, txn, gotTxn)
+	_, err = cache.GetOrderBookTS2(bean.NameBinance, pair, start, start.Add(time.Hour))
+	assert.Nil(t, err)
+	os.RemoveAll(filepath.Join(dir, "data"))
+	gotTxn, err = cache.GetTransactions2(bean.NameBinance, pair, start.Add(time.Minute), start.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, txn, gotTxn)
+
+	// the simulator runs on the cached data, our bid is traded through
+	sim := exchange.NewSimulatorFrom(cache, bean.NameBinance, []bean.Pair{pair}, start, start.Add(time.Hour), bean.NewPortfolio())
+	sim.SetTime(start)
+	_, err = sim.PlaceLimitOrder(pair, 100, 1)
+	assert.Nil(t, err)
+	sim.SetTime(start.Add(2 * time.Minute))
+	trades := sim.GetTrades()
+	assert.Equal(t, 1, len(trades))
+	assert.Equal(t, 100.0, trades[0].Price)
+}
+
+func TestCacheSettle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bean")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	now := time.Now().UTC().Truncate(time.Second)
+	src := mds.NewFileSource(filepath.Join(dir, "data"))
+	cache := mds.NewCache(filepath.Join(dir, "cache"), src)
+	cache.Settle = time.Hour
+
+	// an empty window may be a gap in the source yet to be filled, it is not cached
+	old := now.Add(-48 * time.Hour)
+	got, err := cache.GetTransactions2(bean.NameBinance, pair, old, old.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Empty(t, got)
+	txn := bean.Transactions{
+		{Pair: pair, Price: 100, Amount: 1, TimeStamp: old.Add(time.Minute), Maker: bean.Buyer},
+		{Pair: pair, Price: 101, Amount: 1, TimeStamp: now.Add(-time.Minute), Maker: bean.Buyer},
+	}
+	assert.Nil(t, src.Save(bean.NameBinance, pair, bean.OrderBookTS{}, txn))
+	got, err = cache.GetTransactions2(bean.NameBinance, pair, old, now)
+	assert.Nil(t, err)
+	assert.Equal(t, txn, got)
+
+	// recent data is served but not cached, as the source may still be filling it
+	later := bean.Transactions{txn[0], txn[1], {Pair: pair, Price: 102, Amount: 1, TimeStamp: now.Add(-30 * time.Second), Maker: bean.Seller}}
+	assert.Nil(t, src.Save(bean.NameBinance, pair, bean.OrderBookTS{}, later))
+	got, err = cache.GetTransactions2(bean.NameBinance, pair, old, now)
+	assert.Nil(t, err)
+	assert.Equal(t, later, got)
+}
+
+// countingSource records the windows of transactions fetched from a source
+type countingSource struct {
+	mds.Source
+	fetched [][2]time.Time
+}
+
+func (s *countingSource) GetTransactions2(exName string, pair bean.Pair, start, end time.Time) (bean.Transactions, error) {
+	s.fetched = append(s.fetched, [2]time.Time{start, end})
+	return s.Source.GetTransactions2(exName, pair, start, end)
+}
+
+func TestCacheGaps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bean")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	var txn bean.Transactions
+	for i := 0; i < 18; i++ {
+		txn = append(txn, bean.Transaction{Pair: pair, Price: 100 + float64(i), Amount: 1, TimeStamp: start.Add(time.Duration(i*10) * time.Minute), Maker: bean.Buyer})
+	}
+	files := mds.NewFileSource(filepath.Join(dir, "data"))
+	assert.Nil(t, files.Save(bean.NameBinance, pair, bean.OrderBookTS{}, txn))
+	src := &countingSource{Source: files}
+	cache := mds.NewCache(filepath.Join(dir, "cache"), src)
+	chunks := func() int {
+		fis, _ := ioutil.ReadDir(filepath.Join(dir, "cache", bean.NameBinance, "BTC_USDT", "transaction"))
+		return len(fis)
+	}
+
+	got, err := cache.GetTransactions2(bean.NameBinance, pair, start, start.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, txn[:7], got)
+	assert.Len(t, src.fetched, 1)
+
+	// a request overlapping the cached hour only fetches the hour after it
+	got, err = cache.GetTransactions2(bean.NameBinance, pair, start.Add(30*time.Minute), start.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, txn[3:13], got)
+	assert.Len(t, src.fetched, 2)
+	assert.True(t, src.fetched[1][0].After(start.Add(time.Hour)))
+	assert.True(t, src.fetched[1][0].Before(start.Add(time.Hour+time.Second)))
+	// and the two chunks are merged into one
+	assert.Equal(t, 1, chunks())
+
+	got, err = cache.GetTransactions2(bean.NameBinance, pair, start, start.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, txn[:13], got)
+	assert.Len(t, src.fetched, 2)
+	assert.Equal(t, 1, chunks())
+}
@@ -0,0 +1,231 @@
+package test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+// pollEx is a polling exchange whose orderbook, trades and orders are set by the test
+type pollEx struct {
+	bean.Exchange
+	mu     sync.Mutex
+	ob     bean.OrderBook
+	txns   bean.Transactions
+	status map[string]bean.OrderStatus
+}
+
+func (ex *pollEx) Name() string { return bean.NameBinance }
+
+func (ex *pollEx) GetOrderBook(pair bean.Pair) bean.OrderBook {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	return ex.ob.Clone()
+}
+
+func (ex *pollEx) GetTransactionHistory(pair bean.Pair) bean.Transactions {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	return append(bean.Transactions{}, ex.txns...)
+}
+
+func (ex *pollEx) GetAccountOrders(pair bean.Pair) []bean.OrderStatus { return nil }
+
+func (ex *pollEx) GetOrderStatus(oid string, pair bean.Pair) (bean.OrderStatus, error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	return ex.status[oid], nil
+}
+
+func (ex *pollEx) PlaceLimitOrder(pair bean.Pair, price, amount float64) (string, error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	ex.status["1"] = bean.OrderStatus{OrderID: "1", State: bean.ALIVE, LeftAmount: amount, Price: price}
+	return "1", nil
+}
+
+func (ex *pollEx) set(f func()) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	f()
+}
+
+func TestPollingExchange(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	ex := &pollEx{
+		ob:     bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 1}}, []bean.Order{{Price: 101, Amount: 1}}),
+		status: make(map[string]bean.OrderStatus),
+	}
+	pex := bean.NewPollingExchange(ex, 5*time.Millisecond)
+	var sex bean.StreamingExchange = pex
+	s, err := sex.Subscribe([]bean.Pair{pair})
+	assert.Nil(t, err)
+	_, err = sex.Subscribe([]bean.Pair{pair})
+	assert.Equal(t, bean.ErrSubscribed, err)
+
+	assert.True(t, (<-s.Status).Connected)
+	snap := <-s.Books
+	assert.True(t, snap.Snapshot)
+	l2 := bean.NewL2OrderBook(snap.Book)
+
+	// changes come as diffs on top of the snapshot
+	ex.set(func() {
+		ex.ob = bean.NewOrderBook([]bean.Order{{Price: 100, Amount: 2}}, []bean.Order{{Price: 101, Amount: 1}})
+	})
+	diff := <-s.Books
+	assert.False(t, diff.Snapshot)
+	assert.Nil(t, l2.Apply(diff.Diff))
+	assert.Equal(t, 100.0, l2.BestBid().Price)
+
+	// new trades are streamed once
+	ex.set(func() {
+		ex.txns = bean.Transactions{{Pair: pair, Price: 100, Amount: 0.5, TimeStamp: time.Now().Add(time.Second), TxnID: "7"}}
+	})
+	txn := <-s.Trades
+	assert.Equal(t, "7", txn.TxnID)
+
+	// own orders are tracked from placement
+	_, err = pex.PlaceLimitOrder(pair, 99.5, 0.1)
+	assert.Nil(t, err)
+	ev := <-s.Orders
+	assert.Equal(t, bean.NEW, ev.From)
+	assert.Equal(t, bean.ALIVE, ev.To)
+
+	// an empty orderbook is a lost connection, after which the pair is resubscribed from a snapshot
+	ex.set(func() { ex.ob = bean.EmptyOrderBook() })
+	assert.False(t, (<-s.Status).Connected)
+	ex.set(func() {
+		ex.ob = bean.NewOrderBook([]bean.Order{{Price: 98, Amount: 1}}, []bean.Order{{Price: 102, Amount: 1}})
+	})
+	assert.True(t, (<-s.Status).Connected)
+	snap = <-s.Books
+	assert.True(t, snap.Snapshot)
+	l2.Resync(snap.Book)
+	assert.Equal(t, 98.0, l2.BestBid().Price)
+
+	s.Close()
+	for range s.Books {
+	}
+	s, err = sex.Subscribe([]bean.Pair{pair})
+	assert.Nil(t, err)
+	s.Close()
+}
+
+func TestPollingExchangeNewestFirst(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	ex := &pollEx{
+		ob:     bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 1}}, []bean.Order{{Price: 101, Amount: 1}}),
+		status: make(map[string]bean.OrderStatus),
+	}
+	now := time.Now()
+	// the exchange lists its trades newest first
+	ex.txns = bean.Transactions{
+		{Pair: pair, Price: 100, Amount: 0.3, TimeStamp: now.Add(3 * time.Second), TxnID: "3"},
+		{Pair: pair, Price: 100, Amount: 0.2, TimeStamp: now.Add(2 * time.Second), TxnID: "2"},
+		{Pair: pair, Price: 100, Amount: 0.1, TimeStamp: now.Add(time.Second), TxnID: "1"},
+	}
+	s, err := bean.NewPollingExchange(ex, 5*time.Millisecond).Subscribe([]bean.Pair{pair})
+	assert.Nil(t, err)
+	defer s.Close()
+
+	// all of them are streamed, oldest first, and only once
+	for _, id := range []string{"1", "2", "3"} {
+		assert.Equal(t, id, (<-s.Trades).TxnID)
+	}
+	ex.set(func() {
+		ex.txns = append(bean.Transactions{{Pair: pair, Price: 100, Amount: 0.4, TimeStamp: now.Add(4 * time.Second), TxnID: "4"}}, ex.txns...)
+	})
+	assert.Equal(t, "4", (<-s.Trades).TxnID)
+}
+
+// slowEx blocks querying order statuses until released
+type slowEx struct {
+	*pollEx
+	querying chan struct{}
+	release  chan struct{}
+}
+
+func (ex *slowEx) GetOrderStatus(oid string, pair bean.Pair) (bean.OrderStatus, error) {
+	select {
+	case ex.querying <- struct{}{}:
+	default:
+	}
+	<-ex.release
+	return ex.pollEx.GetOrderStatus(oid, pair)
+}
+
+func TestPollingExchangeNoStall(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	ex := &slowEx{
+		pollEx: &pollEx{
+			ob:     bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 1}}, []bean.Order{{Price: 101, Amount: 1}}),
+			status: make(map[string]bean.OrderStatus),
+		},
+		querying: make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+	close(ex.release)
+	pex := bean.NewPollingExchange(ex, 5*time.Millisecond)
+	pex.Buffer = 1
+	s, err := pex.Subscribe([]bean.Pair{pair})
+	assert.Nil(t, err)
+	defer s.Close()
+	assert.True(t, (<-s.Books).Snapshot)
+
+	// trades and statuses nobody reads do not stall the orderbooks
+	ex.set(func() {
+		now := time.Now().Add(time.Second)
+		for i := 0; i < 5; i++ {
+			ex.txns = append(ex.txns, bean.Transaction{Pair: pair, Price: 100, Amount: 1, TimeStamp: now, TxnID: string(rune('a' + i))})
+		}
+	})
+	time.Sleep(20 * time.Millisecond)
+	ex.set(func() {
+		ex.ob = bean.NewOrderBook([]bean.Order{{Price: 100, Amount: 2}}, []bean.Order{{Price: 101, Amount: 1}})
+	})
+	select {
+	case u := <-s.Books:
+		assert.False(t, u.Snapshot)
+	case <-time.After(time.Second):
+		t.Fatal("orderbook stalled by unread trades")
+	}
+	assert.Equal(t, "e", (<-s.Trades).TxnID)
+}
+
+func TestPollingExchangePlaceWhilePolling(t *testing.T) {
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	ex := &slowEx{
+		pollEx: &pollEx{
+			ob:     bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 1}}, []bean.Order{{Price: 101, Amount: 1}}),
+			status: make(map[string]bean.OrderStatus),
+		},
+		querying: make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+	pex := bean.NewPollingExchange(ex, 5*time.Millisecond)
+	_, err := pex.PlaceLimitOrder(pair, 99.5, 0.1)
+	assert.Nil(t, err)
+	s, err := pex.Subscribe([]bean.Pair{pair})
+	assert.Nil(t, err)
+
+	// the poll waits on the order status, placing does not wait on the poll
+	<-ex.querying
+	placed := make(chan error)
+	go func() {
+		_, err := pex.PlaceLimitOrder(pair, 99, 0.1)
+		placed <- err
+	}()
+	select {
+	case err := <-placed:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("placing blocked by the order poll")
+	}
+	close(ex.release)
+	s.Close()
+	for range s.Books {
+	}
+}
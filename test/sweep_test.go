@@ -0,0 +1,121 @@
+package test
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/brew"
+	"bean/db/mds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamSweep(t *testing.T) {
+	grid := brew.ParamGrid{"spread": {0.001, 0.002}, "size": {1, 2, 3}}
+	params := grid.Params()
+	assert.Equal(t, 6, len(params))
+	assert.Equal(t, brew.Params{"size": 1, "spread": 0.001}, params[0])
+	assert.Equal(t, "size=3 spread=0.002", params[5].String())
+
+	space := brew.ParamSpace{"spread": {Min: 0.001, Max: 0.002}}
+	sample := space.Sample(10, 42)
+	assert.Equal(t, sample, space.Sample(10, 42))
+	for _, p := range sample {
+		assert.True(t, p["spread"] >= 0.001 && p["spread"] <= 0.002)
+	}
+
+	results := []brew.SweepResult{
+		{Params: params[0], Stat: bean.PortPerformanceStat{Sharpe: math.NaN(), MaxDrawdown: 5, NetPnL: 1}},
+		{Params: params[1], Stat: bean.PortPerformanceStat{Sharpe: 1.5, MaxDrawdown: 2, NetPnL: 3}},
+		{Params: params[2], Stat: bean.PortPerformanceStat{Sharpe: 0.5, MaxDrawdown: 1, NetPnL: 2}},
+	}
+	assert.Equal(t, params[1], brew.RankResults(results, brew.BySharpe)[0].Params)
+	assert.Equal(t, params[0], results[2].Params)
+	assert.Equal(t, params[2], brew.RankResults(results, brew.ByMaxDrawdown)[0].Params)
+	assert.Equal(t, params[1], brew.RankResults(results, brew.ByNetPnL)[0].Params)
+}
+
+// quoteParams bids and offers once around the book, at levels given by its params
+type quoteParams struct {
+	bean.BaseStrat
+	bid, ask float64
+	quoted   bool
+}
+
+func (s *quoteParams) GetExchangeNames() []string { return []string{bean.NameBinance} }
+func (s *quoteParams) GetPairs() []bean.Pair {
+	return []bean.Pair{{Coin: bean.BTC, Base: bean.USDT}}
+}
+
+func (s *quoteParams) Grind(exs map[string]bean.Exchange) []bean.TradeAction {
+	if s.quoted {
+		return nil
+	}
+	s.quoted = true
+	pair := s.GetPairs()[0]
+	return []bean.TradeAction{
+		bean.PlaceLimitOrderAction(bean.NameBinance, pair, s.bid, 1),
+		bean.PlaceLimitOrderAction(bean.NameBinance, pair, s.ask, -1),
+	}
+}
+
+func TestSweepSimulations(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sweep")
+	defer os.RemoveAll(dir)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USDT}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	obts := bean.OrderBookTS{{Time: start, OrderBook: bean.NewOrderBook([]bean.Order{{Price: 99, Amount: 5}}, []bean.Order{{Price: 101, Amount: 5}})}}
+	// the price swings between 98 and 102 every 10 minutes
+	var txns bean.Transactions
+	for i := 0; i < 24; i++ {
+		price, maker := 98.0, bean.Buyer
+		if i%2 == 1 {
+			price, maker = 102.0, bean.Seller
+		}
+		txns = append(txns, bean.Transaction{Pair: pair, Price: price, Amount: 1, TimeStamp: start.Add(time.Duration(i*10+5) * time.Minute), Maker: maker})
+	}
+	src := mds.NewFileSource(dir)
+	assert.Nil(t, src.Save(bean.NameBinance, pair, obts, txns))
+
+	factory := func(p brew.Params) bean.Strat {
+		return &quoteParams{BaseStrat: bean.BaseStrat{Tick: 10 * time.Minute}, bid: p["bid"], ask: p["ask"]}
+	}
+	params := brew.ParamGrid{"bid": {98.5, 99.5}, "ask": {100.5, 101.5}}.Params()
+	port := bean.NewPortfolio(map[bean.Coin]float64{bean.BTC: 10, bean.USDT: 1000})
+	bt := brew.NewBackTestFrom(src)
+	end := start.Add(4 * time.Hour)
+
+	// concurrent runs give the same results as a single worker
+	results := bt.Sweep(factory, params, start, end, port, 4, brew.ByNetPnL)
+	assert.Len(t, results, 4)
+	serial := bt.Sweep(factory, params, start, end, port, 1, brew.ByNetPnL)
+	for i := range results {
+		assert.Equal(t, serial[i].Params, results[i].Params)
+		assert.Equal(t, serial[i].Stat.NetPnL, results[i].Stat.NetPnL)
+		assert.Len(t, results[i].Result.Txn, 2)
+	}
+	// the widest quotes earn the most
+	assert.Equal(t, brew.Params{"bid": 98.5, "ask": 101.5}, results[0].Params)
+	assert.True(t, results[0].Stat.NetPnL > results[3].Stat.NetPnL)
+
+	// 2 hours in sample and 1 hour out of sample, stepping by 1 hour
+	windows := bt.WalkForward(factory, params, start, end, 2*time.Hour, time.Hour, port, 4, brew.ByNetPnL)
+	assert.Len(t, windows, 2)
+	for i, w := range windows {
+		assert.Equal(t, start.Add(time.Duration(i)*time.Hour), w.InStart)
+		assert.Equal(t, w.InStart.Add(2*time.Hour), w.InEnd)
+		assert.Equal(t, w.InEnd.Add(time.Hour), w.OutEnd)
+		assert.Len(t, w.InSample, 4)
+		assert.Equal(t, w.Best(), w.OutSample.Params)
+		// the out of sample run only trades after the in sample window
+		for _, txn := range w.OutSample.Result.Txn {
+			assert.False(t, txn.TimeStamp.Before(w.InEnd))
+		}
+		for _, txn := range w.InSample[0].Result.Txn {
+			assert.True(t, txn.TimeStamp.Before(w.InEnd))
+		}
+	}
+}
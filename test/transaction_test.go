@@ -0,0 +1,39 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"bean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionsBetween(t *testing.T) {
+	t0 := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	txn := bean.Transactions{
+		{Price: 100, Amount: 1, TimeStamp: t0, TxnID: "1"},
+		{Price: 101, Amount: 1, TimeStamp: t0.Add(time.Minute), TxnID: "2"},
+		{Price: 102, Amount: 1, TimeStamp: t0.Add(time.Minute), TxnID: "3"},
+		{Price: 103, Amount: 1, TimeStamp: t0.Add(time.Hour), TxnID: "4"},
+	}
+	ids := func(txn bean.Transactions) []string {
+		var ids []string
+		for _, t := range txn {
+			ids = append(ids, t.TxnID)
+		}
+		return ids
+	}
+	// trades are taken after from and up to to
+	assert.Equal(t, []string{"2", "3"}, ids(txn.Between(t0, t0.Add(time.Minute))))
+	assert.Equal(t, []string{"1", "2", "3"}, ids(txn.Between(t0.Add(-time.Second), t0.Add(time.Minute))))
+	assert.Equal(t, []string{"4"}, ids(txn.Between(t0.Add(time.Minute), t0.Add(time.Hour))))
+	// a window between two trades has none, not the next one
+	assert.Empty(t, txn.Between(t0.Add(2*time.Minute), t0.Add(3*time.Minute)))
+	assert.Empty(t, txn.Between(t0.Add(time.Hour), t0.Add(2*time.Hour)))
+	assert.Empty(t, bean.Transactions{}.Between(t0, t0.Add(time.Hour)))
+
+	// appending to a window does not overwrite the trades after it
+	w := txn.Between(t0, t0.Add(time.Minute))
+	_ = append(w, bean.Transaction{TxnID: "5"})
+	assert.Equal(t, "4", txn[3].TxnID)
+}
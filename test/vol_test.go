@@ -0,0 +1,56 @@
+package test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"bean"
+	"bean/vol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolSurface(t *testing.T) {
+	asof := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	spot := 8000.0
+	truth := vol.SVI{A: 0.02, B: 0.1, Rho: -0.3, M: 0.05, Sigma: 0.2}
+	mkt := make(map[string]bean.OrderBookT)
+	pair := bean.Pair{Coin: bean.BTC, Base: bean.USD}
+	for _, expiry := range []time.Time{asof.AddDate(0, 1, 0), asof.AddDate(0, 3, 0)} {
+		fut := bean.FutContract(pair, expiry)
+		fwd := spot * (1 + 0.01*expiry.Sub(asof).Hours()/24/30)
+		mkt[fut.Name()] = bean.OrderBookT{OrderBook: bean.NewOrderBook([]bean.Order{{Price: fwd - 0.5, Amount: 1}}, []bean.Order{{Price: fwd + 0.5, Amount: 1}}), Time: asof}
+		tm := expiry.Sub(asof).Hours() / 24 / 365
+		for strike := 5000.0; strike <= 12000; strike += 500 {
+			cp := bean.Call
+			if strike < fwd {
+				cp = bean.Put
+			}
+			c := bean.OptContract(pair, expiry, strike, cp)
+			v := math.Sqrt(truth.TotalVar(math.Log(strike/fwd)) * 0.25 / tm)
+			prc := c.OptPrice(asof, spot, fwd, v) / spot // in coin
+			mkt[c.Name()] = bean.OrderBookT{OrderBook: bean.NewOrderBook([]bean.Order{{Price: prc, Amount: 1}}, []bean.Order{{Price: prc, Amount: 1}}), Time: asof}
+		}
+	}
+
+	surf := vol.FitMarket(mkt, asof, spot)
+	assert.Equal(t, 2, len(surf.Smiles))
+	for _, s := range surf.Smiles {
+		for _, strike := range []float64{6000, 8000, 10000} {
+			want := math.Sqrt(truth.TotalVar(math.Log(strike/s.Forward)) * 0.25 / s.T)
+			assert.InDelta(t, want, s.Vol(strike), 0.005)
+		}
+	}
+	// interpolated between the expiries
+	mid := asof.AddDate(0, 2, 0)
+	v1, v2 := surf.Smiles[0].Vol(8000), surf.Smiles[1].Vol(8000)
+	v := surf.Vol(mid, 8000)
+	assert.True(t, v > math.Min(v1, v2)-0.01 && v < math.Max(v1, v2)+0.01)
+
+	points := surf.SmilePoints(pair)
+	assert.Equal(t, 2, len(points))
+	assert.InDelta(t, surf.Smiles[0].Vol(surf.Smiles[0].Forward), points[0].Atm, 1e-9)
+	// negative skew, puts over calls
+	assert.True(t, points[0].RR25 < 0)
+	assert.True(t, points[0].Fly25 > 0)
+}
@@ -224,18 +224,44 @@ func (trades TradeLogS) ToTransactions() (txns Transactions) {
 			maker = Seller
 		}
 		txn := Transaction{
-			Pair:      trd.Pair,
-			Price:     trd.Price,
-			Amount:    math.Abs(trd.Quantity) * sign,
-			TimeStamp: trd.Time,
-			Maker:     maker,
-			TxnID:     trd.OrderID,
+			Pair:            trd.Pair,
+			Price:           trd.Price,
+			Amount:          math.Abs(trd.Quantity) * sign,
+			TimeStamp:       trd.Time,
+			Maker:           maker,
+			TxnID:           trd.OrderID,
+			OrderID:         trd.OrderID,
+			Commission:      trd.Commission,
+			CommissionAsset: trd.CommissionAsset,
 		}
 		txns = append(txns, txn)
 	}
 	return txns
 }
 
+// TradeLogsFromTxn converts our own transactions, e.g. from a simulator, to trade logs
+func TradeLogsFromTxn(txns Transactions) (trades TradeLogS) {
+	for _, txn := range txns {
+		side := BUY
+		if txn.Amount < 0 {
+			side = SELL
+		}
+		trd := TradeLog{
+			OrderID:         txn.OrderID,
+			Pair:            txn.Pair,
+			Price:           txn.Price,
+			Quantity:        math.Abs(txn.Amount),
+			Commission:      txn.Commission,
+			CommissionAsset: txn.CommissionAsset,
+			Time:            txn.TimeStamp,
+			Side:            side,
+			TxnID:           txn.TxnID,
+		}
+		trades = append(trades, trd)
+	}
+	return trades
+}
+
 func (trades TradeLogS) Since(t time.Time) (position Portfolio, after TradeLogS) {
 	var before TradeLogS
 	for _, trd := range trades {
@@ -18,21 +18,27 @@ const (
 )
 
 type Transaction struct {
-	Pair      Pair
-	Price     float64
-	Amount    float64
-	TimeStamp time.Time
-	Maker     TraderType // buyer or seller
-	TxnID     string
+	Pair            Pair
+	Price           float64
+	Amount          float64
+	TimeStamp       time.Time
+	Maker           TraderType // buyer or seller
+	TxnID           string
+	OrderID         string  // our order, if it is our trade
+	Commission      float64 // our commission, if it is our trade
+	CommissionAsset Coin
 }
 
 type ContractTXN struct {
-	Instrument string
-	Price      float64
-	Amount     float64
-	TimeStamp  time.Time
-	Maker      TraderType // buyer or seller
-	TxnID      string
+	Instrument      string
+	Price           float64
+	Amount          float64
+	TimeStamp       time.Time
+	Maker           TraderType // buyer or seller
+	TxnID           string
+	OrderID         string  // our order, if it is our trade
+	Commission      float64 // our commission, if it is our trade
+	CommissionAsset Coin
 }
 
 type OHLCVBS struct {
@@ -221,26 +227,12 @@ func (txn Transactions) Since(t time.Time) Transactions {
 
 // get transactions in a time interval, assuming txn is sorted
 func (txn Transactions) Between(from, to time.Time) Transactions {
-	var res Transactions
-	startIdx := len(txn)
-	for i, tt := range txn {
-		if tt.TimeStamp.After(from) {
-			startIdx = i
-			break
-		}
-	}
-	if startIdx < len(txn) {
-		endIdx := startIdx
-		for i := startIdx; i < len(txn); i++ {
-			if !txn[i].TimeStamp.After(to) {
-				endIdx = i
-			} else {
-				break
-			}
-		}
-		res = txn[startIdx : endIdx+1]
+	i := sort.Search(len(txn), func(i int) bool { return txn[i].TimeStamp.After(from) })
+	j := sort.Search(len(txn), func(j int) bool { return txn[j].TimeStamp.After(to) })
+	if i >= j {
+		return nil
 	}
-	return res
+	return txn[i:j:j]
 }
 
 func (txn Transactions) Cross(price, amount float64) bool {
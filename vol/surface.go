@@ -0,0 +1,217 @@
+// Package vol builds implied volatility surfaces from option order books
+package vol
+
+import (
+	. "bean"
+	"bean/db/mds"
+	"math"
+	"sort"
+	"time"
+)
+
+// Quote is the implied vol of one option in a market snapshot
+type Quote struct {
+	Contract *Contract
+	Forward  float64
+	Vol      float64
+}
+
+// Smile is the fitted smile of one expiry
+type Smile struct {
+	Expiry  time.Time
+	T       float64 // time to expiry in years
+	Forward float64
+	SVI     SVI
+}
+
+// Surface is a set of smiles fitted at Asof, interpolated in total variance across expiries
+type Surface struct {
+	Asof   time.Time
+	Spot   float64
+	Smiles []Smile // sorted by expiry
+}
+
+// mid returns the mid price of a two sided book, NaN otherwise
+func mid(ob OrderBookT) float64 {
+	if ob.OrderBook.OrderBookCore == nil || !ob.Valid() {
+		return math.NaN()
+	}
+	return ob.Mid()
+}
+
+// ImpliedVols backs out the implied vols of the out of the money options in a GetAllContractOrderBooks snapshot,
+// from the mid of two sided books priced in coin as on Deribit. The forward of each expiry is the mid of its future,
+// or of the perpetual if the future is not in the snapshot, or spot
+func ImpliedVols(mkt map[string]OrderBookT, asof time.Time, spot float64) []Quote {
+	forwards := make(map[time.Time]float64)
+	perp := math.NaN()
+	for name, ob := range mkt {
+		c, err := ContractFromName(name)
+		if err != nil {
+			continue
+		}
+		if c.Perp() {
+			perp = mid(ob)
+		} else if c.IsFuture() {
+			if f := mid(ob); !math.IsNaN(f) {
+				forwards[c.Expiry()] = f
+			}
+		}
+	}
+	var quotes []Quote
+	for name, ob := range mkt {
+		c, err := ContractFromName(name)
+		if err != nil || !c.IsOption() || !c.Expiry().After(asof) {
+			continue
+		}
+		fwd, ok := forwards[c.Expiry()]
+		if !ok {
+			fwd = perp
+			if math.IsNaN(fwd) {
+				fwd = spot
+			}
+		}
+		// out of the money options only, the in the money ones are less liquid
+		if (c.CallPut() == Call && c.Strike() < fwd) || (c.CallPut() == Put && c.Strike() >= fwd) {
+			continue
+		}
+		prc := mid(ob)
+		if math.IsNaN(prc) {
+			continue
+		}
+		v := c.ImpVol(asof, spot, fwd, prc)
+		if math.IsNaN(v) || v <= 0 {
+			continue
+		}
+		quotes = append(quotes, Quote{Contract: c, Forward: fwd, Vol: v})
+	}
+	return quotes
+}
+
+// Fit fits an SVI smile to the quotes of each expiry, expiries with less than minQuotes quotes are skipped
+func Fit(quotes []Quote, asof time.Time, spot float64, minQuotes int) Surface {
+	byExpiry := make(map[time.Time][]Quote)
+	for _, q := range quotes {
+		byExpiry[q.Contract.Expiry()] = append(byExpiry[q.Contract.Expiry()], q)
+	}
+	surf := Surface{Asof: asof, Spot: spot}
+	for expiry, qs := range byExpiry {
+		if len(qs) < minQuotes {
+			continue
+		}
+		t := qs[0].Contract.ExpiryDays(asof) / 365.0
+		ks := make([]float64, len(qs))
+		ws := make([]float64, len(qs))
+		for i, q := range qs {
+			ks[i] = math.Log(q.Contract.Strike() / q.Forward)
+			ws[i] = q.Vol * q.Vol * t
+		}
+		surf.Smiles = append(surf.Smiles, Smile{Expiry: expiry, T: t, Forward: qs[0].Forward, SVI: FitSVI(ks, ws)})
+	}
+	sort.Slice(surf.Smiles, func(i, j int) bool { return surf.Smiles[i].Expiry.Before(surf.Smiles[j].Expiry) })
+	return surf
+}
+
+// FitMarket builds a surface from a GetAllContractOrderBooks snapshot
+func FitMarket(mkt map[string]OrderBookT, asof time.Time, spot float64) Surface {
+	return Fit(ImpliedVols(mkt, asof, spot), asof, spot, 5)
+}
+
+// Vol returns the implied vol of strike on the smile
+func (s Smile) Vol(strike float64) float64 {
+	return math.Sqrt(math.Max(s.SVI.TotalVar(math.Log(strike/s.Forward)), 0) / s.T)
+}
+
+// Forward returns the forward at expiry, interpolated linearly in time between the smiles
+func (surf Surface) Forward(expiry time.Time) float64 {
+	i, j, x := surf.bracket(expiry)
+	if i < 0 {
+		return surf.Spot
+	}
+	return surf.Smiles[i].Forward + x*(surf.Smiles[j].Forward-surf.Smiles[i].Forward)
+}
+
+// bracket returns the smiles around expiry and the weight of the later one, i < 0 if there are no smiles
+func (surf Surface) bracket(expiry time.Time) (i, j int, x float64) {
+	n := len(surf.Smiles)
+	if n == 0 {
+		return -1, -1, 0
+	}
+	k := sort.Search(n, func(k int) bool { return !surf.Smiles[k].Expiry.Before(expiry) })
+	switch {
+	case k == 0:
+		return 0, 0, 0
+	case k == n:
+		return n - 1, n - 1, 0
+	}
+	t := expiry.Sub(surf.Asof).Hours() / 24 / 365
+	return k - 1, k, (t - surf.Smiles[k-1].T) / (surf.Smiles[k].T - surf.Smiles[k-1].T)
+}
+
+// Vol returns the implied vol of strike at expiry. Between smiles, the total variance at the same
+// log moneyness is interpolated linearly in time, outside them the vol of the nearest smile is used
+func (surf Surface) Vol(expiry time.Time, strike float64) float64 {
+	i, j, x := surf.bracket(expiry)
+	if i < 0 {
+		return math.NaN()
+	}
+	if i == j {
+		s := surf.Smiles[i]
+		return s.Vol(strike * s.Forward / surf.Forward(expiry))
+	}
+	k := math.Log(strike / surf.Forward(expiry))
+	s1, s2 := surf.Smiles[i], surf.Smiles[j]
+	w := s1.SVI.TotalVar(k) + x*(s2.SVI.TotalVar(k)-s1.SVI.TotalVar(k))
+	t := s1.T + x*(s2.T-s1.T)
+	return math.Sqrt(math.Max(w, 0) / t)
+}
+
+// callDelta returns the forward delta of a call at log moneyness k
+func (s Smile) callDelta(k float64) float64 {
+	w := math.Max(s.SVI.TotalVar(k), 1e-12)
+	return 0.5 * math.Erfc(-((-k+w/2)/math.Sqrt(w))/math.Sqrt2)
+}
+
+// deltaVol returns the vol at the strike where the forward call delta is delta, found by bisection
+func (s Smile) deltaVol(delta float64) float64 {
+	lo, hi := -5.0, 5.0
+	for i := 0; i < 100; i++ {
+		k := (lo + hi) / 2
+		// call delta falls as the strike rises
+		if s.callDelta(k) > delta {
+			lo = k
+		} else {
+			hi = k
+		}
+	}
+	return math.Sqrt(math.Max(s.SVI.TotalVar((lo+hi)/2), 0) / s.T)
+}
+
+// SmilePoint returns the smile quoted as ATM forward vol, and risk reversals and butterflies of the
+// 25 and 10 delta calls and puts
+func (s Smile) SmilePoint(pair Pair, asof time.Time, spot float64) mds.SmilePoint {
+	atm := s.Vol(s.Forward)
+	c25, p25 := s.deltaVol(0.25), s.deltaVol(0.75)
+	c10, p10 := s.deltaVol(0.10), s.deltaVol(0.90)
+	return mds.SmilePoint{
+		TimeStamp: asof,
+		Pair:      pair,
+		Expiry:    s.Expiry,
+		Atm:       atm,
+		RR25:      c25 - p25,
+		RR10:      c10 - p10,
+		Fly25:     (c25+p25)/2 - atm,
+		Fly10:     (c10+p10)/2 - atm,
+		Spot:      spot,
+		Swaps:     s.Forward - spot,
+	}
+}
+
+// SmilePoints returns the SmilePoint of each expiry of the surface, e.g. to store with MDSSink.SmilePoint
+func (surf Surface) SmilePoints(pair Pair) []mds.SmilePoint {
+	points := make([]mds.SmilePoint, len(surf.Smiles))
+	for i, s := range surf.Smiles {
+		points[i] = s.SmilePoint(pair, surf.Asof, surf.Spot)
+	}
+	return points
+}
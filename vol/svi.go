@@ -0,0 +1,118 @@
+package vol
+
+import (
+	"math"
+	"sort"
+)
+
+// SVI is the raw SVI parametrisation of a smile, the total implied variance at log moneyness k = ln(K/F) being
+// w(k) = A + B (Rho (k - M) + sqrt((k - M)^2 + Sigma^2))
+type SVI struct {
+	A, B, Rho, M, Sigma float64
+}
+
+// TotalVar returns the total implied variance vol^2 * T at log moneyness k
+func (s SVI) TotalVar(k float64) float64 {
+	return s.A + s.B*(s.Rho*(k-s.M)+math.Sqrt((k-s.M)*(k-s.M)+s.Sigma*s.Sigma))
+}
+
+// sviFromX maps unconstrained optimiser coordinates to SVI params with B >= 0, |Rho| < 1 and Sigma > 0
+func sviFromX(x []float64) SVI {
+	return SVI{A: x[0], B: math.Exp(x[1]), Rho: math.Tanh(x[2]), M: x[3], Sigma: math.Exp(x[4])}
+}
+
+// FitSVI fits an SVI smile to total variances ws at log moneyness ks by least squares.
+// Smiles with negative variance are rejected
+func FitSVI(ks, ws []float64) SVI {
+	minW := math.Inf(1)
+	for _, w := range ws {
+		minW = math.Min(minW, w)
+	}
+	x0 := []float64{minW * 0.9, math.Log(0.1), 0, 0, math.Log(0.1)}
+	x := nelderMead(func(x []float64) float64 {
+		s := sviFromX(x)
+		// the minimum variance A + B Sigma sqrt(1 - Rho^2) must not be negative
+		if s.A+s.B*s.Sigma*math.Sqrt(1-s.Rho*s.Rho) < 0 {
+			return math.Inf(1)
+		}
+		sse := 0.0
+		for i, k := range ks {
+			d := s.TotalVar(k) - ws[i]
+			sse += d * d
+		}
+		return sse
+	}, x0, 5000, 1e-14)
+	return sviFromX(x)
+}
+
+// nelderMead minimises f from x0 with the downhill simplex method
+func nelderMead(f func([]float64) float64, x0 []float64, maxIter int, tol float64) []float64 {
+	n := len(x0)
+	simplex := make([][]float64, n+1)
+	values := make([]float64, n+1)
+	for i := range simplex {
+		simplex[i] = append([]float64{}, x0...)
+		if i > 0 {
+			simplex[i][i-1] += 0.1
+		}
+		values[i] = f(simplex[i])
+	}
+	point := func(c []float64, d []float64, t float64) []float64 {
+		p := make([]float64, n)
+		for j := range p {
+			p[j] = c[j] + t*(d[j]-c[j])
+		}
+		return p
+	}
+	for iter := 0; iter < maxIter; iter++ {
+		sort.Sort(byValue{simplex, values})
+		if math.Abs(values[n]-values[0]) < tol {
+			break
+		}
+		// centroid of all but the worst point
+		c := make([]float64, n)
+		for _, p := range simplex[:n] {
+			for j := range c {
+				c[j] += p[j] / float64(n)
+			}
+		}
+		r := point(c, simplex[n], -1)
+		fr := f(r)
+		switch {
+		case fr < values[0]:
+			e := point(c, simplex[n], -2)
+			if fe := f(e); fe < fr {
+				simplex[n], values[n] = e, fe
+			} else {
+				simplex[n], values[n] = r, fr
+			}
+		case fr < values[n-1]:
+			simplex[n], values[n] = r, fr
+		default:
+			k := point(c, simplex[n], 0.5)
+			if fk := f(k); fk < values[n] {
+				simplex[n], values[n] = k, fk
+			} else {
+				// shrink towards the best point
+				for i := 1; i <= n; i++ {
+					simplex[i] = point(simplex[0], simplex[i], 0.5)
+					values[i] = f(simplex[i])
+				}
+			}
+		}
+	}
+	sort.Sort(byValue{simplex, values})
+	return simplex[0]
+}
+
+type byValue struct {
+	points [][]float64
+	values []float64
+}
+
+func (b byValue) Len() int           { return len(b.values) }
+func (b byValue) Less(i, j int) bool { return b.values[i] < b.values[j] }
+func (b byValue) Swap(i, j int) {
+	b.points[i], b.points[j] = b.points[j], b.points[i]
+	b.values[i], b.values[j] = b.values[j], b.values[i]
+}